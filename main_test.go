@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"com.example/setup/pkg/setup"
+)
+
+// 设置了该环境变量时测试进程作为 setup 命令运行
+const runMainEnv = "GO_TEST_RUN_SETUP_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestVersionFlag(t *testing.T) {
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-version", "-stub-tar", "missing.tar")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("setup -version 失败: %v, 输出: %s", err, output)
+	}
+	if got := strings.TrimSpace(string(output)); got != setup.VersionString() {
+		t.Errorf("setup -version 输出 %q, want %q", got, setup.VersionString())
+	}
+
+	// 只输出版本信息，不处理工作目录
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("setup -version 在工作目录中创建了 %v", entries)
+	}
+}
@@ -0,0 +1,39 @@
+package setup
+
+import (
+	"runtime"
+	"strings"
+)
+
+// 镜像文件名中可能出现的架构后缀，与 GOARCH 的取值一致
+var knownArches = []string{"amd64", "arm64", "arm", "386", "ppc64le", "s390x", "riscv64"}
+
+// 加载镜像的目标架构，未指定时为主机架构
+func targetArch(cfg *Config) string {
+	if cfg.Arch != "" {
+		return cfg.Arch
+	}
+	return runtime.GOARCH
+}
+
+// 从镜像文件名中解析架构后缀，suffix 为后缀格式，{arch} 为架构占位符，例如 app-amd64.tar 的格式为 -{arch}
+func archiveArch(name, suffix string) (string, bool) {
+	base, _ := trimArchiveSuffix(name)
+	for _, arch := range knownArches {
+		if strings.HasSuffix(base, strings.ReplaceAll(suffix, "{arch}", arch)) {
+			return arch, true
+		}
+	}
+
+	return "", false
+}
+
+// 镜像文件是否需要加载：文件名带架构后缀时只加载目标架构的文件，不带后缀时总是加载
+func archSelected(name string, cfg *Config) bool {
+	if cfg.ArchSuffix == "" {
+		return true
+	}
+
+	arch, ok := archiveArch(name, cfg.ArchSuffix)
+	return !ok || arch == targetArch(cfg)
+}
@@ -0,0 +1,99 @@
+package setup
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestArchSelected(t *testing.T) {
+	tests := []struct {
+		name   string
+		arch   string
+		suffix string
+		want   bool
+	}{
+		{name: "app-amd64.tar", arch: "amd64", suffix: "-{arch}", want: true},
+		{name: "app-arm64.tar.gz", arch: "amd64", suffix: "-{arch}", want: false},
+		{name: "app-arm64.tar.gz", arch: "arm64", suffix: "-{arch}", want: true},
+		{name: "app-arm.tar", arch: "arm64", suffix: "-{arch}", want: false},
+		{name: "app.tar", arch: "arm64", suffix: "-{arch}", want: true},
+		{name: "app.arm64.tar", arch: "amd64", suffix: ".{arch}", want: false},
+		{name: "app.arm64.tar", arch: "amd64", suffix: "-{arch}", want: true},
+		{name: "app-arm64.tar", arch: "amd64", suffix: "", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" "+tt.arch+" "+tt.suffix, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Arch = tt.arch
+			cfg.ArchSuffix = tt.suffix
+
+			if got := archSelected(tt.name, cfg); got != tt.want {
+				t.Errorf("archSelected() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessSubDirArch(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "主机架构", want: []string{"common", runtime.GOARCH}},
+		{name: "-arch 指定架构", args: []string{"-arch", "arm64"}, want: []string{"arm64", "common"}},
+		{name: "没有对应的镜像文件", args: []string{"-arch", "s390x"}, want: []string{"common"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &concurrencyRunner{}
+			cfg := testConfig(t, nil)
+			cfg.Runner = runner
+			fs := flag.NewFlagSet("setup", flag.ContinueOnError)
+			RegisterFlags(fs, cfg)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			// 镜像文件内容为其架构
+			subDirPath := filepath.Join(cfg.WorkDir, "10-app")
+			if err := os.Mkdir(subDirPath, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			files := map[string]string{"common.tar": "common", "app-amd64.tar": "amd64", "app-arm64.tar": "arm64"}
+			if runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+				files["app-"+runtime.GOARCH+".tar"] = runtime.GOARCH
+			}
+			for name, body := range files {
+				if err := os.WriteFile(filepath.Join(subDirPath, name), []byte(body), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			semaphore := make(chan struct{}, cfg.ConcurrentTasks)
+			if err := processSubDir(context.Background(), subDirPath, subDirManifest{}, "", 1, semaphore, nil, cfg); err != nil {
+				t.Fatalf("processSubDir() error = %v", err)
+			}
+
+			var loaded []string
+			for _, event := range runner.events {
+				if body, ok := strings.CutPrefix(event, "start "); ok {
+					loaded = append(loaded, body)
+				}
+			}
+			slices.Sort(loaded)
+			slices.Sort(tt.want)
+			if !slices.Equal(loaded, tt.want) {
+				t.Errorf("加载了 %q, want %q", loaded, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package setup
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// 构建信息，发布时通过 -ldflags 设置，例如：
+//
+//	go build -ldflags "-X com.example/setup/pkg/setup.version=1.2.0 -X com.example/setup/pkg/setup.commit=$(git rev-parse --short HEAD) -X com.example/setup/pkg/setup.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// 未通过 -ldflags 设置时，从 Go 嵌入的 VCS 信息中读取提交和时间
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision" && commit == "":
+			commit = s.Value
+		case s.Key == "vcs.time" && buildDate == "":
+			buildDate = s.Value
+		}
+	}
+}
+
+// 版本信息字符串
+func VersionString() string {
+	s := "setup " + version
+	if commit != "" {
+		s += fmt.Sprintf(" (commit %s)", commit)
+	}
+	if buildDate != "" {
+		s += fmt.Sprintf(" built %s", buildDate)
+	}
+
+	return s
+}
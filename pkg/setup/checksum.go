@@ -0,0 +1,317 @@
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// 流式计算校验和时使用的缓冲区大小，内存占用与文件大小无关
+const hashBufferSize = 1 << 20
+
+// 超过该大小的文件在计算校验和时输出进度
+const hashProgressThreshold = 1 << 30
+
+// 以流式方式计算文件的 SHA-256
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	var w io.Writer = h
+	if info.Size() > hashProgressThreshold {
+		w = &hashProgress{w: h, path: path, total: info.Size()}
+	}
+
+	if _, err := io.CopyBuffer(w, f, make([]byte, hashBufferSize)); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 计算校验和的进度，每完成 10% 输出一次日志
+type hashProgress struct {
+	w       io.Writer
+	path    string
+	total   int64
+	written int64
+	logged  int64
+}
+
+func (p *hashProgress) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+
+	if percent := p.written * 100 / p.total; percent >= p.logged+10 {
+		p.logged = percent - percent%10
+		slog.Info("正在计算校验和", "file", p.path, "progress", fmt.Sprintf("%d%%", p.logged))
+	}
+
+	return n, err
+}
+
+// 计算部署指纹：MaxDepth 层子目录中所有压缩文件和清单文件校验和的汇总哈希
+func computeFingerprint(cwd string, cfg *Config) (string, error) {
+	var lines []string
+
+	subDirs, err := os.ReadDir(cwd)
+	if err != nil {
+		return "", fmt.Errorf("读取目录失败: %w", err)
+	}
+
+	for _, subDir := range subDirs {
+		if !subDir.IsDir() {
+			continue
+		}
+
+		subLines, err := fingerprintDir(cwd, subDir.Name(), 1, cfg)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, subLines...)
+	}
+
+	// 清单文件不存在时不参与计算
+	sum, err := fileSHA256(filepath.Join(cwd, cfg.ManifestName))
+	if err == nil {
+		lines = append(lines, sum+"  "+cfg.ManifestName)
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("计算清单文件校验和失败: %w", err)
+	}
+
+	sort.Strings(lines)
+	h := sha256.Sum256([]byte(strings.Join(lines, "\n") + "\n"))
+
+	return hex.EncodeToString(h[:]), nil
+}
+
+// 计算子目录 dir 中压缩文件的校验和，dir 为相对 cwd 的路径，depth 为其层级，小于 MaxDepth 时继续计算下一级目录
+func fingerprintDir(cwd, dir string, depth int, cfg *Config) ([]string, error) {
+	files, err := os.ReadDir(filepath.Join(cwd, dir))
+	if err != nil {
+		return nil, fmt.Errorf("读取子目录失败: %w", err)
+	}
+
+	var lines []string
+	for _, file := range files {
+		name := filepath.Join(dir, file.Name())
+		if file.IsDir() {
+			if depth < cfg.MaxDepth {
+				subLines, err := fingerprintDir(cwd, name, depth+1, cfg)
+				if err != nil {
+					return nil, err
+				}
+				lines = append(lines, subLines...)
+			}
+			continue
+		}
+		if _, ok := classifyArchive(file.Name()); !ok {
+			continue
+		}
+
+		sum, err := fileSHA256(filepath.Join(cwd, name))
+		if err != nil {
+			return nil, fmt.Errorf("计算 %s 校验和失败: %w", name, err)
+		}
+		lines = append(lines, sum+"  "+filepath.ToSlash(name))
+	}
+
+	return lines, nil
+}
+
+// 计算部署指纹，记录到运行状态并按配置写入标记文件
+func recordFingerprint(cwd string, cfg *Config) error {
+	fingerprint, err := computeFingerprint(cwd, cfg)
+	if err != nil {
+		return fmt.Errorf("计算部署指纹失败: %w", err)
+	}
+
+	cfg.session.status.setFingerprint(fingerprint)
+	slog.Info("部署指纹", "fingerprint", fingerprint)
+
+	if cfg.FingerprintFile != "" {
+		if err := os.WriteFile(cfg.FingerprintFile, []byte(fingerprint+"\n"), 0o644); err != nil {
+			return fmt.Errorf("写入部署指纹文件失败: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// 压缩文件对应的校验和文件后缀
+const checksumSuffix = ".sha256"
+
+// 按同目录下的 .sha256 文件校验压缩文件，校验和文件格式与 sha256sum 输出一致
+func verifyArchive(path string, cfg *Config) error {
+	if !cfg.VerifyChecksums {
+		return nil
+	}
+
+	data, err := os.ReadFile(path + checksumSuffix)
+	if err != nil {
+		return fmt.Errorf("读取 %s 的校验和文件失败: %w", filepath.Base(path), err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return fmt.Errorf("校验和文件 %s 为空", path+checksumSuffix)
+	}
+	want := strings.ToLower(fields[0])
+
+	got, err := fileSHA256(path)
+	if err != nil {
+		return fmt.Errorf("计算 %s 的校验和失败: %w", filepath.Base(path), err)
+	}
+	if got != want {
+		return fmt.Errorf("%s 校验和不匹配，期望 %s，实际 %s", filepath.Base(path), want, got)
+	}
+
+	slog.Debug("校验和匹配", "file", path, "sha256", got)
+	return nil
+}
+
+// 主Stub文件中的校验和清单，格式与 sha256sum 输出一致，路径相对于主Stub文件的根目录
+const checksumListName = "SHA256SUMS"
+
+// 解析校验和清单，返回路径到校验和的映射，忽略空行和 # 开头的注释
+func parseChecksumList(data []byte) (map[string]string, error) {
+	sums := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sum, name, ok := strings.Cut(line, " ")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		if !ok || len(sum) != sha256.Size*2 || name == "" {
+			return nil, fmt.Errorf("%s 第 %d 行格式错误: %s", checksumListName, i+1, line)
+		}
+		sums[strings.TrimPrefix(path.Clean(name), "./")] = strings.ToLower(sum)
+	}
+
+	return sums, nil
+}
+
+// 主Stub文件包含校验和清单时，解压前校验其中所有压缩文件，汇总报告损坏、缺失和未列出的文件
+func verifyStubChecksums(ctx context.Context, stubTar string, cfg *Config) error {
+	entries, err := listTarEntries(ctx, stubTar, cfg)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(entries, func(e string) bool {
+		return strings.TrimPrefix(path.Clean(e), "./") == checksumListName
+	}) {
+		return nil
+	}
+
+	f, err := os.Open(stubTar)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := archiveReader(f, stubTar)
+	if err != nil {
+		return err
+	}
+
+	// 计算所有压缩文件的校验和并读取校验和清单
+	actual := make(map[string]string)
+	var list []byte
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %w", stubTar, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := strings.TrimPrefix(path.Clean(hdr.Name), "./")
+		if name == checksumListName {
+			if list, err = io.ReadAll(tr); err != nil {
+				return fmt.Errorf("读取 %s 失败: %w", checksumListName, err)
+			}
+			continue
+		}
+		if _, ok := classifyArchive(path.Base(name)); !ok {
+			continue
+		}
+
+		h := sha256.New()
+		if _, err := io.CopyBuffer(h, tr, make([]byte, hashBufferSize)); err != nil {
+			return fmt.Errorf("读取 %s 中的 %s 失败: %w", filepath.Base(stubTar), name, err)
+		}
+		actual[name] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	want, err := parseChecksumList(list)
+	if err != nil {
+		return err
+	}
+
+	var corrupted, missing, unlisted []string
+	for name, sum := range want {
+		got, ok := actual[name]
+		switch {
+		case !ok:
+			missing = append(missing, name)
+		case got != sum:
+			slog.Error("校验和不匹配", "file", name, "expected", sum, "actual", got)
+			corrupted = append(corrupted, name)
+		}
+	}
+	for name := range actual {
+		if _, ok := want[name]; !ok {
+			unlisted = append(unlisted, name)
+		}
+	}
+	sort.Strings(corrupted)
+	sort.Strings(missing)
+	sort.Strings(unlisted)
+
+	var problems []string
+	if len(corrupted) > 0 {
+		problems = append(problems, "校验和不匹配: "+strings.Join(corrupted, ", "))
+	}
+	if len(missing) > 0 {
+		problems = append(problems, "文件缺失: "+strings.Join(missing, ", "))
+	}
+	if len(unlisted) > 0 {
+		problems = append(problems, "未列出校验和: "+strings.Join(unlisted, ", "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s 校验失败，%s", checksumListName, strings.Join(problems, "；"))
+	}
+
+	slog.Info("校验和清单校验通过", "file", stubTar, "archives", len(actual))
+	return nil
+}
@@ -0,0 +1,96 @@
+package setup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestComputeFingerprintMaxDepth(t *testing.T) {
+	cwd := t.TempDir()
+	write := func(name, body string) {
+		t.Helper()
+		p := filepath.Join(cwd, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("10-app/app.tar", "app")
+	write("10-app/db/db.tar", "db")
+
+	fingerprints := func() (shallow, deep string) {
+		t.Helper()
+		cfg := DefaultConfig()
+		shallow, err := computeFingerprint(cwd, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.MaxDepth = 2
+		deep, err = computeFingerprint(cwd, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return shallow, deep
+	}
+
+	shallow, deep := fingerprints()
+	if shallow == deep {
+		t.Errorf("MaxDepth 为 2 时没有计算下一级目录中的压缩文件")
+	}
+
+	// 超过 MaxDepth 的压缩文件变化不影响指纹
+	write("10-app/db/db.tar", "db v2")
+	shallow2, deep2 := fingerprints()
+	if shallow2 != shallow {
+		t.Errorf("MaxDepth 为 1 时指纹包含了下一级目录中的压缩文件")
+	}
+	if deep2 == deep {
+		t.Errorf("MaxDepth 为 2 时下一级目录中的压缩文件变化没有改变指纹")
+	}
+}
+
+func TestVerifyArchive(t *testing.T) {
+	sum := sha256.Sum256([]byte("image"))
+	good := hex.EncodeToString(sum[:]) + "  app.tar\n"
+
+	tests := []struct {
+		name     string
+		body     string
+		checksum string
+		disabled bool
+		wantErr  bool
+	}{
+		{name: "校验和匹配", body: "image", checksum: good},
+		{name: "大写的校验和", body: "image", checksum: strings.ToUpper(good)},
+		{name: "文件被篡改", body: "imagf", checksum: good, wantErr: true},
+		{name: "缺少校验和文件", body: "image", wantErr: true},
+		{name: "校验和文件为空", body: "image", checksum: "\n", wantErr: true},
+		{name: "未启用校验", body: "imagf", disabled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.tar")
+			if err := os.WriteFile(path, []byte(tt.body), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.checksum != "" {
+				if err := os.WriteFile(path+checksumSuffix, []byte(tt.checksum), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := DefaultConfig()
+			cfg.VerifyChecksums = !tt.disabled
+
+			if err := verifyArchive(path, cfg); (err != nil) != tt.wantErr {
+				t.Errorf("verifyArchive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package setup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// 运行成功后删除主Stub文件解压出的压缩文件，子目录为空时一并删除
+// 解压出的普通文件可能被 Compose 服务挂载，默认保留，CleanupSubDirs 时删除整个子目录；CleanupArchives 时同时删除主Stub文件
+func cleanupStub(ctx context.Context, stubTar, cwd string, cfg *Config) error {
+	entries, err := listTarEntries(ctx, stubTar, cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, plan := range buildPlan(entries, cfg.MaxDepth) {
+		dir := filepath.Join(cwd, plan.Name)
+		if cfg.CleanupSubDirs {
+			if err := removeAllWithin(cwd, dir); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, task := range plan.Tasks {
+			archive := filepath.Join(dir, task.Name)
+			if err := removeWithin(cwd, archive); err != nil {
+				return err
+			}
+			if err := removeWithin(cwd, archive+checksumSuffix); err != nil {
+				return err
+			}
+
+			// 删除压缩文件所在的更深层空目录
+			for d := filepath.Dir(archive); d != dir && isWithin(dir, d); d = filepath.Dir(d) {
+				if err := removeEmptyDir(cwd, d); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := removeEmptyDir(cwd, dir); err != nil {
+			return err
+		}
+	}
+
+	if cfg.CleanupArchives {
+		if err := removeWithin(cwd, stubTar); err != nil {
+			return err
+		}
+		if err := removeWithin(cwd, stubTar+checksumSuffix); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 目录为空时删除
+func removeEmptyDir(root, dir string) error {
+	if files, err := os.ReadDir(dir); err == nil && len(files) == 0 {
+		return removeWithin(root, dir)
+	}
+	return nil
+}
+
+// 删除工作目录中的目录及其中的所有文件，不存在时忽略，拒绝删除工作目录之外的路径
+func removeAllWithin(root, p string) error {
+	if !isWithin(root, p) || p == root {
+		return fmt.Errorf("拒绝删除工作目录之外的路径: %s", p)
+	}
+
+	if _, err := os.Lstat(p); os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.RemoveAll(p); err != nil {
+		return fmt.Errorf("清理 %s 失败: %w", p, err)
+	}
+
+	slog.Info("已清理", "path", p)
+	return nil
+}
+
+// 删除工作目录中的文件或空目录，不存在时忽略，拒绝删除工作目录之外的路径
+func removeWithin(root, p string) error {
+	if !isWithin(root, p) || p == root {
+		return fmt.Errorf("拒绝删除工作目录之外的路径: %s", p)
+	}
+
+	if err := os.Remove(p); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("清理 %s 失败: %w", p, err)
+	}
+
+	slog.Info("已清理", "path", p)
+	return nil
+}
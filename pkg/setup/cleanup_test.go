@@ -0,0 +1,54 @@
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanupStub(t *testing.T) {
+	tests := []struct {
+		name       string
+		subDirs    bool
+		wantConfig bool
+		wantDir    bool
+	}{
+		{name: "保留普通文件", wantConfig: true, wantDir: true},
+		{name: "删除整个子目录", subDirs: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cwd := t.TempDir()
+			stubTar := writeTestTar(t, "stub.tar", []testEntry{
+				{Name: "10-app/", Typeflag: tar.TypeDir},
+				{Name: "10-app/app.tar", Typeflag: tar.TypeReg, Body: "image"},
+				{Name: "10-app/config.yml", Typeflag: tar.TypeReg, Body: "x: 1"},
+			})
+			cfg := DefaultConfig()
+			cfg.CleanupSubDirs = tt.subDirs
+			if err := extractTar(context.Background(), stubTar, cwd, cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := cleanupStub(context.Background(), stubTar, cwd, cfg); err != nil {
+				t.Fatalf("cleanupStub() error = %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(cwd, "10-app", "app.tar")); !os.IsNotExist(err) {
+				t.Errorf("没有删除压缩文件: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(cwd, "10-app", "config.yml")); (err == nil) != tt.wantConfig {
+				t.Errorf("config.yml 存在 = %v, want %v", err == nil, tt.wantConfig)
+			}
+			if _, err := os.Stat(filepath.Join(cwd, "10-app")); (err == nil) != tt.wantDir {
+				t.Errorf("子目录存在 = %v, want %v", err == nil, tt.wantDir)
+			}
+			if _, err := os.Stat(stubTar); err != nil {
+				t.Errorf("没有指定 CleanupArchives 时删除了主Stub文件: %v", err)
+			}
+		})
+	}
+}
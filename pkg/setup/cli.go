@@ -0,0 +1,251 @@
+package setup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// 子命令，未指定子命令时执行 install
+const (
+	cmdInstall   = "install"
+	cmdVerify    = "verify"
+	cmdClean     = "clean"
+	cmdStatus    = "status"
+	cmdDiff      = "diff"
+	cmdLoadImage = "load-image"
+	cmdPack      = "pack"
+)
+
+// 命令行用法
+const usage = `用法: setup [参数] [子命令] [参数] [STUB 文件]
+
+子命令:
+  install     解压主Stub文件、加载镜像并启动服务，未指定子命令时执行
+  verify      只校验主Stub文件及其中压缩文件的校验和、条目路径和磁盘空间，不做任何修改
+  clean       撤销失败的运行所做的修改，删除主Stub文件解压出的压缩文件和断点续跑状态
+  status      输出工作目录中正在运行的 setup 和断点续跑进度
+  diff        比较两个 Stub 文件
+  load-image  只加载包含指定镜像引用的镜像文件
+  pack        按打包描述文件导出镜像、打包文件并生成带校验和的主Stub文件
+
+参数可以在子命令之前或之后指定:`
+
+// 输出命令行用法，参数默认值可能来自配置文件，密钥参数的默认值显示为 ******
+func PrintUsage(fs *flag.FlagSet) {
+	fmt.Fprintln(fs.Output(), usage)
+
+	defaults := make(map[*flag.Flag]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		if slices.Contains(secretFlags, f.Name) && f.DefValue != "" {
+			defaults[f] = f.DefValue
+			f.DefValue = "******"
+		}
+	})
+	defer func() {
+		for f, value := range defaults {
+			f.DefValue = value
+		}
+	}()
+
+	fs.PrintDefaults()
+}
+
+// 拆分出命令行中的子命令，第一个参数不是子命令时为 install，兼容直接指定 STUB 文件的用法
+func splitSubcommand(args []string) (string, []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case cmdInstall, cmdVerify, cmdClean, cmdStatus, cmdDiff, cmdLoadImage, cmdPack:
+			return args[0], args[1:]
+		}
+	}
+
+	return cmdInstall, args
+}
+
+// 解析子命令之后的参数，返回剩余的参数；diff、load-image 和 pack 使用各自的参数
+func parseSubcommandFlags(name string, args []string, cfg *Config) []string {
+	if name == cmdDiff || name == cmdLoadImage || name == cmdPack {
+		return args
+	}
+
+	// 配置文件已由 LoadConfig 读取，这里只需接受 -config 参数
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.String("config", "", "配置文件路径，支持 YAML、JSON 和 TOML")
+	RegisterFlags(fs, cfg)
+	fs.Usage = func() { PrintUsage(fs) }
+	fs.Parse(args)
+
+	return fs.Args()
+}
+
+// 主Stub文件在工作目录中的路径，远程文件先下载到工作目录，返回的函数删除下载的文件
+func resolveStubTar(ctx context.Context, cwd string, cfg *Config) (string, func(), error) {
+	if !isRemoteStub(cfg.StubTarName) {
+		return filepath.Join(cwd, cfg.StubTarName), func() {}, nil
+	}
+
+	stubTar, err := downloadStub(ctx, cfg.StubTarName, cwd, cfg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return stubTar, func() { removeDownload(stubTar) }, nil
+}
+
+// verify 子命令：校验主Stub文件能否正常安装，不解压文件也不加载镜像
+func runVerify(ctx context.Context, cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	cwd, err := filepath.Abs(cfg.WorkDir)
+	if err != nil {
+		return fmt.Errorf("获取当前工作目录失败: %w", err)
+	}
+
+	stubTar, remove, err := resolveStubTar(ctx, cwd, cfg)
+	if err != nil {
+		return err
+	}
+	defer remove()
+
+	if _, err := os.Stat(stubTar); os.IsNotExist(err) {
+		return withCategory(ErrExtractFailed, fmt.Errorf("STUB 文件不存在: %w", err))
+	}
+
+	// 存在校验和文件时总是校验
+	if _, err := os.Stat(stubTar + checksumSuffix); err == nil {
+		verifyCfg := *cfg
+		verifyCfg.VerifyChecksums = true
+		if err := verifyArchive(stubTar, &verifyCfg); err != nil {
+			return withCategory(ErrExtractFailed, err)
+		}
+		slog.Info("校验和匹配", "file", stubTar)
+	} else if cfg.VerifyChecksums {
+		return withCategory(ErrExtractFailed, verifyArchive(stubTar, cfg))
+	}
+
+	if err := checkArchiveEntries(ctx, stubTar); err != nil {
+		return withCategory(ErrExtractFailed, err)
+	}
+	if err := verifyStubChecksums(ctx, stubTar, cfg); err != nil {
+		return withCategory(ErrExtractFailed, err)
+	}
+	if err := checkDiskSpace(stubTar, cwd, cfg); err != nil {
+		return withCategory(ErrExtractFailed, err)
+	}
+
+	entries, err := listTarEntries(ctx, stubTar, cfg)
+	if err != nil {
+		return withCategory(ErrExtractFailed, err)
+	}
+	plans := buildPlan(entries, cfg.MaxDepth)
+	tasks := 0
+	for _, plan := range plans {
+		tasks += len(plan.Tasks)
+	}
+
+	slog.Info("校验通过", "file", stubTar, "subDirs", len(plans), "tasks", tasks)
+	return nil
+}
+
+// clean 子命令：撤销之前失败的运行所做的修改，删除主Stub文件解压出的压缩文件和断点续跑状态文件
+func runClean(ctx context.Context, cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	cwd, err := filepath.Abs(cfg.WorkDir)
+	if err != nil {
+		return fmt.Errorf("获取当前工作目录失败: %w", err)
+	}
+
+	unlock, err := acquireLock(cwd, cfg.Force)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	stubTar, remove, err := resolveStubTar(ctx, cwd, cfg)
+	if err != nil {
+		return err
+	}
+	defer remove()
+
+	// 先撤销之前失败的运行所做的修改，再删除解压出的压缩文件
+	if err := rollback(ctx, cwd, cfg); err != nil {
+		return err
+	}
+	if err := cleanupStub(ctx, stubTar, cwd, cfg); err != nil {
+		return err
+	}
+
+	state := &runState{path: filepath.Join(cwd, stateFileName)}
+	if err := state.remove(); err != nil {
+		return err
+	}
+
+	slog.Info("清理完成")
+	return nil
+}
+
+// status 子命令：输出持有锁文件的进程和断点续跑状态文件中已完成的子目录
+func showStatus(cfg *Config) error {
+	cwd, err := filepath.Abs(cfg.WorkDir)
+	if err != nil {
+		return fmt.Errorf("获取当前工作目录失败: %w", err)
+	}
+
+	lockPath := filepath.Join(cwd, lockFileName)
+	if _, err := os.Stat(lockPath); err == nil {
+		held := readLock(lockPath)
+		host, _ := os.Hostname()
+		if held.PID != 0 && held.Host == host && !processAlive(held.PID) {
+			fmt.Printf("运行状态: 残留的锁文件，进程 %d 已退出\n", held.PID)
+		} else {
+			fmt.Printf("运行状态: 正在运行，进程 %d(%s) 于 %s 开始\n", held.PID, held.Host, held.StartedAt.Format(time.RFC3339))
+		}
+	} else {
+		fmt.Println("运行状态: 未运行")
+	}
+
+	data, err := os.ReadFile(filepath.Join(cwd, stateFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("处理进度: 无未完成的运行")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取状态文件失败: %w", err)
+	}
+
+	var state runState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("解析状态文件失败: %w", err)
+	}
+	// 成功的运行只保留文件的重试记录
+	if len(state.Completed) == 0 {
+		fmt.Println("处理进度: 无未完成的运行")
+	} else {
+		fmt.Printf("处理进度: 已完成 %d 个子目录，可使用 -resume 继续\n", len(state.Completed))
+		for _, name := range state.Completed {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	if len(state.Retries) > 0 {
+		fmt.Printf("重试记录: %d 个文件在最近一次运行中需要重试，之后的运行会延长其初始退避时间\n", len(state.Retries))
+		for _, name := range slices.Sorted(maps.Keys(state.Retries)) {
+			fmt.Printf("  %s: %d 次\n", name, state.Retries[name])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package setup
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// 执行外部命令的接口，方法与 exec.Cmd 的同名方法一致
+// 所有通过 command 构造的命令都经由 Config.Runner 执行，可以替换为不实际执行命令的实现
+type CommandRunner interface {
+	Run(cmd *exec.Cmd) error
+	Output(cmd *exec.Cmd) ([]byte, error)
+	CombinedOutput(cmd *exec.Cmd) ([]byte, error)
+}
+
+// 直接执行命令的默认实现
+type execRunner struct{}
+
+func (execRunner) Run(cmd *exec.Cmd) error                      { return cmd.Run() }
+func (execRunner) Output(cmd *exec.Cmd) ([]byte, error)         { return cmd.Output() }
+func (execRunner) CombinedOutput(cmd *exec.Cmd) ([]byte, error) { return cmd.CombinedOutput() }
+
+// 执行命令使用的 CommandRunner，未设置时直接执行
+func (cfg *Config) runner() CommandRunner {
+	if cfg.Runner == nil {
+		return execRunner{}
+	}
+	return cfg.Runner
+}
+
+// 构造外部命令，配置了命令前缀时将其加在命令前面，例如 nice -n 10
+func command(ctx context.Context, cfg *Config, name string, args ...string) *exec.Cmd {
+	if len(cfg.CommandPrefix) == 0 {
+		return exec.CommandContext(ctx, name, args...)
+	}
+
+	full := append(append(append([]string{}, cfg.CommandPrefix[1:]...), name), args...)
+	return exec.CommandContext(ctx, cfg.CommandPrefix[0], full...)
+}
+
+// 检查命令前缀中的可执行文件是否存在，只检查第一项，其余为它的参数，例如 taskset -c 0-3 或 sudo -u deploy
+func checkCommandPrefix(cfg *Config) error {
+	if len(cfg.CommandPrefix) == 0 {
+		return nil
+	}
+
+	if _, err := exec.LookPath(cfg.CommandPrefix[0]); err != nil {
+		return fmt.Errorf("命令前缀中的 %s 命令不存在: %w", cfg.CommandPrefix[0], err)
+	}
+
+	return nil
+}
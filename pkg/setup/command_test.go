@@ -0,0 +1,531 @@
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 不实际执行命令的 CommandRunner，记录执行的命令，按命令参数返回 respond 的结果
+type fakeRunner struct {
+	mu      sync.Mutex
+	calls   []string
+	respond func(args []string) ([]byte, error)
+}
+
+func (r *fakeRunner) Run(cmd *exec.Cmd) error {
+	output, err := r.CombinedOutput(cmd)
+	if cmd.Stdout != nil {
+		cmd.Stdout.Write(output)
+	}
+	return err
+}
+
+func (r *fakeRunner) Output(cmd *exec.Cmd) ([]byte, error) { return r.CombinedOutput(cmd) }
+
+func (r *fakeRunner) CombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	// 像 docker load 一样读完标准输入
+	if cmd.Stdin != nil {
+		io.Copy(io.Discard, cmd.Stdin)
+	}
+
+	r.mu.Lock()
+	r.calls = append(r.calls, strings.Join(cmd.Args, " "))
+	r.mu.Unlock()
+
+	if r.respond == nil {
+		return nil, nil
+	}
+	return r.respond(cmd.Args)
+}
+
+// 以 prefix 开头的命令
+func (r *fakeRunner) called(prefix string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var calls []string
+	for _, call := range r.calls {
+		if strings.HasPrefix(call, prefix) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// 测试用的配置，不重试、不等待，命令由 runner 执行
+func testConfig(t *testing.T, runner *fakeRunner) *Config {
+	t.Helper()
+
+	cfg := DefaultConfig()
+	cfg.WorkDir = t.TempDir()
+	cfg.ComposeCmd = "docker compose"
+	cfg.MaxRetries = 0
+	cfg.ComposeHealthTimeout = 0
+	cfg.Runner = runner
+	cfg.session = newRunSession()
+	return cfg
+}
+
+// docker load 的输出，其他命令没有输出
+func loadedImages(images ...string) func(args []string) ([]byte, error) {
+	return func(args []string) ([]byte, error) {
+		if slices.Contains(args, "load") {
+			var out strings.Builder
+			for _, image := range images {
+				out.WriteString("Loaded image: " + image + "\n")
+			}
+			return []byte(out.String()), nil
+		}
+		return nil, nil
+	}
+}
+
+// 在工作目录中写入主Stub文件，并在 PATH 中放置只用于依赖检查的 docker 命令，用于通过 Run 测试完整的运行过程
+// 实际执行的命令都由 fakeRunner 模拟
+func writeTestStub(t *testing.T, cfg *Config, entries []testEntry) {
+	t.Helper()
+
+	data, err := os.ReadFile(writeTestTar(t, cfg.StubTarName, entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cfg.WorkDir, cfg.StubTarName), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte("#!/bin/sh\nexit 0\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestLoadImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		respond    func(args []string) ([]byte, error)
+		dryRun     bool
+		want       []string
+		wantErr    bool
+		wantLoaded int
+	}{
+		{
+			name:       "加载成功",
+			respond:    loadedImages("app:1", "db:2"),
+			want:       []string{"app:1", "db:2"},
+			wantLoaded: 1,
+		},
+		{
+			name: "docker load 失败",
+			respond: func(args []string) ([]byte, error) {
+				return []byte("Error response from daemon"), errors.New("exit status 1")
+			},
+			wantErr:    true,
+			wantLoaded: 1,
+		},
+		{
+			name:       "没有加载任何镜像",
+			respond:    loadedImages(),
+			wantErr:    true,
+			wantLoaded: 1,
+		},
+		{
+			name:       "试运行",
+			respond:    loadedImages("app:1"),
+			dryRun:     true,
+			wantLoaded: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{respond: tt.respond}
+			cfg := testConfig(t, runner)
+			cfg.DryRun = tt.dryRun
+
+			filePath := filepath.Join(cfg.WorkDir, "app.tar")
+			if err := os.WriteFile(filePath, []byte("image"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			images, err := loadImage(context.Background(), filePath, subDirManifest{}, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadImage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(images, tt.want) {
+				t.Errorf("loadImage() = %v, want %v", images, tt.want)
+			}
+			if got := len(runner.called("docker load")); got != tt.wantLoaded {
+				t.Errorf("docker load 执行了 %d 次, want %d", got, tt.wantLoaded)
+			}
+		})
+	}
+}
+
+func TestLoadImagePerTaskTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("没有 sleep 命令")
+	}
+
+	// docker load 一直不结束的 docker 命令
+	bin := t.TempDir()
+	script := "#!/bin/sh\nfor a; do [ \"$a\" = load ] && exec sleep 5; done\nexit 0\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cfg := testConfig(t, nil)
+	cfg.Runner = nil
+	cfg.PerTaskTimeout = 50 * time.Millisecond
+	filePath := filepath.Join(cfg.WorkDir, "app.tar")
+	if err := os.WriteFile(filePath, []byte("image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err := loadImage(context.Background(), filePath, subDirManifest{}, cfg)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("loadImage() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !strings.Contains(err.Error(), "docker load "+filePath) {
+		t.Errorf("错误中没有超时的文件: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("超时后 %s 才返回", elapsed)
+	}
+}
+
+func TestStartDockerCompose(t *testing.T) {
+	tests := []struct {
+		name    string
+		ps      string
+		upErr   error
+		dryRun  bool
+		wantErr bool
+		wantPS  bool
+	}{
+		{
+			name:   "服务正常",
+			ps:     `[{"Name":"app-1","Service":"app","State":"running","Health":"healthy"}]`,
+			wantPS: true,
+		},
+		{
+			name:    "compose up 失败",
+			upErr:   errors.New("exit status 1"),
+			wantErr: true,
+		},
+		{
+			name:    "服务不健康",
+			ps:      `[{"Name":"app-1","Service":"app","State":"running","Health":"unhealthy"}]`,
+			wantErr: true,
+			wantPS:  true,
+		},
+		{
+			name:   "试运行",
+			dryRun: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{respond: func(args []string) ([]byte, error) {
+				switch {
+				case slices.Contains(args, "up"):
+					return nil, tt.upErr
+				case slices.Contains(args, "ps"):
+					return []byte(tt.ps), nil
+				}
+				return nil, nil
+			}}
+			cfg := testConfig(t, runner)
+			cfg.DryRun = tt.dryRun
+
+			err := startDockerCompose(context.Background(), cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("startDockerCompose() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := len(runner.called("docker compose up")) > 0; got == tt.dryRun {
+				t.Errorf("compose up 执行 = %v, 试运行 = %v", got, tt.dryRun)
+			}
+			if got := len(runner.called("docker compose ps")) > 0; got != tt.wantPS {
+				t.Errorf("compose ps 执行 = %v, want %v", got, tt.wantPS)
+			}
+		})
+	}
+}
+
+func TestProcessSubDir(t *testing.T) {
+	tests := []struct {
+		name       string
+		only       string
+		filesOnly  bool
+		expected   string
+		wantErr    bool
+		wantLoaded int
+		wantFile   bool
+	}{
+		{name: "解压并加载", wantLoaded: 1, wantFile: true},
+		{name: "只解压", only: opExtract, wantFile: true},
+		{name: "只加载", only: opLoad, wantLoaded: 1},
+		{name: "仅准备文件", filesOnly: true, wantFile: true},
+		{name: "与预期镜像一致", expected: "app:1\n", wantLoaded: 1, wantFile: true},
+		{name: "缺少预期镜像", expected: "app:1\ndb:2\n", wantErr: true, wantLoaded: 1, wantFile: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{respond: loadedImages("app:1")}
+			cfg := testConfig(t, runner)
+			cfg.FilesOnly = tt.filesOnly
+
+			subDirPath := filepath.Join(cfg.WorkDir, "10-app")
+			if err := os.Mkdir(subDirPath, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			files := writeTestTar(t, "files.tar", []testEntry{{Name: "config.yaml", Typeflag: tar.TypeReg, Body: "a: 1"}})
+			data, err := os.ReadFile(files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, body := range map[string][]byte{"files.tar": data, "app.tar": []byte("image")} {
+				if err := os.WriteFile(filepath.Join(subDirPath, name), body, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.expected != "" {
+				if err := os.WriteFile(filepath.Join(subDirPath, expectedImagesName), []byte(tt.expected), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			semaphore := make(chan struct{}, cfg.ConcurrentTasks)
+			err = processSubDir(context.Background(), subDirPath, subDirManifest{}, tt.only, 1, semaphore, nil, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("processSubDir() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := len(runner.called("docker load")); got != tt.wantLoaded {
+				t.Errorf("docker load 执行了 %d 次, want %d", got, tt.wantLoaded)
+			}
+			_, err = os.Stat(filepath.Join(subDirPath, "config.yaml"))
+			if got := err == nil; got != tt.wantFile {
+				t.Errorf("解压了 config.yaml = %v, want %v", got, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestCheckCommandPrefix(t *testing.T) {
+	bin := t.TempDir()
+	for _, name := range []string{"taskset", "sudo"} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin)
+
+	tests := []struct {
+		name    string
+		prefix  []string
+		wantErr bool
+	}{
+		{name: "未配置"},
+		{name: "taskset", prefix: []string{"taskset", "-c", "0-3"}},
+		{name: "sudo", prefix: []string{"sudo", "-u", "deploy"}},
+		{name: "命令不存在", prefix: []string{"nice", "-n", "10"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.CommandPrefix = tt.prefix
+
+			if err := checkCommandPrefix(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("checkCommandPrefix() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 记录同时执行的 docker load 数量和开始、结束顺序的 CommandRunner，镜像文件内容为 bad 时加载失败
+type concurrencyRunner struct {
+	mu      sync.Mutex
+	running int
+	peak    int
+	events  []string
+}
+
+func (r *concurrencyRunner) Run(cmd *exec.Cmd) error {
+	_, err := r.CombinedOutput(cmd)
+	return err
+}
+
+func (r *concurrencyRunner) Output(cmd *exec.Cmd) ([]byte, error) { return r.CombinedOutput(cmd) }
+
+func (r *concurrencyRunner) CombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	if !slices.Contains(cmd.Args, "load") {
+		return nil, nil
+	}
+	body, _ := io.ReadAll(cmd.Stdin)
+
+	r.mu.Lock()
+	r.running++
+	r.peak = max(r.peak, r.running)
+	r.events = append(r.events, "start "+string(body))
+	r.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	r.mu.Lock()
+	r.running--
+	r.events = append(r.events, "end "+string(body))
+	r.mu.Unlock()
+
+	if string(body) == "bad" {
+		return []byte("Error response from daemon"), errors.New("exit status 1")
+	}
+	return []byte("Loaded image: " + string(body) + ":1\n"), nil
+}
+
+func TestProcessImagesConcurrency(t *testing.T) {
+	runner := &concurrencyRunner{}
+	cfg := testConfig(t, nil)
+	cfg.Runner = runner
+
+	// 两个子目录共用容量为 2 的信号量
+	semaphore := make(chan struct{}, 2)
+	dirs := map[string][]string{"10-app": {"a", "b", "bad"}, "10-web": {"c", "d", "bad"}}
+	errs := make(chan error, len(dirs))
+	var wg sync.WaitGroup
+	for dir, bodies := range dirs {
+		subDirPath := filepath.Join(cfg.WorkDir, dir)
+		if err := os.Mkdir(subDirPath, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for i, body := range bodies {
+			name := fmt.Sprintf("%d.tar", i)
+			if err := os.WriteFile(filepath.Join(subDirPath, name), []byte(body), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, name)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := processImages(context.Background(), subDirPath, names, opLoad, subDirManifest{}, semaphore, nil, cfg)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	if runner.peak != 2 {
+		t.Errorf("最多同时加载 %d 个镜像文件, want 2", runner.peak)
+	}
+	// 每个子目录中失败的文件都在汇总的错误中，其他文件不受影响
+	for err := range errs {
+		var list errorList
+		if !errors.As(err, &list) || len(list) != 1 || !strings.HasPrefix(list[0].Error(), "2.tar: ") {
+			t.Errorf("processImages() error = %v, want 只有 2.tar 加载失败", err)
+		}
+	}
+}
+
+func TestProcessStubDirBatchOrder(t *testing.T) {
+	runner := &concurrencyRunner{}
+	cfg := testConfig(t, nil)
+	cfg.Runner = runner
+
+	for _, dir := range []string{"00-base", "10-app", "10-web"} {
+		if err := os.Mkdir(filepath.Join(cfg.WorkDir, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(cfg.WorkDir, dir, "image.tar"), []byte(dir), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := processStubDir(context.Background(), cfg.WorkDir, &manifest{}, "", nil, cfg); err != nil {
+		t.Fatalf("processStubDir() error = %v", err)
+	}
+
+	// 00-base 加载完成后才开始处理 10-app 和 10-web，同一批次并发处理
+	if len(runner.events) != 6 || runner.events[0] != "start 00-base" || runner.events[1] != "end 00-base" {
+		t.Errorf("处理顺序为 %q, want 先处理完 00-base", runner.events)
+	}
+	if runner.peak != 2 {
+		t.Errorf("最多同时加载 %d 个镜像文件, want 10-app 和 10-web 并发加载", runner.peak)
+	}
+}
+
+func TestProcessNestedDirs(t *testing.T) {
+	tests := []struct {
+		maxDepth  int
+		want      []string
+		wantFiles bool
+	}{
+		{maxDepth: 1, want: []string{"app"}},
+		{maxDepth: 2, want: []string{"app", "plugin"}, wantFiles: true},
+		{maxDepth: 3, want: []string{"app", "deep", "plugin"}, wantFiles: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("MaxDepth=%d", tt.maxDepth), func(t *testing.T) {
+			runner := &concurrencyRunner{}
+			cfg := testConfig(t, nil)
+			cfg.Runner = runner
+			cfg.MaxDepth = tt.maxDepth
+
+			subDirPath := filepath.Join(cfg.WorkDir, "10-app")
+			files := map[string]string{
+				"app.tar":               "app",
+				"plugins/plugin.tar":    "plugin",
+				"plugins/files.tar":     readTestTar(t, "files.tar", []testEntry{{Name: "plugin.yaml", Typeflag: tar.TypeReg, Body: "a: 1"}}),
+				"plugins/deep/deep.tar": "deep",
+			}
+			for name, body := range files {
+				p := filepath.Join(subDirPath, name)
+				if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			semaphore := make(chan struct{}, cfg.ConcurrentTasks)
+			if err := processSubDir(context.Background(), subDirPath, subDirManifest{}, "", 1, semaphore, nil, cfg); err != nil {
+				t.Fatalf("processSubDir() error = %v", err)
+			}
+
+			var loaded []string
+			for _, event := range runner.events {
+				if body, ok := strings.CutPrefix(event, "start "); ok {
+					loaded = append(loaded, body)
+				}
+			}
+			slices.Sort(loaded)
+			if !slices.Equal(loaded, tt.want) {
+				t.Errorf("加载了 %q, want %q", loaded, tt.want)
+			}
+			// 下一级目录中的文件压缩包解压到其所在目录
+			_, err := os.Stat(filepath.Join(subDirPath, "plugins", "plugin.yaml"))
+			if got := err == nil; got != tt.wantFiles {
+				t.Errorf("解压了 plugins/plugin.yaml = %v, want %v", got, tt.wantFiles)
+			}
+		})
+	}
+}
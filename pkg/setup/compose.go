@@ -0,0 +1,253 @@
+package setup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// docker-compose v1 独立命令
+const composeV1Cmd = "docker-compose"
+
+// 检测可用的 Compose 命令，优先使用容器运行时的 compose 子命令，例如 docker compose 插件
+// 不可用时使用运行时对应的独立命令，例如 docker-compose、podman-compose
+// 显式指定了 ComposeCmd 时只检查命令是否存在
+func detectComposeCmd(ctx context.Context, cfg *Config) error {
+	if cfg.ComposeCmd != "" {
+		parts := strings.Fields(cfg.ComposeCmd)
+		if len(parts) == 0 {
+			return fmt.Errorf("Compose 命令为空")
+		}
+		if _, err := exec.LookPath(parts[0]); err != nil {
+			return fmt.Errorf("Compose 命令 %s 不存在: %w", parts[0], err)
+		}
+		return nil
+	}
+
+	if err := cfg.runner().Run(command(ctx, cfg, cfg.DockerCmd, "compose", "version")); err == nil {
+		cfg.ComposeCmd = cfg.DockerCmd + " compose"
+		return nil
+	}
+
+	standalone := runtimes[cfg.Runtime].composeStandalone
+	if standalone == "" {
+		return fmt.Errorf("未找到 Compose：%s compose 不可用", cfg.DockerCmd)
+	}
+	if _, err := exec.LookPath(standalone); err == nil {
+		slog.Info("compose 子命令不可用，使用独立的 Compose 命令", "command", cfg.DockerCmd, "compose", standalone)
+		cfg.ComposeCmd = standalone
+		return nil
+	}
+
+	return fmt.Errorf("未找到 Compose：%s compose 和 %s 命令都不可用", cfg.DockerCmd, standalone)
+}
+
+// 判断使用的是否为 docker-compose v1 或 podman-compose 等独立 Compose 命令
+// 这些命令不支持 --pull 和 JSON 格式的状态输出
+func isComposeV1(cfg *Config) bool {
+	parts := strings.Fields(cfg.ComposeCmd)
+	if len(parts) == 0 {
+		return false
+	}
+
+	for _, r := range runtimes {
+		if r.composeStandalone != "" && filepath.Base(parts[0]) == r.composeStandalone {
+			return true
+		}
+	}
+	return false
+}
+
+// Compose 服务的运行状态
+type composeService struct {
+	Name     string `json:"name"`
+	Service  string `json:"service"`
+	State    string `json:"state"`
+	Health   string `json:"health,omitempty"`
+	ExitCode int    `json:"exitCode,omitempty"`
+	Ports    string `json:"ports,omitempty"`
+}
+
+// compose ps --format json 输出中的单个容器
+type composePSEntry struct {
+	Name       string
+	Service    string
+	State      string
+	Health     string
+	ExitCode   int
+	Ports      string
+	Publishers []struct {
+		URL           string
+		TargetPort    int
+		PublishedPort int
+		Protocol      string
+	}
+}
+
+// 解析 compose ps --format json 的输出，兼容 JSON 数组和每行一个对象两种格式
+func parseComposePS(output []byte) ([]composeService, error) {
+	output = bytes.TrimSpace(output)
+
+	var entries []composePSEntry
+	if bytes.HasPrefix(output, []byte("[")) {
+		if err := json.Unmarshal(output, &entries); err != nil {
+			return nil, fmt.Errorf("解析 compose ps 输出失败: %w", err)
+		}
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(output))
+		for {
+			var entry composePSEntry
+			err := dec.Decode(&entry)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("解析 compose ps 输出失败: %w", err)
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	services := make([]composeService, 0, len(entries))
+	for _, entry := range entries {
+		service := composeService{
+			Name:     entry.Name,
+			Service:  entry.Service,
+			State:    entry.State,
+			Health:   entry.Health,
+			ExitCode: entry.ExitCode,
+			Ports:    entry.Ports,
+		}
+
+		// 新版本只输出 Publishers，按 docker ps 的格式拼接端口
+		if service.Ports == "" {
+			var ports []string
+			for _, p := range entry.Publishers {
+				if p.PublishedPort == 0 {
+					ports = append(ports, fmt.Sprintf("%d/%s", p.TargetPort, p.Protocol))
+					continue
+				}
+				ports = append(ports, fmt.Sprintf("%s:%d->%d/%s", p.URL, p.PublishedPort, p.TargetPort, p.Protocol))
+			}
+			service.Ports = strings.Join(ports, ", ")
+		}
+
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+// 轮询 Compose 服务状态的间隔
+const composeHealthInterval = 2 * time.Second
+
+// 判断服务是否已就绪：运行中且健康检查通过或没有健康检查，或者是正常退出的一次性服务
+// failed 表示服务已失败，无需继续等待
+func composeServiceReady(s composeService) (ready, failed bool) {
+	switch {
+	case s.Health == "unhealthy":
+		return false, true
+	case s.State == "exited" || s.State == "dead":
+		return s.State == "exited" && s.ExitCode == 0, s.State == "dead" || s.ExitCode != 0
+	case s.State == "running":
+		return s.Health == "" || s.Health == "healthy", false
+	}
+	return false, false
+}
+
+// 查询所有 Compose 服务的状态，包括已退出的容器
+func composeStatus(ctx context.Context, cfg *Config) ([]composeService, error) {
+	output, err := cfg.runner().Output(composeCommand(ctx, cfg, "ps", "--all", "--format", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("%s ps 命令失败: %w", cfg.ComposeCmd, err)
+	}
+
+	return parseComposePS(output)
+}
+
+// 等待所有 Compose 服务运行且健康检查通过，最长等待 ComposeHealthTimeout，为 0 时只检查一次
+// 有服务失败或超时时输出未就绪服务的最后几行日志
+func waitComposeHealthy(ctx context.Context, cfg *Config) ([]composeService, error) {
+	deadline := time.Now().Add(cfg.ComposeHealthTimeout)
+	for attempt := 1; ; attempt++ {
+		services, err := composeStatus(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		var pending, failed []composeService
+		for _, s := range services {
+			ready, bad := composeServiceReady(s)
+			switch {
+			case bad:
+				failed = append(failed, s)
+			case !ready:
+				pending = append(pending, s)
+			}
+		}
+
+		if len(failed) == 0 && len(pending) == 0 {
+			return services, nil
+		}
+		if len(failed) == 0 && time.Now().Before(deadline) {
+			slog.Debug("等待 Compose 服务就绪", "attempt", attempt, "pending", composeServiceNames(pending))
+			if err := sleepContext(ctx, composeHealthInterval); err != nil {
+				return services, err
+			}
+			continue
+		}
+
+		notReady := append(failed, pending...)
+		desc := make([]string, 0, len(notReady))
+		for _, s := range notReady {
+			slog.Error("Compose 服务未就绪", "service", s.Service, "state", s.State, "health", s.Health, "exitCode", s.ExitCode, "logs", composeLogs(ctx, s.Service, cfg))
+			desc = append(desc, fmt.Sprintf("%s(%s)", s.Service, composeServiceState(s)))
+		}
+		if len(failed) == 0 {
+			return services, fmt.Errorf("等待 Compose 服务就绪超时: %s", strings.Join(desc, ", "))
+		}
+		return services, fmt.Errorf("Compose 服务启动失败: %s", strings.Join(desc, ", "))
+	}
+}
+
+// 服务状态的简短描述，例如 running/unhealthy、exited 1
+func composeServiceState(s composeService) string {
+	switch {
+	case s.Health != "":
+		return s.State + "/" + s.Health
+	case s.State == "exited":
+		return fmt.Sprintf("exited %d", s.ExitCode)
+	}
+	return s.State
+}
+
+// 服务名列表
+func composeServiceNames(services []composeService) []string {
+	names := make([]string, 0, len(services))
+	for _, s := range services {
+		names = append(names, s.Service)
+	}
+	return names
+}
+
+// 服务最后 ComposeLogLines 行日志，获取失败时返回错误信息
+func composeLogs(ctx context.Context, service string, cfg *Config) string {
+	if cfg.ComposeLogLines <= 0 {
+		return ""
+	}
+
+	output, err := cfg.runner().CombinedOutput(composeCommand(ctx, cfg, "logs", "--no-color", "--tail", strconv.Itoa(cfg.ComposeLogLines), service))
+	if err != nil {
+		return fmt.Sprintf("获取日志失败: %v", err)
+	}
+	return cfg.session.redactor.redact(strings.TrimSpace(string(output)))
+}
@@ -0,0 +1,58 @@
+package setup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectComposeCmd(t *testing.T) {
+	const (
+		plugin   = "#!/bin/sh\nexit 0\n"
+		noPlugin = "#!/bin/sh\n[ \"$1\" = compose ] && exit 1\nexit 0\n"
+	)
+
+	tests := []struct {
+		name       string
+		docker     string
+		standalone bool
+		composeCmd string
+		want       string
+		wantErr    bool
+	}{
+		{name: "compose 插件", docker: plugin, standalone: true, want: "docker compose"},
+		{name: "回退到 docker-compose", docker: noPlugin, standalone: true, want: composeV1Cmd},
+		{name: "未安装 Compose", docker: noPlugin, wantErr: true},
+		{name: "指定的 Compose 命令", docker: noPlugin, standalone: true, composeCmd: composeV1Cmd, want: composeV1Cmd},
+		{name: "指定的 Compose 命令不存在", docker: plugin, composeCmd: composeV1Cmd, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin := t.TempDir()
+			files := map[string]string{"docker": tt.docker}
+			if tt.standalone {
+				files[composeV1Cmd] = plugin
+			}
+			for name, script := range files {
+				if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Setenv("PATH", bin)
+
+			cfg := DefaultConfig()
+			cfg.Runtime = runtimeDocker
+			cfg.ComposeCmd = tt.composeCmd
+
+			err := detectComposeCmd(context.Background(), cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("detectComposeCmd() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.ComposeCmd != tt.want {
+				t.Errorf("ComposeCmd = %q, want %q", cfg.ComposeCmd, tt.want)
+			}
+		})
+	}
+}
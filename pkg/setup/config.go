@@ -0,0 +1,317 @@
+package setup
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// 未通过 -config 指定时依次尝试读取的配置文件
+var defaultConfigFiles = []string{"setup.yaml", "setup.toml"}
+
+// 覆盖配置项的环境变量前缀，例如 SETUP_MINIO_ENDPOINT 覆盖 minioEndpoint
+const envPrefix = "SETUP_"
+
+// 从命令行参数中找出 -config 指定的配置文件，未指定时返回默认配置文件
+// -config 可以在 install、verify、clean 和 status 子命令之前或之后，按 RegisterFlags 注册的参数判断哪些参数带值
+func configPathFromArgs(args []string) (path string, explicit bool) {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	RegisterFlags(fs, DefaultConfig())
+
+	subcommand := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			// 子命令之后的参数同样可能指定 -config，其他位置参数之后不再是参数
+			if !subcommand && (arg == cmdInstall || arg == cmdVerify || arg == cmdClean || arg == cmdStatus) {
+				subcommand = true
+				continue
+			}
+			break
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name == "config" {
+			if hasValue {
+				return value, true
+			}
+			if i+1 < len(args) {
+				return args[i+1], true
+			}
+			break
+		}
+
+		// 不带 = 的非布尔参数的值是下一个参数
+		if f := fs.Lookup(name); f != nil && !hasValue && !isBoolFlag(f) {
+			i++
+		}
+	}
+
+	for _, name := range defaultConfigFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name, false
+		}
+	}
+	return defaultConfigFiles[0], false
+}
+
+// 参数是否为布尔参数，布尔参数不带值时不读取下一个参数
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// 读取 YAML、JSON 或 TOML(.toml) 格式的配置文件，覆盖 cfg 中对应的值，未知的配置项会报错
+func loadConfigFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("打开配置文件失败: %w", err)
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		md, err := toml.NewDecoder(f).Decode(cfg)
+		if err != nil {
+			return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("解析配置文件 %s 失败: 未知的配置项 %s", path, undecoded[0])
+		}
+		return nil
+	}
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+
+	return nil
+}
+
+// 按 默认值 < 配置文件 < 环境变量 的顺序加载配置，显式指定的配置文件不存在时报错
+func LoadConfig(args []string) (*Config, string, error) {
+	cfg := DefaultConfig()
+
+	path, explicit := configPathFromArgs(args)
+	if _, err := os.Stat(path); explicit || !os.IsNotExist(err) {
+		if err := loadConfigFile(path, cfg); err != nil {
+			return nil, path, err
+		}
+	}
+
+	if err := applyEnvOverrides(reflect.ValueOf(cfg).Elem(), envPrefix); err != nil {
+		return nil, path, err
+	}
+
+	return cfg, path, nil
+}
+
+// 将配置项名转换为环境变量名，例如 minioEndpoint 转换为 MINIO_ENDPOINT
+func envName(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := rune(key[i-1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+
+	return b.String()
+}
+
+// 用 SETUP_ 开头的环境变量覆盖配置项，嵌套的配置项以 _ 连接，例如 SETUP_RELAY_REGISTRY
+// 支持字符串、布尔、整数、浮点数和时长，字符串列表以逗号分隔
+func applyEnvOverrides(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if !field.IsExported() || key == "" || key == "-" {
+			continue
+		}
+
+		name := prefix + envName(key)
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			if err := applyEnvOverrides(fv, name+"_"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(fv, value); err != nil {
+			return fmt.Errorf("环境变量 %s 的值 %q 无效: %w", name, value, err)
+		}
+	}
+
+	return nil
+}
+
+// 按字段类型解析环境变量的值
+func setEnvValue(v reflect.Value, value string) error {
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Int:
+		var items []int
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			n, err := strconv.Atoi(item)
+			if err != nil {
+				return err
+			}
+			items = append(items, n)
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("不支持通过环境变量设置 %s 类型的配置项", v.Type())
+	}
+
+	return nil
+}
+
+// 展开配置中所有字符串字段引用的环境变量，例如 ${MINIO_SECRET_KEY}，见 expandEnvRefs
+// 引用的环境变量未设置时报错，避免密钥等配置被展开为空字符串
+func expandConfigEnv(cfg *Config) error {
+	return expandEnvValue(reflect.ValueOf(cfg).Elem(), "")
+}
+
+// 展开字符串中的 ${VAR}，返回展开后的字符串和未设置的环境变量
+// $$ 表示字面的 $，其他 $ 原样保留，例如密码中的 $ 和钩子命令中由 shell 展开的 $VAR
+func expandEnvRefs(s string) (string, []string) {
+	var b strings.Builder
+	var missing []string
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 || !isEnvName(s[i+2:i+2+end]) {
+				b.WriteByte('$')
+				continue
+			}
+			key := s[i+2 : i+2+end]
+			value, ok := os.LookupEnv(key)
+			if !ok {
+				missing = append(missing, key)
+			}
+			b.WriteString(value)
+			i += end + 2
+		default:
+			b.WriteByte('$')
+		}
+	}
+
+	return b.String(), missing
+}
+
+// 是否为有效的环境变量名：字母、数字和下划线，不以数字开头
+func isEnvName(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for _, r := range s {
+		if r != '_' && (r < '0' || r > '9') && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// 递归展开结构体、切片和字符串中的环境变量，name 为字段路径，用于错误信息
+func expandEnvValue(v reflect.Value, name string) error {
+	switch v.Kind() {
+	case reflect.String:
+		expanded, missing := expandEnvRefs(v.String())
+		if len(missing) > 0 {
+			return fmt.Errorf("配置项 %s 引用的环境变量未设置: %s", name, strings.Join(missing, ", "))
+		}
+		v.SetString(expanded)
+	case reflect.Struct:
+		var errs []error
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() || field.Tag.Get("yaml") == "-" {
+				continue
+			}
+			fieldName := field.Name
+			if name != "" {
+				fieldName = name + "." + field.Name
+			}
+			errs = append(errs, expandEnvValue(v.Field(i), fieldName))
+		}
+		return errors.Join(errs...)
+	case reflect.Slice:
+		var errs []error
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, expandEnvValue(v.Index(i), fmt.Sprintf("%s[%d]", name, i)))
+		}
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
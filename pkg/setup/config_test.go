@@ -0,0 +1,169 @@
+package setup
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigPathFromArgs(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		want         string
+		wantExplicit bool
+	}{
+		{name: "未指定", args: nil, want: "setup.yaml"},
+		{name: "-config 带值", args: []string{"-config", "prod.yaml"}, want: "prod.yaml", wantExplicit: true},
+		{name: "-config=", args: []string{"--config=prod.yaml"}, want: "prod.yaml", wantExplicit: true},
+		{name: "之前有带值的参数", args: []string{"-timeout", "10m", "-config", "prod.yaml"}, want: "prod.yaml", wantExplicit: true},
+		{name: "之前有布尔参数", args: []string{"-dry-run", "-config", "prod.yaml"}, want: "prod.yaml", wantExplicit: true},
+		{name: "之前有 = 形式的参数", args: []string{"-timeout=10m", "-config", "prod.yaml"}, want: "prod.yaml", wantExplicit: true},
+		{name: "子命令之后", args: []string{"install", "-config", "prod.yaml"}, want: "prod.yaml", wantExplicit: true},
+		{name: "子命令前后都有参数", args: []string{"-timeout", "10m", "verify", "-resume=false", "-config", "prod.yaml"}, want: "prod.yaml", wantExplicit: true},
+		{name: "STUB 文件之后", args: []string{"stub.tar", "-config", "prod.yaml"}, want: "setup.yaml"},
+		{name: "-- 之后", args: []string{"--", "-config", "prod.yaml"}, want: "setup.yaml"},
+		{name: "使用各自参数的子命令", args: []string{"diff", "-config", "prod.yaml"}, want: "setup.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, explicit := configPathFromArgs(tt.args)
+			if got != tt.want || explicit != tt.wantExplicit {
+				t.Errorf("configPathFromArgs(%q) = %q, %v, want %q, %v", tt.args, got, explicit, tt.want, tt.wantExplicit)
+			}
+		})
+	}
+}
+
+func TestLoadConfigAfterValueFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prod.yaml")
+	if err := os.WriteFile(path, []byte("maxRetries: 7\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, got, err := LoadConfig([]string{"-timeout", "10m", "-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != path || cfg.MaxRetries != 7 {
+		t.Errorf("LoadConfig() 读取了 %s, MaxRetries = %d, want %s, 7", got, cfg.MaxRetries, path)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prod.yaml")
+	if err := os.WriteFile(path, []byte("maxRetries: 7\nminioAlias: file\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 默认值 < 配置文件 < 命令行参数
+	args := []string{"-config", path, "-max-retries", "9"}
+	cfg, _, err := LoadConfig(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("setup", flag.ContinueOnError)
+	fs.String("config", "", "")
+	RegisterFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := DefaultConfig()
+	if cfg.MaxRetries != 9 || cfg.MinioAlias != "file" || cfg.MinioContainer != defaults.MinioContainer {
+		t.Errorf("MaxRetries = %d, MinioAlias = %q, MinioContainer = %q, want 9, file, %q", cfg.MaxRetries, cfg.MinioAlias, cfg.MinioContainer, defaults.MinioContainer)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		args    []string
+		wantErr bool
+	}{
+		{name: "YAML 中的未知配置项", file: "bad.yaml", content: "maxRetries: 1\nmaxRetry: 2\n", wantErr: true},
+		{name: "JSON 中的未知配置项", file: "bad.json", content: `{"maxRetries": 1, "maxRetry": 2}`, wantErr: true},
+		{name: "JSON 配置文件", file: "ok.json", content: `{"maxRetries": 1}`},
+		{name: "指定的配置文件不存在", args: []string{"-config", "missing.yaml"}, wantErr: true},
+		{name: "默认配置文件不存在"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				if err := os.WriteFile(filepath.Join(dir, tt.file), []byte(tt.content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				args = []string{"-config", tt.file}
+			}
+
+			_, _, err := LoadConfig(args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig(%q) error = %v, wantErr %v", args, err, tt.wantErr)
+			}
+			if err != nil && tt.file != "" && !strings.Contains(err.Error(), "maxRetry") {
+				t.Errorf("错误中没有未知的配置项: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseSubcommandFlagsConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	args := parseSubcommandFlags(cmdInstall, []string{"-config", "prod.yaml", "-timeout", "5m", "stub.tar"}, cfg)
+
+	if !slices.Equal(args, []string{"stub.tar"}) {
+		t.Errorf("parseSubcommandFlags() = %q, want [stub.tar]", args)
+	}
+	if cfg.Timeout != 5*time.Minute {
+		t.Errorf("Timeout = %s, want 5m", cfg.Timeout)
+	}
+}
+
+func TestExpandConfigEnv(t *testing.T) {
+	t.Setenv("SETUP_TEST_SECRET", "s3cret")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "引用环境变量", value: "${SETUP_TEST_SECRET}", want: "s3cret"},
+		{name: "前后有其他字符", value: "pre-${SETUP_TEST_SECRET}-post", want: "pre-s3cret-post"},
+		{name: "字面的 $", value: "pa$word", want: "pa$word"},
+		{name: "末尾的 $", value: "price$", want: "price$"},
+		{name: "$$ 转义", value: "$${SETUP_TEST_SECRET}", want: "${SETUP_TEST_SECRET}"},
+		{name: "不展开 $VAR", value: "echo $HOME", want: "echo $HOME"},
+		{name: "无效的变量名", value: "${1x} ${} ${a-b}", want: "${1x} ${} ${a-b}"},
+		{name: "没有右括号", value: "${SETUP_TEST_SECRET", want: "${SETUP_TEST_SECRET"},
+		{name: "环境变量未设置", value: "${SETUP_TEST_UNSET}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.MinioSecretKey = tt.value
+
+			err := expandConfigEnv(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandConfigEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && cfg.MinioSecretKey != tt.want {
+				t.Errorf("MinioSecretKey = %q, want %q", cfg.MinioSecretKey, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package setup
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Stub 文件内容概要
+type stubSummary struct {
+	// 条目名到校验和
+	Files map[string]string
+	// 镜像引用到所在镜像文件的校验和
+	Images map[string]string
+	// 镜像文件名到其中的镜像引用
+	Tags map[string][]string
+	// 镜像文件名到其中镜像的架构，没有标签的镜像以配置文件名代替
+	Arches map[string]map[string]string
+	// 根目录中较小的普通文件的内容，例如清单文件和 Compose 文件
+	Root map[string][]byte
+	// 解压 Stub 文件及其中的文件压缩包所需的空间
+	Size uint64
+}
+
+// Stub 根目录中读取内容的文件的最大大小
+const maxStubRootFileSize = 1 << 20
+
+// 两个 Stub 之间的差异
+type stubDiff struct {
+	FilesAdded    []string `json:"filesAdded"`
+	FilesRemoved  []string `json:"filesRemoved"`
+	FilesModified []string `json:"filesModified"`
+	ImagesAdded   []string `json:"imagesAdded"`
+	ImagesRemoved []string `json:"imagesRemoved"`
+	ImagesChanged []string `json:"imagesChanged"`
+}
+
+// 读取一遍 Stub 文件，计算每个条目的校验和，解析其中镜像文件的 RepoTags 和架构，并统计解压所需的空间
+func summarizeStub(stubTar string) (*stubSummary, error) {
+	f, err := os.Open(stubTar)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	summary := &stubSummary{
+		Files:  make(map[string]string),
+		Images: make(map[string]string),
+		Tags:   make(map[string][]string),
+		Arches: make(map[string]map[string]string),
+		Root:   make(map[string][]byte),
+	}
+
+	stub, err := archiveReader(f, stubTar)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := tar.NewReader(stub)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取 %s 失败: %w", stubTar, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := strings.TrimPrefix(path.Clean(hdr.Name), "./")
+		h := sha256.New()
+		r := io.TeeReader(tr, h)
+		summary.Size += uint64(hdr.Size)
+
+		// 在计算校验和的同时读取镜像文件的 RepoTags 和架构、文件压缩包解压后的大小以及根目录中较小的文件
+		var tags []string
+		op, ok := classifyArchive(path.Base(name))
+		switch {
+		case ok && op == opLoad:
+			image, err := archiveReader(r, name)
+			if err == nil {
+				var arches map[string]string
+				if tags, arches, err = imageArchesFromTar(image); err == nil {
+					summary.Arches[name] = arches
+				}
+			}
+			if err != nil {
+				slog.Warn("无法读取镜像文件中的镜像", "file", name, "error", err)
+			}
+		case ok && op == opExtract:
+			archive, err := archiveReader(r, name)
+			if err != nil {
+				return nil, fmt.Errorf("读取 %s 中的 %s 失败: %w", stubTar, name, err)
+			}
+			size, err := tarReaderContentSize(archive)
+			if err != nil {
+				return nil, fmt.Errorf("读取 %s 中的 %s 失败: %w", stubTar, name, err)
+			}
+			summary.Size += size
+		case !ok && !strings.Contains(name, "/") && hdr.Size <= maxStubRootFileSize:
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return nil, fmt.Errorf("读取 %s 中的 %s 失败: %w", stubTar, name, err)
+			}
+			summary.Root[name] = data
+		}
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return nil, fmt.Errorf("读取 %s 中的 %s 失败: %w", stubTar, name, err)
+		}
+
+		sum := hex.EncodeToString(h.Sum(nil))
+		summary.Files[name] = sum
+		for _, tag := range tags {
+			summary.Images[tag] = sum
+		}
+		if len(tags) > 0 {
+			summary.Tags[name] = tags
+		}
+	}
+
+	return summary, nil
+}
+
+// 比较两组名称到校验和的映射
+func diffSums(from, to map[string]string) (added, removed, changed []string) {
+	added, removed, changed = []string{}, []string{}, []string{}
+	for name, sum := range to {
+		fromSum, ok := from[name]
+		switch {
+		case !ok:
+			added = append(added, name)
+		case fromSum != sum:
+			changed = append(changed, name)
+		}
+	}
+	for name := range from {
+		if _, ok := to[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// 比较两个 Stub 的概要
+func diffStubs(from, to *stubSummary) *stubDiff {
+	d := &stubDiff{}
+	d.FilesAdded, d.FilesRemoved, d.FilesModified = diffSums(from.Files, to.Files)
+	d.ImagesAdded, d.ImagesRemoved, d.ImagesChanged = diffSums(from.Images, to.Images)
+
+	return d
+}
+
+// 以便于阅读的格式输出差异
+func writeDiffText(w io.Writer, d *stubDiff) {
+	sections := []struct {
+		title string
+		mark  string
+		items []string
+	}{
+		{"镜像", "+", d.ImagesAdded},
+		{"镜像", "-", d.ImagesRemoved},
+		{"镜像", "~", d.ImagesChanged},
+		{"文件", "+", d.FilesAdded},
+		{"文件", "-", d.FilesRemoved},
+		{"文件", "~", d.FilesModified},
+	}
+
+	empty := true
+	for _, section := range sections {
+		for _, item := range section.items {
+			fmt.Fprintf(w, "%s %s %s\n", section.mark, section.title, item)
+			empty = false
+		}
+	}
+
+	if empty {
+		fmt.Fprintln(w, "两个 Stub 没有差异")
+	}
+}
+
+// diff 子命令：比较两个 Stub 文件，不修改主机
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "以 JSON 格式输出差异")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: setup diff [-json] old.tar new.tar")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("diff 需要两个 Stub 文件")
+	}
+
+	from, err := summarizeStub(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	to, err := summarizeStub(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	d := diffStubs(from, to)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+
+	writeDiffText(os.Stdout, d)
+	return nil
+}
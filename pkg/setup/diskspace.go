@@ -0,0 +1,90 @@
+package setup
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// 统计 tar 文件中普通文件的总大小，作为解压所需的空间
+func tarContentSize(tarPath string) (uint64, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r, err := archiveReader(f, tarPath)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := tarReaderContentSize(r)
+	if err != nil {
+		return 0, fmt.Errorf("读取 %s 失败: %w", tarPath, err)
+	}
+	return size, nil
+}
+
+// 统计 tar 数据流中普通文件的总大小
+func tarReaderContentSize(r io.Reader) (uint64, error) {
+	var total uint64
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return total, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			total += uint64(hdr.Size)
+		}
+	}
+}
+
+// 解压前检查目标文件系统的剩余空间能否容纳解压后的文件，并额外保留 MinFreeBytes
+func checkDiskSpace(tarPath, targetDir string, cfg *Config) error {
+	if cfg.SkipDiskCheck {
+		return nil
+	}
+
+	size, err := tarContentSize(tarPath)
+	if err != nil {
+		return err
+	}
+	return checkFreeSpace(size, targetDir, cfg)
+}
+
+// 获取目标文件系统的剩余空间，不支持的平台返回 false
+var queryFreeBytes = freeBytes
+
+// 检查目标文件系统的剩余空间能否容纳 size 字节，并额外保留 MinFreeBytes
+func checkFreeSpace(size uint64, targetDir string, cfg *Config) error {
+	if cfg.SkipDiskCheck {
+		return nil
+	}
+
+	required := size + uint64(max(cfg.MinFreeBytes, 0))
+
+	free, ok, err := queryFreeBytes(targetDir)
+	if !ok {
+		slog.Warn("当前平台无法获取剩余磁盘空间，跳过检查")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("获取剩余磁盘空间失败: %w", err)
+	}
+
+	if free < required {
+		return fmt.Errorf("磁盘空间不足: %s 需要 %s (%d 字节)，可用 %s (%d 字节)",
+			targetDir, formatBytes(int64(required)), required, formatBytes(int64(free)), free)
+	}
+
+	slog.Debug("磁盘空间充足", "targetDir", targetDir, "required", formatBytes(int64(required)), "free", formatBytes(int64(free)))
+	return nil
+}
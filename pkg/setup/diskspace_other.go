@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package setup
+
+// 当前平台不检查剩余磁盘空间
+func freeBytes(path string) (uint64, bool, error) {
+	return 0, false, nil
+}
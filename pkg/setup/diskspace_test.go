@@ -0,0 +1,51 @@
+package setup
+
+import (
+	"archive/tar"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckDiskSpace(t *testing.T) {
+	tarPath := writeTestTar(t, "files.tar", []testEntry{
+		{Name: "data/", Typeflag: tar.TypeDir},
+		{Name: "data/a.bin", Typeflag: tar.TypeReg, Body: strings.Repeat("a", 60)},
+		{Name: "data/b.bin", Typeflag: tar.TypeReg, Body: strings.Repeat("b", 40)},
+	})
+
+	tests := []struct {
+		name     string
+		free     uint64
+		noQuery  bool
+		queryErr error
+		minFree  int64
+		skip     bool
+		wantErr  string
+	}{
+		{name: "空间充足", free: 1000},
+		{name: "磁盘已满", free: 50, wantErr: "磁盘空间不足"},
+		{name: "刚好容纳", free: 100},
+		{name: "需要额外保留空间", free: 1000, minFree: 950, wantErr: "磁盘空间不足"},
+		{name: "跳过检查", free: 0, skip: true},
+		{name: "当前平台不支持", noQuery: true},
+		{name: "查询失败", queryErr: errors.New("statfs: permission denied"), wantErr: "获取剩余磁盘空间失败"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := queryFreeBytes
+			queryFreeBytes = func(path string) (uint64, bool, error) { return tt.free, !tt.noQuery, tt.queryErr }
+			t.Cleanup(func() { queryFreeBytes = orig })
+
+			cfg := DefaultConfig()
+			cfg.MinFreeBytes = tt.minFree
+			cfg.SkipDiskCheck = tt.skip
+
+			err := checkDiskSpace(tarPath, t.TempDir(), cfg)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("checkDiskSpace() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package setup
+
+import "syscall"
+
+// 获取路径所在文件系统中非特权用户可用的剩余空间
+func freeBytes(path string) (uint64, bool, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, true, err
+	}
+
+	return uint64(st.Bavail) * uint64(st.Bsize), true, nil
+}
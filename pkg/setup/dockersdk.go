@@ -0,0 +1,167 @@
+package setup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// 通过 Docker SDK 调用守护进程所需的客户端接口
+type dockerClient interface {
+	ImageLoad(ctx context.Context, input io.Reader, opts ...client.ImageLoadOption) (image.LoadResponse, error)
+	ImageInspect(ctx context.Context, imageID string, opts ...client.ImageInspectOption) (image.InspectResponse, error)
+	ImageRemove(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error)
+	ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error)
+	ServerVersion(ctx context.Context) (types.Version, error)
+	Close() error
+}
+
+// 创建 Docker SDK 客户端，连接地址取自 DOCKER_HOST 等环境变量
+var newDockerClient = func() (dockerClient, error) {
+	return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+}
+
+// 创建子目录使用的 Docker SDK 客户端，SDK 模式不支持 Docker 上下文
+func sdkClient(sub subDirManifest) (dockerClient, error) {
+	if sub.DockerContext != "" {
+		return nil, fmt.Errorf("Docker SDK 模式不支持 Docker 上下文 %s，请通过 DOCKER_HOST 指定守护进程", sub.DockerContext)
+	}
+
+	cli, err := newDockerClient()
+	if err != nil {
+		return nil, fmt.Errorf("创建 Docker 客户端失败: %w", err)
+	}
+	return cli, nil
+}
+
+// 检查 Docker 守护进程是否可以连接，并按 MinDockerVersion 检查守护进程版本
+func checkDockerDaemon(ctx context.Context, cfg *Config) error {
+	cli, err := sdkClient(subDirManifest{})
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	v, err := cli.ServerVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("连接 Docker 守护进程失败: %w", err)
+	}
+	slog.Debug("Docker 守护进程版本", "version", v.Version, "apiVersion", v.APIVersion)
+
+	if cfg.MinDockerVersion == "" {
+		return nil
+	}
+	want, ok := parseVersion(cfg.MinDockerVersion)
+	if !ok {
+		return fmt.Errorf("docker 的最低版本 %s 格式错误", cfg.MinDockerVersion)
+	}
+	got, ok := parseVersion(v.Version)
+	if !ok {
+		slog.Warn("无法识别 Docker 守护进程版本，跳过版本检查", "version", v.Version)
+		return nil
+	}
+	if compareVersions(got, want) < 0 {
+		return fmt.Errorf("Docker 守护进程版本过低: %s，至少需要 %s", v.Version, cfg.MinDockerVersion)
+	}
+
+	return nil
+}
+
+// 通过 Docker SDK 查询镜像信息
+func inspectImageSDK(ctx context.Context, ref string, sub subDirManifest) (image.InspectResponse, error) {
+	cli, err := sdkClient(sub)
+	if err != nil {
+		return image.InspectResponse{}, err
+	}
+	defer cli.Close()
+
+	return cli.ImageInspect(ctx, ref)
+}
+
+// 通过 Docker SDK 删除镜像标签
+func removeImageSDK(ctx context.Context, ref string, sub subDirManifest) error {
+	cli, err := sdkClient(sub)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	_, err = cli.ImageRemove(ctx, ref, image.RemoveOptions{})
+	return err
+}
+
+// 通过 Docker SDK 列出本地镜像标签及其指向的镜像 ID
+func listImageTagsSDK(ctx context.Context, sub subDirManifest) (map[string]string, error) {
+	cli, err := sdkClient(sub)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	images, err := cli.ImageList(ctx, image.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("列出本地镜像失败: %w", err)
+	}
+
+	tags := make(map[string]string)
+	for _, img := range images {
+		for _, tag := range img.RepoTags {
+			if tag != "<none>:<none>" {
+				tags[tag] = img.ID
+			}
+		}
+	}
+	return tags, nil
+}
+
+// 通过 Docker SDK 直接调用守护进程加载镜像 tar 数据流，返回与 docker load 相同格式的输出
+func loadImageSDK(ctx context.Context, r io.Reader, filePath string, sub subDirManifest) ([]byte, error) {
+	cli, err := sdkClient(sub)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	resp, err := cli.ImageLoad(ctx, r, client.ImageLoadWithQuiet(false))
+	if err != nil {
+		return nil, fmt.Errorf("docker 加载镜像失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return readLoadMessages(resp.Body, filePath)
+}
+
+// 读取镜像加载的 JSON 消息流，记录进度并收集输出，遇到错误消息时返回错误
+func readLoadMessages(r io.Reader, filePath string) ([]byte, error) {
+	var output strings.Builder
+	dec := json.NewDecoder(r)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return []byte(output.String()), fmt.Errorf("解析 docker 加载输出失败: %w", err)
+		}
+
+		if msg.Error != nil {
+			return []byte(output.String() + msg.Error.Message), fmt.Errorf("docker 加载镜像失败: %w", msg.Error)
+		}
+		if msg.Stream != "" {
+			output.WriteString(msg.Stream)
+		}
+		if msg.Progress != nil && msg.Progress.Total > 0 {
+			slog.Debug("正在加载镜像", "file", filePath, "status", msg.Status, "id", msg.ID, "progress", formatBytes(msg.Progress.Current)+"/"+formatBytes(msg.Progress.Total))
+		}
+	}
+
+	return []byte(output.String()), nil
+}
@@ -0,0 +1,139 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// 模拟 Docker 守护进程，ImageLoad 读完输入后返回 load 中的消息流
+type fakeDockerClient struct {
+	load    string
+	loadErr error
+	loaded  string
+}
+
+func (c *fakeDockerClient) ImageLoad(ctx context.Context, input io.Reader, opts ...client.ImageLoadOption) (image.LoadResponse, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return image.LoadResponse{}, err
+	}
+	c.loaded = string(data)
+	if c.loadErr != nil {
+		return image.LoadResponse{}, c.loadErr
+	}
+	return image.LoadResponse{Body: io.NopCloser(strings.NewReader(c.load)), JSON: true}, nil
+}
+
+func (c *fakeDockerClient) ImageInspect(ctx context.Context, imageID string, opts ...client.ImageInspectOption) (image.InspectResponse, error) {
+	return image.InspectResponse{}, errors.New("No such image: " + imageID)
+}
+
+func (c *fakeDockerClient) ImageRemove(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error) {
+	return nil, nil
+}
+
+func (c *fakeDockerClient) ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error) {
+	return nil, nil
+}
+
+func (c *fakeDockerClient) ServerVersion(ctx context.Context) (types.Version, error) {
+	return types.Version{Version: "24.0.7"}, nil
+}
+
+func (c *fakeDockerClient) Close() error { return nil }
+
+// 测试期间使用 cli 作为 Docker SDK 客户端
+func useFakeDockerClient(t *testing.T, cli *fakeDockerClient) {
+	t.Helper()
+
+	orig := newDockerClient
+	newDockerClient = func() (dockerClient, error) { return cli, nil }
+	t.Cleanup(func() { newDockerClient = orig })
+}
+
+func TestReadLoadMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "加载成功",
+			stream: `{"status":"Loading layer","progressDetail":{"current":512,"total":1024},"id":"abc"}` + "\n" + `{"stream":"Loaded image: app:1\n"}` + "\n" + `{"stream":"Loaded image: db:2\n"}`,
+			want:   "Loaded image: app:1\nLoaded image: db:2\n",
+		},
+		{
+			name:    "错误消息",
+			stream:  `{"stream":"Loaded image: app:1\n"}` + "\n" + `{"errorDetail":{"message":"unexpected EOF"},"error":"unexpected EOF"}`,
+			want:    "Loaded image: app:1\nunexpected EOF",
+			wantErr: "unexpected EOF",
+		},
+		{
+			name:    "输出被截断",
+			stream:  `{"stream":"Loaded image: app:1\n"}` + "\n" + `{"stream":"Loa`,
+			want:    "Loaded image: app:1\n",
+			wantErr: "解析 docker 加载输出失败",
+		},
+		{name: "没有输出"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := readLoadMessages(strings.NewReader(tt.stream), "app.tar")
+			if string(output) != tt.want {
+				t.Errorf("readLoadMessages() = %q, want %q", output, tt.want)
+			}
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("readLoadMessages() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadImageSDK(t *testing.T) {
+	tests := []struct {
+		name    string
+		cli     *fakeDockerClient
+		sub     subDirManifest
+		want    []string
+		wantErr bool
+	}{
+		{name: "加载成功", cli: &fakeDockerClient{load: `{"stream":"Loaded image: app:1\n"}`}, want: []string{"app:1"}},
+		{name: "守护进程返回错误", cli: &fakeDockerClient{loadErr: errors.New("Cannot connect to the Docker daemon")}, wantErr: true},
+		{name: "加载过程中出错", cli: &fakeDockerClient{load: `{"error":"invalid tar header","errorDetail":{"message":"invalid tar header"}}`}, wantErr: true},
+		{name: "不支持 Docker 上下文", cli: &fakeDockerClient{}, sub: subDirManifest{DockerContext: "remote"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeDockerClient(t, tt.cli)
+			runner := &fakeRunner{}
+			cfg := testConfig(t, runner)
+			cfg.UseDockerSDK = true
+
+			filePath := writeTestTar(t, "app.tar", nil)
+			images, err := loadImage(context.Background(), filePath, tt.sub, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadImage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(images, tt.want) {
+				t.Errorf("loadImage() = %v, want %v", images, tt.want)
+			}
+			if tt.sub.DockerContext == "" && tt.cli.loaded == "" {
+				t.Errorf("没有将镜像文件发送给守护进程")
+			}
+			if len(runner.calls) > 0 {
+				t.Errorf("SDK 模式执行了命令 %q", runner.calls)
+			}
+		})
+	}
+}
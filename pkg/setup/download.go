@@ -0,0 +1,189 @@
+package setup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// 下载主Stub文件使用的 S3 配置
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	AccessKey string `yaml:"accessKey"`
+	SecretKey string `yaml:"secretKey"`
+	Insecure  bool   `yaml:"insecure"`
+}
+
+// 判断主Stub文件是否需要从 HTTP(S) 或 S3 下载
+func isRemoteStub(name string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://"} {
+		if strings.HasPrefix(name, scheme) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 将远程主Stub文件下载到 dir 中的临时文件，返回临时文件路径
+// 启用校验时同时下载对应的 .sha256 文件，由解压前的校验使用
+func downloadStub(ctx context.Context, rawURL, dir string, cfg *Config) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("STUB 文件地址 %s 格式错误: %w", rawURL, err)
+	}
+
+	// 保留原文件名后缀，以便识别 .tar.gz 等压缩格式
+	f, err := os.CreateTemp(dir, ".download-*-"+path.Base(u.Path))
+	if err != nil {
+		return "", fmt.Errorf("创建下载临时文件失败: %w", err)
+	}
+	stubTar := f.Name()
+	f.Close()
+
+	slog.Info("正在下载STUB文件", "url", rawURL, "file", stubTar)
+	if err := download(ctx, u, stubTar, cfg); err != nil {
+		removeDownload(stubTar)
+		return "", err
+	}
+
+	if cfg.VerifyChecksums {
+		sumURL := *u
+		sumURL.Path += checksumSuffix
+		if err := download(ctx, &sumURL, stubTar+checksumSuffix, cfg); err != nil {
+			removeDownload(stubTar)
+			return "", fmt.Errorf("下载校验和文件失败: %w", err)
+		}
+	}
+
+	slog.Info("STUB文件下载完成", "url", rawURL)
+	return stubTar, nil
+}
+
+// 删除下载的临时文件及其校验和文件
+func removeDownload(stubTar string) {
+	for _, p := range []string{stubTar, stubTar + checksumSuffix} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			slog.Warn("删除下载的临时文件失败", "file", p, "error", err)
+		}
+	}
+}
+
+// 下载 u 指向的文件到 target
+func download(ctx context.Context, u *url.URL, target string, cfg *Config) error {
+	r, size, err := openRemote(ctx, u, cfg)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	progress := &downloadProgress{r: r, name: filepath.Base(u.Path), total: size, lastLog: time.Now()}
+	if _, err := io.Copy(f, progress); err != nil {
+		return fmt.Errorf("下载 %s 失败: %w", u.Redacted(), err)
+	}
+
+	return f.Close()
+}
+
+// 打开远程文件，返回数据流和大小，大小未知时为 -1
+func openRemote(ctx context.Context, u *url.URL, cfg *Config) (io.ReadCloser, int64, error) {
+	if u.Scheme == "s3" {
+		return openS3(ctx, u, cfg)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("下载 %s 失败: %w", u.Redacted(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("下载 %s 失败: %s", u.Redacted(), resp.Status)
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+// 打开 S3 对象，地址格式为 s3://bucket/key
+func openS3(ctx context.Context, u *url.URL, cfg *Config) (io.ReadCloser, int64, error) {
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, 0, fmt.Errorf("S3 地址 %s 格式错误，应为 s3://bucket/key", u)
+	}
+
+	client, err := minio.New(cfg.StubS3.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.StubS3.AccessKey, cfg.StubS3.SecretKey, ""),
+		Secure: !cfg.StubS3.Insecure,
+		Region: cfg.StubS3.Region,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("创建 S3 客户端失败: %w", err)
+	}
+
+	obj, err := client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("下载 %s 失败: %w", u, err)
+	}
+
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, 0, fmt.Errorf("下载 %s 失败: %w", u, err)
+	}
+
+	return obj, info.Size, nil
+}
+
+// 下载进度，每完成 5% 或间隔 2 秒输出一次日志，大小未知时只按间隔输出
+type downloadProgress struct {
+	r       io.Reader
+	name    string
+	total   int64
+	read    int64
+	logged  int64
+	lastLog time.Time
+}
+
+func (p *downloadProgress) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+
+	if p.total <= 0 {
+		if time.Since(p.lastLog) >= 2*time.Second {
+			p.lastLog = time.Now()
+			slog.Info("正在下载", "file", p.name, "size", formatBytes(p.read))
+		}
+		return n, err
+	}
+
+	percent := min(p.read*100/p.total, 100)
+	if percent >= p.logged+5 || (percent > p.logged && time.Since(p.lastLog) >= 2*time.Second) {
+		p.logged = percent
+		p.lastLog = time.Now()
+		slog.Info("正在下载", "file", p.name, "progress", fmt.Sprintf("%d%%", percent), "size", formatBytes(p.read)+"/"+formatBytes(p.total))
+	}
+
+	return n, err
+}
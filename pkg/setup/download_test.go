@@ -0,0 +1,74 @@
+package setup
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDownloadStub(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bundle/stub.tar.gz":
+			w.Write([]byte("stub"))
+		case "/bundle/stub.tar.gz" + checksumSuffix, "/nosum/stub.tar.gz":
+			w.Write([]byte("0123  stub.tar.gz\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		verify  bool
+		wantSum bool
+		wantErr bool
+	}{
+		{name: "下载成功", path: "/bundle/stub.tar.gz"},
+		{name: "同时下载校验和文件", path: "/bundle/stub.tar.gz", verify: true, wantSum: true},
+		{name: "文件不存在", path: "/missing/stub.tar.gz", wantErr: true},
+		{name: "校验和文件不存在", path: "/nosum/stub.tar.gz", verify: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := testConfig(t, &fakeRunner{})
+			cfg.VerifyChecksums = tt.verify
+
+			stubTar, err := downloadStub(context.Background(), ts.URL+tt.path, dir, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("downloadStub() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				// 下载失败时不留下临时文件
+				if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+					t.Errorf("下载失败后留下了 %v", entries)
+				}
+				return
+			}
+
+			// 保留原文件名后缀
+			if !strings.HasSuffix(stubTar, "stub.tar.gz") {
+				t.Errorf("下载到 %s, want 以 stub.tar.gz 结尾", stubTar)
+			}
+			if data, err := os.ReadFile(stubTar); err != nil || string(data) != "stub" {
+				t.Errorf("下载的内容为 %q, %v, want stub", data, err)
+			}
+			_, err = os.Stat(stubTar + checksumSuffix)
+			if got := err == nil; got != tt.wantSum {
+				t.Errorf("下载了校验和文件 = %v, want %v", got, tt.wantSum)
+			}
+
+			removeDownload(stubTar)
+			if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+				t.Errorf("删除下载后留下了 %v", entries)
+			}
+		})
+	}
+}
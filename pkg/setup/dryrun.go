@@ -0,0 +1,65 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// 试运行时查询类命令返回的错误，调用方按查询失败处理
+var errDryRun = errors.New("试运行，未执行命令")
+
+// 试运行时打印将要执行的完整命令并返回 true，调用方应跳过执行
+func dryRun(cmd *exec.Cmd, cfg *Config, attrs ...any) bool {
+	if !cfg.DryRun {
+		return false
+	}
+
+	slog.Info("试运行，跳过命令", append([]any{"command", strings.Join(cmd.Args, " ")}, attrs...)...)
+	return true
+}
+
+// 试运行时根据主Stub文件的条目处理子目录，只打印每个文件将要执行的命令
+func dryRunStubDir(ctx context.Context, stubTar, cwd string, m *manifest, cfg *Config) error {
+	if _, err := os.Stat(stubTar); os.IsNotExist(err) {
+		return fmt.Errorf("STUB 文件不存在: %w", err)
+	}
+
+	entries, err := listTarEntries(ctx, stubTar, cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, plan := range buildPlan(entries, cfg.MaxDepth) {
+		for _, task := range plan.Tasks {
+			filePath := filepath.Join(cwd, plan.Name, task.Name)
+
+			// 与 processNestedDirs 一致，更深层目录中的文件解压到其所在目录
+			sub := m.subDir(plan.Name)
+			if strings.Contains(task.Name, "/") {
+				sub.ExtractTarget = ""
+			}
+
+			switch {
+			case task.Op == opLoad && cfg.FilesOnly:
+				slog.Info("仅准备文件，跳过镜像", "file", filePath)
+			case task.Op == opLoad && !archSelected(task.Name, cfg):
+				slog.Info("镜像文件不是目标架构，跳过", "file", filePath, "targetArch", targetArch(cfg))
+			case task.Op == opExtract:
+				err = extractFiles(ctx, filePath, sub, cfg)
+			default:
+				_, err = loadImage(ctx, filePath, sub, cfg)
+			}
+			if err != nil {
+				return fmt.Errorf("处理子目录 %s 失败: %w", plan.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
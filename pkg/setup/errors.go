@@ -0,0 +1,87 @@
+package setup
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 失败原因分类，调用方可以通过 errors.Is 判断
+var (
+	ErrDependencyMissing = errors.New("依赖检查失败")
+	ErrExtractFailed     = errors.New("解压失败")
+	ErrDockerLoadFailed  = errors.New("镜像加载失败")
+	ErrComposeFailed     = errors.New("启动 Compose 失败")
+	ErrMinioConfig       = errors.New("配置 Minio 失败")
+)
+
+// 退出码
+const (
+	exitOK          = 0   // 成功
+	exitFailure     = 1   // 其他错误，例如配置错误
+	exitDependency  = 2   // 缺少依赖命令或版本过低
+	exitExtract     = 3   // 解压失败
+	exitDockerLoad  = 4   // 加载或拉取镜像失败
+	exitMinio       = 5   // 配置 Minio 失败
+	exitCompose     = 6   // 启动 Compose 失败
+	exitInterrupted = 130 // 收到 SIGINT 或 SIGTERM
+)
+
+// 按失败原因分类得到退出码，有多个分类时按下列顺序取第一个
+func ExitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	codes := []struct {
+		category error
+		code     int
+	}{
+		{ErrInterrupted, exitInterrupted},
+		{ErrDependencyMissing, exitDependency},
+		{ErrExtractFailed, exitExtract},
+		{ErrDockerLoadFailed, exitDockerLoad},
+		{ErrMinioConfig, exitMinio},
+		{ErrComposeFailed, exitCompose},
+	}
+	for _, c := range codes {
+		if errors.Is(err, c.category) {
+			return c.code
+		}
+	}
+
+	return exitFailure
+}
+
+// 带分类的错误，错误信息与原错误一致
+type categoryError struct {
+	category error
+	err      error
+}
+
+func (e *categoryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categoryError) Unwrap() []error {
+	return []error{e.category, e.err}
+}
+
+// 为错误标记失败原因分类，err 为 nil 时返回 nil
+func withCategory(category, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &categoryError{category: category, err: err}
+}
+
+// 多个错误，错误信息保持 [err1 err2] 的格式，同时支持 errors.Is 和 errors.As
+type errorList []error
+
+func (e errorList) Error() string {
+	return fmt.Sprintf("%v", []error(e))
+}
+
+func (e errorList) Unwrap() []error {
+	return e
+}
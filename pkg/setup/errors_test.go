@@ -0,0 +1,144 @@
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestRunErrorCategories(t *testing.T) {
+	failing := func(sub string, output string) func(args []string) ([]byte, error) {
+		return func(args []string) ([]byte, error) {
+			if slices.Contains(args, sub) {
+				return []byte(output), errors.New("exit status 1")
+			}
+			if slices.Contains(args, "load") {
+				return []byte("Loaded image: app:1\n"), nil
+			}
+			if slices.Contains(args, "ps") {
+				return []byte(`[{"Name":"yoo-oss","Service":"minio","State":"running"}]`), nil
+			}
+			return nil, nil
+		}
+	}
+
+	tests := []struct {
+		name      string
+		respond   func(args []string) ([]byte, error)
+		configure func(cfg *Config)
+		stub      []testEntry
+		want      error
+		wantCode  int
+	}{
+		{
+			name:      "缺少依赖命令",
+			configure: func(cfg *Config) { cfg.DockerCmd = "missing-docker" },
+			want:      ErrDependencyMissing,
+			wantCode:  exitDependency,
+		},
+		{
+			name:     "主Stub文件损坏",
+			stub:     []testEntry{{Name: "../escape.txt", Typeflag: tar.TypeReg, Body: "x"}},
+			want:     ErrExtractFailed,
+			wantCode: exitExtract,
+		},
+		{
+			name:     "docker load 失败",
+			respond:  failing("load", "Error response from daemon"),
+			want:     ErrDockerLoadFailed,
+			wantCode: exitDockerLoad,
+		},
+		{
+			name:     "compose up 失败",
+			respond:  failing("up", ""),
+			want:     ErrComposeFailed,
+			wantCode: exitCompose,
+		},
+		{
+			name:     "配置 Minio 失败",
+			respond:  failing("mb", "mc: <ERROR> Unable to make bucket"),
+			want:     ErrMinioConfig,
+			wantCode: exitMinio,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			respond := tt.respond
+			if respond == nil {
+				respond = failing("", "")
+			}
+			cfg, _ := minioTestConfig(t, &fakeRunner{respond: respond})
+			cfg.Preflight = false
+			if tt.configure != nil {
+				tt.configure(cfg)
+			}
+			stub := tt.stub
+			if stub == nil {
+				stub = []testEntry{
+					{Name: "10-app/", Typeflag: tar.TypeDir},
+					{Name: "10-app/app.tar", Typeflag: tar.TypeReg, Body: "image"},
+				}
+			}
+			writeTestStub(t, cfg, stub)
+
+			err := Run(context.Background(), cfg)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Run() error = %v, want %v", err, tt.want)
+			}
+			if got := ExitCode(err); got != tt.wantCode {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestInterruptError(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(ErrInterrupted)
+
+	// 收到退出信号后上下文取消导致的错误
+	err := interruptError(ctx, Run(ctx, testConfig(t, &fakeRunner{})))
+	if !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("interruptError() = %v, want %v", err, ErrInterrupted)
+	}
+	if got := ExitCode(err); got != exitInterrupted {
+		t.Errorf("ExitCode() = %d, want %d", got, exitInterrupted)
+	}
+
+	// 超时等其他原因取消时不标记
+	if err := interruptError(context.Background(), context.DeadlineExceeded); errors.Is(err, ErrInterrupted) {
+		t.Errorf("interruptError() = %v, 不应为 %v", err, ErrInterrupted)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	loadErr := withCategory(ErrDockerLoadFailed, errors.New("docker load 命令失败"))
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "成功", err: nil, want: exitOK},
+		{name: "未分类的错误", err: errors.New("配置错误"), want: exitFailure},
+		{name: "缺少依赖", err: withCategory(ErrDependencyMissing, errors.New("docker 命令不存在")), want: exitDependency},
+		{name: "解压失败", err: withCategory(ErrExtractFailed, errors.New("解压文件失败")), want: exitExtract},
+		{name: "加载失败", err: loadErr, want: exitDockerLoad},
+		{name: "Minio 配置失败", err: withCategory(ErrMinioConfig, errors.New("mc 命令失败")), want: exitMinio},
+		{name: "Compose 启动失败", err: withCategory(ErrComposeFailed, errors.New("compose up 失败")), want: exitCompose},
+		{name: "多层包装", err: fmt.Errorf("处理子目录 10-app 失败: %w", errorList{errors.New("a.tar: 失败"), loadErr}), want: exitDockerLoad},
+		{name: "多个输入目录按优先级", err: errors.Join(loadErr, withCategory(ErrExtractFailed, errors.New("解压文件失败"))), want: exitExtract},
+		{name: "中断优先", err: errors.Join(ErrInterrupted, loadErr), want: exitInterrupted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
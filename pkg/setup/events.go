@@ -0,0 +1,99 @@
+package setup
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	eventStageStart = "stage_start"
+	eventStageEnd   = "stage_end"
+	eventFile       = "file"
+	eventRunEnd     = "run_end"
+)
+
+// 发送一个事件的最长时间，接收方长时间不读取时断开连接，避免阻塞处理流程
+const eventWriteTimeout = time.Second
+
+// 运行事件，以换行分隔的 JSON 发送
+type event struct {
+	Time  time.Time `json:"time"`
+	Type  string    `json:"type"`
+	Stage string    `json:"stage,omitempty"`
+	File  string    `json:"file,omitempty"`
+	Op    string    `json:"op,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+// 向 Unix 套接字发送事件的事件流，可并发使用，事件中的密钥由 redactor 隐藏
+type eventStream struct {
+	mu       sync.Mutex
+	conn     net.Conn
+	redactor *secretRedactor
+}
+
+// 连接事件套接字，失败时只记录日志
+func (s *eventStream) connect(path string) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		slog.Warn("连接事件套接字失败，不再发送事件", "socket", path, "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conn = conn
+}
+
+// 发送事件，写入失败或超过 eventWriteTimeout 时断开连接并不再发送
+func (s *eventStream) emit(e event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return
+	}
+
+	e.Time = time.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		slog.Warn("序列化事件失败", "type", e.Type, "error", err)
+		return
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+	if _, err := s.conn.Write(append(s.redactor.redactJSON(data), '\n')); err != nil {
+		slog.Warn("发送事件失败，不再发送事件", "error", err)
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// 发送单个文件的处理结果
+func (s *eventStream) emitFile(file, op string, err error) {
+	s.emit(event{Type: eventFile, File: file, Op: op, Error: errorString(err)})
+}
+
+// 关闭事件套接字
+func (s *eventStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// 错误信息，无错误时为空
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,30 @@
+package setup
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestEmitStalledReader(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	s := &eventStream{conn: server, redactor: &secretRedactor{}}
+
+	// 接收方不读取时发送超时，断开连接后不再阻塞
+	done := make(chan struct{})
+	go func() {
+		s.emit(event{Type: eventStageStart, Stage: stageExtract})
+		s.emit(event{Type: eventStageEnd, Stage: stageExtract})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * eventWriteTimeout):
+		t.Fatal("emit() 在接收方不读取时一直阻塞")
+	}
+	if s.conn != nil {
+		t.Errorf("发送超时后没有断开连接")
+	}
+}
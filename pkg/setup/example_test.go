@@ -0,0 +1,32 @@
+package setup_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"com.example/setup/pkg/setup"
+)
+
+// 在同一进程中并发处理两个工作目录，每次 Run 使用单独的运行状态和结果汇总
+// 需要本机安装 docker，因此不检查输出
+func Example_run() {
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for _, dir := range []string{"/srv/site-a", "/srv/site-b"} {
+		wg.Add(1)
+		go func(dir string) {
+			defer wg.Done()
+
+			cfg := setup.DefaultConfig()
+			cfg.WorkDir = dir
+			if err := setup.Run(ctx, cfg); err != nil {
+				slog.Error("初始化失败", "dir", dir, "error", err)
+				fmt.Println(dir, "退出码", setup.ExitCode(err))
+			}
+		}(dir)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,377 @@
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 解压文件修改时间的处理方式
+const (
+	mtimePreserve   = "preserve"
+	mtimeNow        = "now"
+	mtimeClampToNow = "clamp-to-now"
+)
+
+// 条目的规范名称，去掉开头的 ./ 和末尾的 /，用于比较 tar 文件中的条目名
+func entryName(name string) string {
+	return path.Clean(strings.TrimPrefix(name, "./"))
+}
+
+// 将 members 对应到 tar 文件中条目的原始名称，例如 docker-compose.yml 对应 ./docker-compose.yml，有成员不存在时报错
+// 外部 tar 命令按原始名称匹配条目
+func tarMembers(ctx context.Context, tarPath string, members []string, cfg *Config) ([]string, error) {
+	entries, err := listTarEntries(ctx, tarPath, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]string, 0, len(members))
+	var missing []string
+	for _, member := range members {
+		i := slices.IndexFunc(entries, func(entry string) bool { return entryName(entry) == entryName(member) })
+		if i < 0 {
+			missing = append(missing, member)
+			continue
+		}
+		raw = append(raw, entries[i])
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s 中没有条目 %s", filepath.Base(tarPath), strings.Join(missing, ", "))
+	}
+
+	return raw, nil
+}
+
+// 解压 tar 文件到目标目录，指定 members 时只解压这些条目，条目名按 entryName 比较，有成员不存在时报错
+func extractTar(ctx context.Context, tarPath, targetDir string, cfg *Config, members ...string) error {
+	// 仅在调试级别下输出每个解压的文件名，避免大文件刷屏
+	verbose := slog.Default().Enabled(ctx, slog.LevelDebug)
+	flags := tarFlags("x", tarPath, verbose)
+	// 通过标准输入传入压缩文件，以便统计解压进度
+	args := []string{flags, "-", "-C", targetDir}
+
+	switch cfg.MtimeMode {
+	case mtimePreserve, mtimeClampToNow:
+	case mtimeNow:
+		// -m 不恢复条目中记录的修改时间，使用解压时刻
+		args = append(args, "-m")
+	default:
+		return fmt.Errorf("未知的修改时间处理方式: %s", cfg.MtimeMode)
+	}
+
+	// 使用 archive/tar 解压时不调用外部 tar 命令
+	if useNativeTar(tarPath, cfg) {
+		if cfg.DryRun {
+			slog.Info("试运行，跳过解压", "file", tarPath, "targetDir", targetDir)
+			return nil
+		}
+		return extractNative(ctx, tarPath, targetDir, cfg, members...)
+	}
+
+	if len(members) > 0 {
+		var err error
+		if members, err = tarMembers(ctx, tarPath, members, cfg); err != nil {
+			return err
+		}
+		args = append(args, members...)
+	}
+
+	if dryRun(command(ctx, cfg, cfg.TarCmd, args...), cfg, "stdin", tarPath) {
+		return nil
+	}
+
+	// 解压前检查所有条目，防止写到目标目录之外
+	if err := checkArchiveEntries(ctx, tarPath); err != nil {
+		return err
+	}
+
+	var output []byte
+	err := retry(ctx, cfg, "tar "+tarPath, func(ctx context.Context) (err error) {
+		output, err = runTarStdin(ctx, tarPath, args, cfg)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if verbose {
+		slog.Debug("解压完成", "file", tarPath, "output", string(output))
+	}
+
+	if cfg.MtimeMode == mtimeClampToNow {
+		entries := members
+		if len(entries) == 0 {
+			if entries, err = listTarEntries(ctx, tarPath, cfg); err != nil {
+				return err
+			}
+		}
+		if err := clampMtimes(targetDir, entries, time.Now()); err != nil {
+			return fmt.Errorf("修正文件修改时间失败: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// 检查条目路径是否会落在解压目标目录之外，拒绝绝对路径和包含 .. 的路径
+func checkEntryPath(name string) error {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return fmt.Errorf("条目 %s 使用了绝对路径", name)
+	}
+
+	for _, part := range strings.Split(filepath.ToSlash(name), "/") {
+		if part == ".." {
+			return fmt.Errorf("条目 %s 包含 ..", name)
+		}
+	}
+
+	return nil
+}
+
+// 检查链接条目的目标是否指向解压目标目录之外
+func checkEntryLink(hdr *tar.Header) error {
+	switch hdr.Typeflag {
+	case tar.TypeLink:
+		// 硬链接目标相对于压缩文件根目录
+		if err := checkEntryPath(hdr.Linkname); err != nil {
+			return fmt.Errorf("硬链接 %s 的目标无效: %w", hdr.Name, err)
+		}
+	case tar.TypeSymlink:
+		// 符号链接目标相对于链接所在目录
+		target := path.Join(path.Dir(hdr.Name), hdr.Linkname)
+		if path.IsAbs(hdr.Linkname) || target == ".." || strings.HasPrefix(target, "../") {
+			return fmt.Errorf("符号链接 %s 指向解压目录之外: %s", hdr.Name, hdr.Linkname)
+		}
+	}
+
+	return nil
+}
+
+// 记录已解压的符号链接，拒绝经过符号链接写入的条目
+// 单独检查每个链接的目标无法发现链接串联造成的逃逸，例如 l1 -> . 之后的 l1/l2 -> .. 和 l1/l2/file
+type entryLinks map[string]bool
+
+// 检查条目及硬链接目标的上级路径中没有之前解压的符号链接，并记录本条目是否为符号链接
+func (links entryLinks) check(hdr *tar.Header) error {
+	name := entryName(hdr.Name)
+	if dir := links.through(name); dir != "" {
+		return fmt.Errorf("条目 %s 经过符号链接 %s", hdr.Name, dir)
+	}
+	if hdr.Typeflag == tar.TypeLink {
+		if dir := links.through(path.Clean(hdr.Linkname)); dir != "" {
+			return fmt.Errorf("硬链接 %s 的目标经过符号链接 %s", hdr.Name, dir)
+		}
+	}
+
+	switch {
+	case hdr.Typeflag == tar.TypeSymlink:
+		links[name] = true
+	case links[name] && hdr.Typeflag == tar.TypeDir:
+		// 目录条目不会替换已有的符号链接，设置权限时会作用到链接目标
+		return fmt.Errorf("目录 %s 与之前的符号链接同名", hdr.Name)
+	default:
+		// 文件和硬链接会先删除同名的符号链接再写入
+		delete(links, name)
+	}
+	return nil
+}
+
+// 返回 name 的上级路径中第一个已记录的符号链接，没有时为空
+func (links entryLinks) through(name string) string {
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if links[dir] {
+			return dir
+		}
+	}
+	return ""
+}
+
+// 读取压缩文件的所有条目，确认解压时不会写到目标目录之外
+func checkArchiveEntries(ctx context.Context, tarPath string) error {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := archiveReader(f, tarPath)
+	if err != nil {
+		return err
+	}
+
+	links := entryLinks{}
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %w", tarPath, err)
+		}
+
+		if err := checkEntryPath(hdr.Name); err != nil {
+			return fmt.Errorf("拒绝解压 %s: %w", filepath.Base(tarPath), err)
+		}
+		if err := checkEntryLink(hdr); err != nil {
+			return fmt.Errorf("拒绝解压 %s: %w", filepath.Base(tarPath), err)
+		}
+		if err := links.check(hdr); err != nil {
+			return fmt.Errorf("拒绝解压 %s: %w", filepath.Base(tarPath), err)
+		}
+	}
+}
+
+// 执行 tar 命令，通过标准输入传入压缩文件
+func runTarStdin(ctx context.Context, tarPath string, args []string, cfg *Config) ([]byte, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := command(ctx, cfg, cfg.TarCmd, args...)
+	cmd.Stdin = f
+	if info.Size() > extractProgressThreshold {
+		cmd.Stdin = &extractProgress{r: f, name: filepath.Base(tarPath), total: info.Size(), lastLog: time.Now()}
+	}
+	output, err := combinedOutput(cmd, tarPath, cfg)
+	if err != nil {
+		return output, fmt.Errorf("tar 命令失败: %w, 输出: %s", err, output)
+	}
+
+	return output, nil
+}
+
+// 将晚于 now 或为零值(纪元时间)的修改时间修正为 now
+func clampMtimes(targetDir string, entries []string, now time.Time) error {
+	for _, entry := range entries {
+		p := filepath.Join(targetDir, entry)
+
+		info, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+
+		// 符号链接的时间无法通过 Chtimes 修改，跳过
+		if info.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+
+		mtime := info.ModTime()
+		if mtime.After(now) || mtime.Unix() <= 0 {
+			if err := os.Chtimes(p, now, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// 超过该大小的压缩文件在解压时输出进度
+const extractProgressThreshold = 64 << 20
+
+// 解压进度，每完成 5% 或间隔 2 秒输出一次日志
+type extractProgress struct {
+	r       io.Reader
+	name    string
+	total   int64
+	read    int64
+	logged  int64
+	lastLog time.Time
+}
+
+func (p *extractProgress) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+
+	percent := min(p.read*100/p.total, 100)
+	if percent >= p.logged+5 || (percent > p.logged && time.Since(p.lastLog) >= 2*time.Second) {
+		p.logged = percent
+		p.lastLog = time.Now()
+		slog.Info("正在解压", "file", p.name, "progress", fmt.Sprintf("%d%%", percent), "size", formatBytes(p.read)+"/"+formatBytes(p.total))
+	}
+
+	return n, err
+}
+
+// 以 KiB、MiB、GiB 等单位格式化字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Compose 相关文件名
+var composeFileNames = []string{
+	"docker-compose.yml",
+	"docker-compose.yaml",
+	"compose.yml",
+	"compose.yaml",
+	".env",
+}
+
+// 从主Stub文件中筛选出位于根目录的 Compose 相关条目
+func composeMembers(entries []string) []string {
+	var members []string
+	for _, entry := range entries {
+		name := strings.TrimPrefix(entry, "./")
+		if slices.Contains(composeFileNames, name) {
+			members = append(members, entry)
+		}
+	}
+
+	return members
+}
+
+// 只从主Stub文件中解压 Compose 相关文件
+func extractComposeFiles(ctx context.Context, stubTar string, cfg *Config) error {
+	if _, err := os.Stat(stubTar); os.IsNotExist(err) {
+		return fmt.Errorf("STUB 文件不存在: %w", err)
+	}
+
+	entries, err := listTarEntries(ctx, stubTar, cfg)
+	if err != nil {
+		return err
+	}
+
+	members := composeMembers(entries)
+	if len(members) == 0 {
+		return fmt.Errorf("STUB 文件中没有 Compose 文件")
+	}
+
+	if err := extractTar(ctx, stubTar, filepath.Dir(stubTar), cfg, members...); err != nil {
+		return fmt.Errorf("解压 Compose 文件失败: %w", err)
+	}
+
+	slog.Info("Compose 文件解压成功", "files", members)
+	return nil
+}
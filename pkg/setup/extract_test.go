@@ -0,0 +1,244 @@
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// 测试用的 tar 条目，Linkname 不为空时为链接
+type testEntry struct {
+	Name     string
+	Typeflag byte
+	Linkname string
+	Body     string
+}
+
+// 在临时目录中写入 tar 文件，返回文件路径
+func writeTestTar(t *testing.T, name string, entries []testEntry) string {
+	t.Helper()
+
+	p := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.Name, Typeflag: e.Typeflag, Linkname: e.Linkname, Mode: 0o644, Size: int64(len(e.Body))}
+		if e.Typeflag == tar.TypeDir {
+			hdr.Mode = 0o755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.Body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestArchiveEntryTraversal(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		wantErr bool
+	}{
+		{
+			name: "普通文件和目录",
+			entries: []testEntry{
+				{Name: "dir/", Typeflag: tar.TypeDir},
+				{Name: "dir/a.txt", Typeflag: tar.TypeReg, Body: "a"},
+				{Name: "./b.txt", Typeflag: tar.TypeReg, Body: "b"},
+			},
+		},
+		{
+			name: "目录内的符号链接",
+			entries: []testEntry{
+				{Name: "dir/", Typeflag: tar.TypeDir},
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir"},
+				{Name: "dir/a.txt", Typeflag: tar.TypeReg, Body: "a"},
+			},
+		},
+		{
+			name:    "包含 ..",
+			entries: []testEntry{{Name: "../escaped.txt", Typeflag: tar.TypeReg, Body: "x"}},
+			wantErr: true,
+		},
+		{
+			name:    "绝对路径",
+			entries: []testEntry{{Name: "/tmp/escaped.txt", Typeflag: tar.TypeReg, Body: "x"}},
+			wantErr: true,
+		},
+		{
+			name:    "符号链接指向目录之外",
+			entries: []testEntry{{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "../.."}},
+			wantErr: true,
+		},
+		{
+			name:    "硬链接指向目录之外",
+			entries: []testEntry{{Name: "h", Typeflag: tar.TypeLink, Linkname: "../etc/passwd"}},
+			wantErr: true,
+		},
+		{
+			name: "串联的符号链接",
+			entries: []testEntry{
+				{Name: "l1", Typeflag: tar.TypeSymlink, Linkname: "."},
+				{Name: "l1/l2", Typeflag: tar.TypeSymlink, Linkname: ".."},
+				{Name: "l1/l2/ESCAPED.txt", Typeflag: tar.TypeReg, Body: "x"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "经过符号链接写入文件",
+			entries: []testEntry{
+				{Name: "dir/", Typeflag: tar.TypeDir},
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir"},
+				{Name: "link/a.txt", Typeflag: tar.TypeReg, Body: "a"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "硬链接目标经过符号链接",
+			entries: []testEntry{
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "."},
+				{Name: "h", Typeflag: tar.TypeLink, Linkname: "link/h"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "与符号链接同名的目录",
+			entries: []testEntry{
+				{Name: "dir/", Typeflag: tar.TypeDir},
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir"},
+				{Name: "link/", Typeflag: tar.TypeDir},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tarPath := writeTestTar(t, "test.tar", tt.entries)
+
+			err := checkArchiveEntries(context.Background(), tarPath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkArchiveEntries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// 原生解压不依赖预先检查，同样需要拒绝
+			root := t.TempDir()
+			targetDir := filepath.Join(root, "target")
+			if err := os.Mkdir(targetDir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			err = extractNative(context.Background(), tarPath, targetDir, DefaultConfig())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("extractNative() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := os.Lstat(filepath.Join(root, "ESCAPED.txt")); err == nil {
+				t.Errorf("extractNative() 写到了目标目录之外")
+			}
+		})
+	}
+}
+
+func TestExtractNativeExistingSymlink(t *testing.T) {
+	root := t.TempDir()
+	outside := filepath.Join(root, "outside")
+	targetDir := filepath.Join(root, "target")
+	for _, dir := range []string{outside, targetDir} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 目标目录中已有指向目录之外的符号链接，例如上次解压留下的
+	if err := os.Symlink(outside, filepath.Join(targetDir, "out")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		entries []testEntry
+	}{
+		{name: "文件", entries: []testEntry{{Name: "out/a.txt", Typeflag: tar.TypeReg, Body: "a"}}},
+		{name: "目录", entries: []testEntry{{Name: "out/dir/", Typeflag: tar.TypeDir}}},
+		{name: "符号链接", entries: []testEntry{{Name: "out/l", Typeflag: tar.TypeSymlink, Linkname: "."}}},
+		{name: "硬链接", entries: []testEntry{
+			{Name: "a.txt", Typeflag: tar.TypeReg, Body: "a"},
+			{Name: "out/h", Typeflag: tar.TypeLink, Linkname: "a.txt"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tarPath := writeTestTar(t, "test.tar", tt.entries)
+			if err := extractNative(context.Background(), tarPath, targetDir, DefaultConfig()); err == nil {
+				t.Errorf("extractNative() 没有拒绝经过符号链接的条目")
+			}
+
+			entries, err := os.ReadDir(outside)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) > 0 {
+				t.Errorf("extractNative() 写到了目标目录之外: %v", entries)
+			}
+		})
+	}
+}
+
+func TestExtractMembers(t *testing.T) {
+	tarPath := writeTestTar(t, "stub.tar", []testEntry{
+		{Name: "./docker-compose.yml", Typeflag: tar.TypeReg, Body: "services: {}"},
+		{Name: "./10-app/", Typeflag: tar.TypeDir},
+		{Name: "./10-app/app.tar", Typeflag: tar.TypeReg, Body: "image"},
+		{Name: "other.txt", Typeflag: tar.TypeReg, Body: "x"},
+	})
+
+	tests := []struct {
+		name    string
+		members []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "条目名带 ./", members: []string{"docker-compose.yml"}, want: []string{"docker-compose.yml"}},
+		{name: "子目录中的条目", members: []string{"10-app/app.tar"}, want: []string{"10-app/app.tar"}},
+		{name: "成员名带 ./", members: []string{"./other.txt"}, want: []string{"other.txt"}},
+		{name: "成员不存在", members: []string{"docker-compose.yml", "missing.txt"}, wantErr: true},
+	}
+
+	for _, native := range []bool{true, false} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/native=%v", tt.name, native), func(t *testing.T) {
+				cfg := DefaultConfig()
+				cfg.NativeExtract = native
+				targetDir := t.TempDir()
+
+				err := extractTar(context.Background(), tarPath, targetDir, cfg, tt.members...)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("extractTar() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				for _, name := range tt.want {
+					if _, err := os.Stat(filepath.Join(targetDir, name)); err != nil {
+						t.Errorf("没有解压 %s: %v", name, err)
+					}
+				}
+				if _, err := os.Stat(filepath.Join(targetDir, "other.txt")); err == nil && !slices.Contains(tt.want, "other.txt") {
+					t.Errorf("解压了未指定的 other.txt")
+				}
+			})
+		}
+	}
+}
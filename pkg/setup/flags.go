@@ -0,0 +1,184 @@
+package setup
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 值为密钥的参数，帮助信息中隐藏其默认值
+var secretFlags = []string{"s3-secret-key", "minio-secret-key", "minio-password", "registry-password"}
+
+// 注册所有命令行参数，参数默认值取自 cfg
+func RegisterFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.StubTarName, "stub-tar", cfg.StubTarName, "主Stub文件名，也可以是 http://、https:// 或 s3://bucket/key 地址")
+	fs.StringVar(&cfg.StubS3.Endpoint, "s3-endpoint", cfg.StubS3.Endpoint, "下载 s3:// 主Stub文件使用的 S3 服务地址")
+	fs.StringVar(&cfg.StubS3.Region, "s3-region", cfg.StubS3.Region, "下载 s3:// 主Stub文件使用的 S3 区域")
+	fs.StringVar(&cfg.StubS3.AccessKey, "s3-access-key", cfg.StubS3.AccessKey, "下载 s3:// 主Stub文件使用的访问密钥")
+	fs.StringVar(&cfg.StubS3.SecretKey, "s3-secret-key", cfg.StubS3.SecretKey, "下载 s3:// 主Stub文件使用的 secret key")
+	fs.BoolVar(&cfg.StubS3.Insecure, "s3-insecure", cfg.StubS3.Insecure, "使用 HTTP 而不是 HTTPS 连接 S3 服务")
+	fs.StringVar(&cfg.StubDirName, "stub-dir", cfg.StubDirName, "Stub 目录名")
+	fs.StringVar(&cfg.ManifestName, "manifest", cfg.ManifestName, "Stub 清单文件名")
+	fs.StringVar(&cfg.DockerCmd, "docker-cmd", cfg.DockerCmd, "docker 命令，使用 podman 或 nerdctl 运行时且为 docker 时改为对应的命令")
+	fs.StringVar(&cfg.Runtime, "runtime", cfg.Runtime, "容器运行时，可选 auto、docker、podman 或 nerdctl，auto 时依次查找 -docker-cmd、podman 和 nerdctl 命令")
+	fs.StringVar(&cfg.TarCmd, "tar-cmd", cfg.TarCmd, "tar 命令")
+	fs.StringVar(&cfg.MinDockerVersion, "min-docker-version", cfg.MinDockerVersion, "docker 的最低版本，为空时不检查")
+	fs.StringVar(&cfg.MinTarVersion, "min-tar-version", cfg.MinTarVersion, "tar 的最低版本，为空时不检查；GNU tar 与 bsdtar 版本号不同，按实际使用的 tar 设置")
+	fs.StringVar(&cfg.MinioAccessKey, "minio-access-key", cfg.MinioAccessKey, "创建的 Minio 访问密钥")
+	fs.StringVar(&cfg.MinioSecretKey, "minio-secret-key", cfg.MinioSecretKey, "创建的 Minio 访问密钥对应的 secret key")
+	fs.StringVar(&cfg.MinioContainer, "minio-container", cfg.MinioContainer, "Minio 容器名")
+	fs.StringVar(&cfg.MinioUser, "minio-user", cfg.MinioUser, "Minio 用户名")
+	fs.StringVar(&cfg.MinioUserPass, "minio-password", cfg.MinioUserPass, "Minio 用户密码")
+	fs.StringVar(&cfg.MinioDesc, "minio-desc", cfg.MinioDesc, "Minio 访问密钥的名称和描述")
+	fs.StringVar(&cfg.MinioAlias, "minio-alias", cfg.MinioAlias, "mc 使用的 Minio 别名")
+	fs.StringVar(&cfg.MinioEndpoint, "minio-endpoint", cfg.MinioEndpoint, "Minio 服务地址")
+	fs.Func("minio-bucket", "需要创建的 Minio 存储桶，格式为 name[:policy][:versioning]，policy 可选 none、download、upload 或 public，versioning 启用版本控制，可重复指定", func(s string) error {
+		bucket, err := parseMinioBucket(s)
+		if err != nil {
+			return err
+		}
+		cfg.MinioBuckets = append(cfg.MinioBuckets, bucket)
+		return nil
+	})
+	fs.Func("minio-key", "需要创建的 Minio 访问密钥，格式为 accessKey:secretKey[:name]，可重复指定，指定后忽略 -minio-access-key 等参数", func(s string) error {
+		key, err := parseMinioKey(s)
+		if err != nil {
+			return err
+		}
+		cfg.MinioAccessKeys = append(cfg.MinioAccessKeys, key)
+		return nil
+	})
+	fs.IntVar(&cfg.MaxRetries, "max-retries", cfg.MaxRetries, "tar、docker load、pull、push、login、compose up 和 Minio 操作遇到暂时性错误(例如 Docker 守护进程或网络暂时不可用)时的最大重试次数，其他错误不重试")
+	fs.DurationVar(&cfg.RetryBackoff, "retry-backoff", cfg.RetryBackoff, "命令失败重试的初始间隔，每次重试翻倍")
+	fs.DurationVar(&cfg.RetryMaxBackoff, "retry-max-backoff", cfg.RetryMaxBackoff, "命令失败重试的最大间隔，0 表示不限制")
+	fs.Float64Var(&cfg.RetryJitter, "retry-jitter", cfg.RetryJitter, "重试间隔的随机浮动比例，例如 0.2 表示上下浮动 20%")
+	fs.IntVar(&cfg.MinioRaceRetries, "minio-race-retries", cfg.MinioRaceRetries, "Minio 操作发生并发竞争时的最大重试次数")
+	fs.DurationVar(&cfg.MinioRaceBackoff, "minio-race-backoff", cfg.MinioRaceBackoff, "Minio 操作发生并发竞争时的初始重试间隔")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "日志格式: text 或 json")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "日志级别: debug、info、warn 或 error")
+	fs.StringVar(&cfg.LogFile, "log-file", cfg.LogFile, "同时将日志追加写入该文件，格式与 -log-format 相同")
+	fs.StringVar(&cfg.RunID, "run-id", cfg.RunID, "本次运行的 ID，附加到每条日志中，未指定时随机生成")
+	fs.DurationVar(&cfg.Timeout, "timeout", cfg.Timeout, "整体超时时间，例如 3h；为 0 时为各阶段超时时间之和，有阶段不限制时整体也不限制")
+	fs.DurationVar(&cfg.StageTimeouts.Extract, "extract-timeout", cfg.StageTimeouts.Extract, "校验并解压主Stub文件阶段的超时时间，0 表示只受整体超时限制")
+	fs.DurationVar(&cfg.StageTimeouts.Load, "load-timeout", cfg.StageTimeouts.Load, "处理子目录(解压文件、加载和拉取镜像)阶段的超时时间，0 表示只受整体超时限制")
+	fs.DurationVar(&cfg.StageTimeouts.Compose, "compose-timeout", cfg.StageTimeouts.Compose, "启动 Compose 服务并等待就绪阶段的超时时间，0 表示只受整体超时限制")
+	fs.DurationVar(&cfg.StageTimeouts.Minio, "minio-timeout", cfg.StageTimeouts.Minio, "配置 Minio 阶段的超时时间，0 表示只受整体超时限制")
+	fs.DurationVar(&cfg.PerTaskTimeout, "task-timeout", cfg.PerTaskTimeout, "单个 tar、docker load 或 compose up 命令的超时时间，0 表示只受整体超时限制")
+	fs.IntVar(&cfg.ConcurrentTasks, "concurrent-tasks", cfg.ConcurrentTasks, "并发处理的任务数，小于等于 0 时按 CPU 核数自动计算")
+	fs.StringVar(&cfg.EmitDot, "emit-dot", cfg.EmitDot, "将处理计划以 DOT 格式写入指定文件后退出")
+	fs.BoolVar(&cfg.NativeExtract, "native-extract", cfg.NativeExtract, "使用内置的 archive/tar 解压，不依赖外部 tar 命令；为 false 时使用 -tar-cmd 指定的 tar 命令，zstd 压缩的文件总是使用 archive/tar")
+	fs.StringVar(&cfg.MtimeMode, "mtime-mode", cfg.MtimeMode, "解压文件的修改时间处理方式: preserve、now 或 clamp-to-now")
+	fs.StringVar(&cfg.StatusAddr, "status-addr", cfg.StatusAddr, "状态服务监听地址，例如 :9999，为空时不启动")
+	fs.StringVar(&cfg.ArchCheck, "arch-check", cfg.ArchCheck, "镜像架构与主机不一致时的处理方式: off、warn 或 error")
+	fs.BoolVar(&cfg.ComposeOnly, "compose-only", cfg.ComposeOnly, "只从主Stub文件中解压 Compose 文件后退出")
+	fs.Var((*stringsFlag)(&cfg.AllowedExtractRoots), "allow-extract-root", "允许作为解压目标的根目录，可重复指定")
+	fs.BoolVar(&cfg.TrackChanges, "track-changes", cfg.TrackChanges, "记录运行中新建的文件和目录、加载的镜像和启动的 Compose 服务，供 -rollback-on-failure 和 clean 子命令撤销；加载镜像前需要额外读取镜像文件")
+	fs.BoolVar(&cfg.RollbackOnFailure, "rollback-on-failure", cfg.RollbackOnFailure, "运行失败时撤销记录的修改：停止 Compose 服务、删除新加载的镜像和新建的文件和目录")
+	fs.BoolVar(&cfg.Cleanup, "cleanup", cfg.Cleanup, "运行成功后删除子目录中已处理的压缩文件，子目录为空时一并删除")
+	fs.BoolVar(&cfg.CleanupArchives, "cleanup-archives", cfg.CleanupArchives, "配合 -cleanup 使用，同时删除主Stub文件")
+	fs.BoolVar(&cfg.CleanupSubDirs, "cleanup-subdirs", cfg.CleanupSubDirs, "配合 -cleanup 使用，删除主Stub文件解压出的整个子目录，包括其中的普通文件；Compose 服务挂载了子目录中的文件时不要使用")
+	fs.BoolVar(&cfg.CleanupCorruptLoads, "cleanup-corrupt-loads", cfg.CleanupCorruptLoads, "镜像文件损坏导致加载失败时清理残留的镜像")
+	fs.BoolVar(&cfg.Relay.Enabled, "relay", cfg.Relay.Enabled, "中继模式：加载镜像后推送到中继仓库，不启动 Compose 和 Minio，除非指定 -relay-services")
+	fs.StringVar(&cfg.Relay.Registry, "relay-registry", cfg.Relay.Registry, "中继模式推送的目标仓库地址")
+	fs.StringVar(&cfg.Relay.Prefix, "relay-prefix", cfg.Relay.Prefix, "中继模式推送时添加的镜像名前缀")
+	fs.BoolVar(&cfg.Relay.Services, "relay-services", cfg.Relay.Services, "中继模式推送镜像后照常启动 Compose 服务，例如该节点同时运行服务")
+	fs.BoolVar(&cfg.Relay.RemoveLocal, "relay-remove-local", cfg.Relay.RemoveLocal, "中继模式推送镜像后删除本地镜像，镜像只保留在中继仓库中")
+	fs.StringVar(&cfg.Relay.ListFile, "relay-list-file", cfg.Relay.ListFile, "将本次运行推送到中继仓库的镜像引用写入该文件，格式与 images.txt 相同，供其他节点拉取")
+	fs.StringVar(&cfg.RegistryLogin.Server, "registry-server", cfg.RegistryLogin.Server, "拉取 images.txt 中的镜像前登录的仓库地址")
+	fs.StringVar(&cfg.RegistryLogin.Username, "registry-username", cfg.RegistryLogin.Username, "登录镜像仓库的用户名")
+	fs.StringVar(&cfg.RegistryLogin.Password, "registry-password", cfg.RegistryLogin.Password, "登录镜像仓库的密码")
+	fs.IntVar(&cfg.RuntimeUID, "runtime-uid", cfg.RuntimeUID, "容器运行用户的 UID，设置后检查解压文件是否可读，-1 表示不检查")
+	fs.IntVar(&cfg.RuntimeGID, "runtime-gid", cfg.RuntimeGID, "容器运行用户的 GID")
+	fs.Var((*stringsFlag)(&cfg.AllowedImageRepos), "allow-image-repo", "允许加载的镜像仓库，支持通配符，可重复指定；未指定时不限制")
+	fs.Var((*stringsFlag)(&cfg.Inputs), "input", "输入目录，支持通配符，可重复指定；未指定时使用当前目录")
+	fs.StringVar(&cfg.EventSocket, "event-socket", cfg.EventSocket, "实时发送运行事件的 Unix 套接字路径，为空时不发送")
+	fs.BoolVar(&cfg.RaiseFileLimit, "raise-file-limit", cfg.RaiseFileLimit, "启动时将文件描述符软限制提升到硬限制")
+	fs.StringVar(&cfg.MinioSecretKeySource.File, "minio-secret-file", cfg.MinioSecretKeySource.File, "从文件读取 Minio 访问密钥的 secret key")
+	fs.StringVar(&cfg.MinioSecretKeySource.Env, "minio-secret-env", cfg.MinioSecretKeySource.Env, "从指定环境变量读取 Minio 访问密钥的 secret key")
+	fs.StringVar(&cfg.MinioSecretKeySource.Command, "minio-secret-command", cfg.MinioSecretKeySource.Command, "执行命令并以其输出作为 Minio 访问密钥的 secret key")
+	fs.StringVar(&cfg.MinioUserPassSource.File, "minio-password-file", cfg.MinioUserPassSource.File, "从文件读取 Minio 用户密码")
+	fs.StringVar(&cfg.MinioUserPassSource.Env, "minio-password-env", cfg.MinioUserPassSource.Env, "从指定环境变量读取 Minio 用户密码")
+	fs.StringVar(&cfg.MinioUserPassSource.Command, "minio-password-command", cfg.MinioUserPassSource.Command, "执行命令并以其输出作为 Minio 用户密码")
+	fs.BoolVar(&cfg.Fingerprint, "fingerprint", cfg.Fingerprint, "计算并输出部署指纹，相同指纹表示完全相同的 Stub")
+	fs.StringVar(&cfg.FingerprintFile, "fingerprint-file", cfg.FingerprintFile, "将部署指纹写入指定文件，设置后同时启用 -fingerprint")
+	fs.DurationVar(&cfg.MinioReadyTimeout, "minio-ready-timeout", cfg.MinioReadyTimeout, "等待 Minio 服务就绪的最长时间")
+	fs.StringVar(&cfg.MinioHealthURL, "minio-health-url", cfg.MinioHealthURL, "Minio 的健康检查地址，为空时使用 -minio-endpoint 加上 "+minioHealthPath)
+	fs.BoolVar(&cfg.MinioSeedOverwrite, "minio-seed-overwrite", cfg.MinioSeedOverwrite, "上传 "+minioDataDir+" 中的初始数据时覆盖存储桶中已有的对象")
+	fs.BoolVar(&cfg.MinioSDK, "minio-sdk", cfg.MinioSDK, "通过 Minio SDK 直接连接 -minio-endpoint 等待就绪并创建存储桶，不使用容器中的 mc；访问密钥仍通过 mc 创建")
+	fs.DurationVar(&cfg.MinioSettleDelay, "minio-settle-delay", cfg.MinioSettleDelay, "Minio 健康检查通过后执行 mc admin 命令前额外等待的时间")
+	fs.BoolVar(&cfg.StartCompose, "start-compose", cfg.StartCompose, "处理完成后执行 docker compose up 启动服务")
+	fs.BoolFunc("no-compose", "不启动 Docker Compose 服务，等同于 -start-compose=false", func(string) error {
+		cfg.StartCompose = false
+		return nil
+	})
+	fs.StringVar(&cfg.ComposeCmd, "compose-cmd", cfg.ComposeCmd, "Compose 命令，例如 \"docker compose\" 或 docker-compose，未指定时自动检测")
+	fs.DurationVar(&cfg.ComposeHealthTimeout, "compose-health-timeout", cfg.ComposeHealthTimeout, "启动 Compose 后等待所有服务运行且健康检查通过的最长时间，为 0 时只检查一次")
+	fs.IntVar(&cfg.ComposeLogLines, "compose-log-lines", cfg.ComposeLogLines, "Compose 服务未就绪时输出的最后几行日志，为 0 时不输出")
+	fs.Func("wait-for", "启动 Compose 后等待就绪的服务，格式为 name=url，健康检查地址返回 2xx 时视为就绪，可重复指定", func(s string) error {
+		w, err := parseServiceWait(s)
+		if err != nil {
+			return err
+		}
+		cfg.WaitForServices = append(cfg.WaitForServices, w)
+		return nil
+	})
+	fs.DurationVar(&cfg.ServiceWaitTimeout, "service-wait-timeout", cfg.ServiceWaitTimeout, "等待每个 -wait-for 服务就绪的最长时间")
+	fs.StringVar(&cfg.ComposeFile, "compose-file", cfg.ComposeFile, "Compose 文件路径，未指定时使用 docker compose 的默认文件")
+	fs.StringVar(&cfg.ComposePullPolicy, "compose-pull", cfg.ComposePullPolicy, "compose up 的镜像拉取策略: missing、never 或 always")
+	fs.Func("command-prefix", "加在 tar 和 docker 命令前的前缀，以空格分隔，例如 \"nice -n 10 ionice -c 3\"", func(v string) error {
+		cfg.CommandPrefix = strings.Fields(v)
+		return nil
+	})
+	fs.BoolVar(&cfg.StrictPlatform, "strict-platform", cfg.StrictPlatform, "清单声明的目标平台与主机不一致时终止执行")
+	fs.StringVar(&cfg.TagClobber, "tag-clobber", cfg.TagClobber, "加载镜像覆盖已有镜像标签时的处理方式: proceed、warn 或 error")
+	fs.BoolFunc("no-clobber-tags", "加载镜像覆盖已有镜像标签时报错，等同于 -tag-clobber error", func(string) error {
+		cfg.TagClobber = clobberError
+		return nil
+	})
+	fs.BoolVar(&cfg.SkipExistingImages, "skip-existing", cfg.SkipExistingImages, "镜像文件中的标签都已存在时跳过 docker load")
+	fs.Int64Var(&cfg.MinFreeBytes, "min-free-bytes", cfg.MinFreeBytes, "解压主Stub文件后磁盘上至少保留的剩余空间(字节)")
+	fs.BoolVar(&cfg.SkipDiskCheck, "skip-disk-check", cfg.SkipDiskCheck, "解压前不检查剩余磁盘空间")
+	fs.BoolVar(&cfg.Preflight, "preflight", cfg.Preflight, "开始修改前检查磁盘空间、Docker 守护进程、端口和镜像架构，并一并报告所有失败")
+	fs.Func("preflight-ports", "预检时需要未被占用的端口，以逗号分隔，Compose 文件中发布的端口总是检查，默认为空", func(v string) error {
+		cfg.PreflightPorts = nil
+		for _, s := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' }) {
+			port, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return fmt.Errorf("端口 %s 无效", s)
+			}
+			cfg.PreflightPorts = append(cfg.PreflightPorts, port)
+		}
+		return nil
+	})
+	fs.BoolVar(&cfg.UseDockerSDK, "docker-sdk", cfg.UseDockerSDK, "通过 Docker SDK 直接调用守护进程加载、查询和删除镜像，不启动 Compose 且不登录、推送镜像时不需要 docker 命令")
+	fs.BoolVar(&cfg.VerifyChecksums, "verify", cfg.VerifyChecksums, "按同目录下的 .sha256 文件校验压缩文件，缺少校验和文件时报错")
+	fs.StringVar(&cfg.PreHook, "pre-hook", cfg.PreHook, "解压主 Stub 文件前通过 sh -c 运行的命令")
+	fs.StringVar(&cfg.PostHook, "post-hook", cfg.PostHook, "所有步骤成功后通过 sh -c 运行的命令，失败时整个运行失败")
+	fs.BoolVar(&cfg.Resume, "resume", cfg.Resume, "断点续跑：在 "+stateFileName+" 中记录已完成的子目录和文件，中断后再次运行时跳过；同时记录需要重试的文件，之后的运行延长其初始退避时间")
+	fs.StringVar(&cfg.Progress, "progress", cfg.Progress, "整体处理进度的输出方式，可选 auto、bar、log 或 off，auto 时标准错误为终端则显示进度条，否则定时输出日志")
+	fs.DurationVar(&cfg.ProgressInterval, "progress-interval", cfg.ProgressInterval, "以日志输出整体处理进度的间隔")
+	fs.BoolVar(&cfg.StreamOutput, "stream-output", cfg.StreamOutput, "将 tar、docker load 等长时间运行命令的输出逐行以 Debug 级别写入日志")
+	fs.IntVar(&cfg.MaxDepth, "max-depth", cfg.MaxDepth, "查找压缩文件的最大目录深度，1 表示只处理 Stub 根目录下的一级子目录")
+	fs.StringVar(&cfg.Arch, "arch", cfg.Arch, "加载镜像的目标架构，例如 arm64，默认为主机架构")
+	fs.StringVar(&cfg.ArchSuffix, "arch-suffix", cfg.ArchSuffix, "镜像文件名中的架构后缀格式，{arch} 为架构，为空时加载所有镜像文件")
+	fs.BoolVar(&cfg.Force, "force", cfg.Force, "工作目录中的 "+lockFileName+" 锁文件由本机已退出的进程残留时删除后继续，持有锁的进程仍在运行时不删除")
+	fs.BoolVar(&cfg.Restart, "restart", cfg.Restart, "忽略 "+stateFileName+" 中之前的处理进度从头开始")
+	fs.StringVar(&cfg.Report, "report", cfg.Report, "每次运行结束时将运行状态、各阶段和每个文件的处理结果、耗时、字节数以及加载的镜像以 JSON 格式写入指定文件，指定 -input 时分别写入各输入目录中的同名文件，为空时不写入")
+	fs.BoolVar(&cfg.DryRun, "dry-run", cfg.DryRun, "试运行：只打印将要执行的命令，不解压文件、不加载镜像、不修改 Minio")
+	fs.BoolVar(&cfg.Plan, "plan", cfg.Plan, "只读检查：列出已存在和将要加载的镜像以及 Compose 项目状态后退出，可配合 DOCKER_HOST 检查远程主机")
+	fs.BoolVar(&cfg.StagePhases, "stage-phases", cfg.StagePhases, "先解压所有子目录的文件，再统一加载镜像")
+	fs.BoolVar(&cfg.FilesOnly, "files-only", cfg.FilesOnly, "只解压文件，跳过所有 Docker 操作以及 Compose 和 Minio 配置")
+}
+
+// 可重复指定的字符串参数
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
@@ -0,0 +1,27 @@
+package setup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+)
+
+// 通过 sh -c 在工作目录中运行钩子命令，输出直接写到标准输出和标准错误
+func runHook(ctx context.Context, name, hook string, cfg *Config) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", hook)
+	cmd.Dir = cfg.WorkDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if dryRun(cmd, cfg, "hook", name) {
+		return nil
+	}
+
+	slog.Info("正在运行钩子命令", "hook", name, "command", hook)
+	if err := cfg.runner().Run(cmd); err != nil {
+		return fmt.Errorf("%s 钩子命令 %q 执行失败: %w", name, hook, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRunHooks(t *testing.T) {
+	tests := []struct {
+		name    string
+		failing string
+		wantErr bool
+		wantRun []string
+	}{
+		{name: "钩子都成功", wantRun: []string{"sh -c pre", "docker load", "sh -c post"}},
+		{name: "前置钩子失败", failing: "pre", wantErr: true, wantRun: []string{"sh -c pre"}},
+		{name: "加载失败时不运行后置钩子", failing: "load", wantErr: true, wantRun: []string{"sh -c pre", "docker load"}},
+		{name: "后置钩子失败", failing: "post", wantErr: true, wantRun: []string{"sh -c pre", "docker load", "sh -c post"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{respond: func(args []string) ([]byte, error) {
+				if slices.Contains(args, tt.failing) {
+					return nil, errors.New("exit status 1")
+				}
+				return loadedImages("app:1")(args)
+			}}
+			cfg := testConfig(t, runner)
+			cfg.Preflight = false
+			cfg.StartCompose = false
+			cfg.PreHook = "pre"
+			cfg.PostHook = "post"
+			writeTestStub(t, cfg, []testEntry{
+				{Name: "10-app/", Typeflag: tar.TypeDir},
+				{Name: "10-app/app.tar", Typeflag: tar.TypeReg, Body: "image"},
+			})
+
+			err := Run(context.Background(), cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var got []string
+			for _, call := range runner.calls {
+				if strings.HasPrefix(call, "sh -c ") || call == "docker load" {
+					got = append(got, call)
+				}
+			}
+			if !slices.Equal(got, tt.wantRun) {
+				t.Errorf("执行了 %q, want %q", got, tt.wantRun)
+			}
+		})
+	}
+}
+
+func TestRunHookWorkDir(t *testing.T) {
+	cfg := testConfig(t, &fakeRunner{})
+	cfg.Runner = nil
+
+	// 钩子命令在工作目录中运行
+	if err := runHook(context.Background(), "postHook", "echo ok > hook.txt", cfg); err != nil {
+		t.Fatalf("runHook() error = %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(cfg.WorkDir, "hook.txt")); err != nil || string(data) != "ok\n" {
+		t.Errorf("hook.txt = %q, %v, want ok", data, err)
+	}
+
+	if err := runHook(context.Background(), "postHook", "exit 3", cfg); err == nil || !strings.Contains(err.Error(), "postHook") {
+		t.Errorf("runHook() error = %v, want 注明失败的钩子", err)
+	}
+}
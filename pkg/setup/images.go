@@ -0,0 +1,419 @@
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// 镜像架构检查方式
+const (
+	archCheckOff   = "off"
+	archCheckWarn  = "warn"
+	archCheckError = "error"
+)
+
+// 从 docker load 的输出中解析已加载的镜像
+func parseLoadedImages(output []byte) []string {
+	var images []string
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if ref, ok := strings.CutPrefix(line, "Loaded image: "); ok {
+			images = append(images, strings.TrimSpace(ref))
+		} else if id, ok := strings.CutPrefix(line, "Loaded image ID: "); ok {
+			images = append(images, strings.TrimSpace(id))
+		}
+	}
+
+	return images
+}
+
+// 检查已加载镜像的架构是否与目标架构一致，未指定 Arch 时为主机架构
+func checkImageArch(ctx context.Context, images []string, sub subDirManifest, cfg *Config) error {
+	switch cfg.ArchCheck {
+	case archCheckOff:
+		return nil
+	case archCheckWarn, archCheckError:
+	default:
+		return fmt.Errorf("未知的镜像架构检查方式: %s", cfg.ArchCheck)
+	}
+
+	want := targetArch(cfg)
+	var mismatched []string
+	for _, image := range images {
+		arch, err := imageArch(ctx, image, sub, cfg)
+		if err != nil {
+			return err
+		}
+		if arch == want {
+			continue
+		}
+
+		slog.Warn("镜像架构与目标架构不一致", "image", image, "arch", arch, "targetArch", want)
+		mismatched = append(mismatched, fmt.Sprintf("%s(%s)", image, arch))
+	}
+
+	if len(mismatched) > 0 && cfg.ArchCheck == archCheckError {
+		return fmt.Errorf("镜像架构与目标架构 %s 不一致: %s", want, strings.Join(mismatched, ", "))
+	}
+
+	return nil
+}
+
+// 读取镜像 tar 文件 manifest.json 中声明的 RepoTags
+func readImageRepoTags(tarPath string) ([]string, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := archiveReader(f, tarPath)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := repoTagsFromTar(r)
+	if err != nil {
+		return nil, fmt.Errorf("镜像文件 %s: %w", tarPath, err)
+	}
+
+	return tags, nil
+}
+
+// 打开镜像文件作为 docker load 的输入，压缩的镜像文件在进程内解压，不依赖运行时对压缩格式的支持
+func openImageStream(filePath string) (io.Reader, io.Closer, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := archiveReader(f, filePath)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return r, f, nil
+}
+
+// 从镜像 tar 数据流中读取 manifest.json 声明的 RepoTags
+func repoTagsFromTar(r io.Reader) ([]string, error) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("没有 manifest.json")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取失败: %w", err)
+		}
+
+		if strings.TrimPrefix(hdr.Name, "./") != "manifest.json" {
+			continue
+		}
+
+		var entries []struct {
+			RepoTags []string
+		}
+		if err := json.NewDecoder(tr).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("解析 manifest.json 失败: %w", err)
+		}
+
+		var tags []string
+		for _, entry := range entries {
+			tags = append(tags, entry.RepoTags...)
+		}
+		return tags, nil
+	}
+}
+
+// 镜像文件损坏时 docker load 输出的特征
+var corruptLoadSignatures = []string{
+	"unexpected eof",
+	"invalid tar header",
+	"archive/tar",
+	"error processing tar file",
+	"invalid diffid",
+	"layer does not exist",
+	"digest mismatch",
+	"checksum",
+}
+
+// 匹配输出中的层标识，例如 sha256:<hex> 或 <hex>/layer.tar
+var layerPattern = regexp.MustCompile(`sha256:[0-9a-f]{64}|[0-9a-f]{64}/layer\.tar`)
+
+// 判断 docker load 失败是否由镜像文件损坏导致，并尽量给出出错的层
+func classifyCorruptLoad(output []byte) (layer string, corrupt bool) {
+	text := strings.ToLower(string(output))
+
+	for _, sig := range corruptLoadSignatures {
+		if strings.Contains(text, sig) {
+			return layerPattern.FindString(text), true
+		}
+	}
+
+	return "", false
+}
+
+// 清理损坏镜像文件加载时残留的镜像标签，失败时仅记录日志
+// before 为加载前的本地镜像标签，只删除加载后新出现或指向的镜像 ID 发生变化的标签，加载前已有的镜像保持不变
+func cleanupCorruptLoad(ctx context.Context, filePath string, before map[string]string, sub subDirManifest, cfg *Config) {
+	tags, err := readImageRepoTags(filePath)
+	if err != nil {
+		slog.Warn("无法确定损坏镜像文件对应的镜像，跳过清理", "file", filePath, "error", err)
+		return
+	}
+	after, err := localImageTags(ctx, sub, cfg)
+	if err != nil {
+		slog.Warn("无法列出本地镜像，跳过清理", "file", filePath, "error", err)
+		return
+	}
+
+	for _, tag := range tags {
+		if id, ok := after[tag]; !ok || before[tag] == id {
+			continue
+		}
+
+		if cfg.UseDockerSDK {
+			if err := removeImageSDK(ctx, tag, sub); err != nil {
+				slog.Debug("清理镜像失败", "image", tag, "error", err)
+				continue
+			}
+			slog.Info("已清理损坏镜像文件残留的镜像", "file", filePath, "image", tag)
+			continue
+		}
+
+		cmd := command(ctx, cfg, cfg.DockerCmd, dockerArgs(sub.DockerContext, "image", "rm", tag)...)
+		if output, err := cfg.runner().CombinedOutput(cmd); err != nil {
+			slog.Debug("清理镜像失败", "image", tag, "error", err, "output", string(output))
+			continue
+		}
+		slog.Info("已清理损坏镜像文件残留的镜像", "file", filePath, "image", tag)
+	}
+}
+
+// 生成 docker load 失败的错误信息，镜像文件损坏时按配置清理残留，before 为加载前的本地镜像标签
+func loadError(ctx context.Context, filePath string, output []byte, err error, before map[string]string, sub subDirManifest, cfg *Config) error {
+	layer, corrupt := classifyCorruptLoad(output)
+	if !corrupt {
+		return fmt.Errorf("docker load 命令失败: %w, 输出: %s", err, output)
+	}
+
+	if cfg.CleanupCorruptLoads {
+		cleanupCorruptLoad(ctx, filePath, before, sub, cfg)
+	}
+
+	if layer != "" {
+		return fmt.Errorf("镜像文件 %s 已损坏，出错的层为 %s: %w, 输出: %s", filePath, layer, err, output)
+	}
+	return fmt.Errorf("镜像文件 %s 已损坏: %w, 输出: %s", filePath, err, output)
+}
+
+// 去掉镜像引用中的标签和摘要，返回仓库名
+func imageRepo(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+
+	return ref
+}
+
+// 检查镜像引用的仓库是否在允许的仓库列表中，列表为空时不限制
+func repoAllowed(ref string, cfg *Config) bool {
+	if len(cfg.AllowedImageRepos) == 0 {
+		return true
+	}
+
+	repo := imageRepo(ref)
+	return slices.ContainsFunc(cfg.AllowedImageRepos, func(pattern string) bool {
+		ok, _ := path.Match(pattern, repo)
+		return ok
+	})
+}
+
+// 检查镜像文件中的镜像是否都在允许的仓库列表中，列表为空时不限制，tags 为镜像文件中的标签
+func checkImageAllowed(filePath string, tags []string, cfg *Config) error {
+	if len(cfg.AllowedImageRepos) == 0 {
+		return nil
+	}
+
+	if len(tags) == 0 {
+		return fmt.Errorf("镜像文件 %s 没有标签，无法确认是否允许加载", filePath)
+	}
+
+	var rejected []string
+	for _, tag := range tags {
+		if !repoAllowed(tag, cfg) {
+			rejected = append(rejected, tag)
+		}
+	}
+
+	if len(rejected) > 0 {
+		return fmt.Errorf("镜像文件 %s 包含不允许加载的镜像: %s", filePath, strings.Join(rejected, ", "))
+	}
+
+	return nil
+}
+
+// 镜像标签被覆盖时的处理方式
+const (
+	clobberProceed = "proceed"
+	clobberWarn    = "warn"
+	clobberError   = "error"
+)
+
+// 查询镜像的架构，UseDockerSDK 时通过 Docker SDK 查询
+func imageArch(ctx context.Context, ref string, sub subDirManifest, cfg *Config) (string, error) {
+	if cfg.UseDockerSDK {
+		info, err := inspectImageSDK(ctx, ref, sub)
+		if err != nil {
+			return "", fmt.Errorf("查询镜像 %s 失败: %w", ref, err)
+		}
+		return info.Architecture, nil
+	}
+
+	cmd := command(ctx, cfg, cfg.DockerCmd, dockerArgs(sub.DockerContext, "image", "inspect", "--format", "{{.Architecture}}", ref)...)
+	output, err := cfg.runner().CombinedOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("docker image inspect 命令失败: %w, 输出: %s", err, output)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// 查询镜像标签当前指向的镜像 ID，标签不存在时返回空字符串
+func imageID(ctx context.Context, ref string, sub subDirManifest, cfg *Config) string {
+	if cfg.UseDockerSDK {
+		info, err := inspectImageSDK(ctx, ref, sub)
+		if err != nil {
+			return ""
+		}
+		return info.ID
+	}
+
+	cmd := command(ctx, cfg, cfg.DockerCmd, dockerArgs(sub.DockerContext, "image", "inspect", "--format", "{{.Id}}", ref)...)
+	output, err := cfg.runner().Output(cmd)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(output))
+}
+
+// 列出本地所有镜像标签及其指向的镜像 ID，用于在加载前记录已有的标签而无需读取镜像文件
+func localImageTags(ctx context.Context, sub subDirManifest, cfg *Config) (map[string]string, error) {
+	if cfg.UseDockerSDK {
+		return listImageTagsSDK(ctx, sub)
+	}
+
+	cmd := command(ctx, cfg, cfg.DockerCmd, dockerArgs(sub.DockerContext, "image", "ls", "--no-trunc", "--format", "{{.Repository}}:{{.Tag}} {{.ID}}")...)
+	output, err := cfg.runner().Output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("列出本地镜像失败: %w", err)
+	}
+
+	tags := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		ref, id, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if ok && !strings.Contains(ref, "<none>") {
+			tags[ref] = id
+		}
+	}
+	return tags, nil
+}
+
+// 查询一组镜像标签当前指向的镜像 ID
+func imageIDs(ctx context.Context, refs []string, sub subDirManifest, cfg *Config) map[string]string {
+	ids := make(map[string]string, len(refs))
+	for _, ref := range refs {
+		ids[ref] = imageID(ctx, ref, sub, cfg)
+	}
+
+	return ids
+}
+
+// 检查镜像标签是否都已存在，没有标签时返回 false
+func imagesPresent(ctx context.Context, refs []string, sub subDirManifest, cfg *Config) bool {
+	if len(refs) == 0 {
+		return false
+	}
+
+	for _, ref := range refs {
+		if imageID(ctx, ref, sub, cfg) == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// 比较加载前后镜像标签指向的镜像 ID，找出被覆盖的标签
+func checkTagClobber(filePath string, before, after map[string]string, cfg *Config) error {
+	var clobbered []string
+	for ref, prev := range before {
+		// podman 等运行时列出的镜像 ID 可能不带 sha256: 前缀
+		if prev == "" || strings.TrimPrefix(prev, "sha256:") == strings.TrimPrefix(after[ref], "sha256:") {
+			continue
+		}
+
+		slog.Warn("加载镜像覆盖了已有的镜像标签", "file", filePath, "image", ref, "previous", prev, "current", after[ref])
+		clobbered = append(clobbered, ref)
+	}
+
+	if len(clobbered) > 0 && cfg.TagClobber == clobberError {
+		slices.Sort(clobbered)
+		return fmt.Errorf("镜像文件 %s 覆盖了已有的镜像标签: %s", filePath, strings.Join(clobbered, ", "))
+	}
+
+	return nil
+}
+
+// 子目录中列出预期镜像的文件，每行一个 repo:tag
+const expectedImagesName = "expected-images.txt"
+
+// 核对子目录中加载和拉取的镜像与 expected-images.txt 是否一致，文件不存在时不检查
+func checkExpectedImages(subDirPath string, loaded []string) error {
+	expected, err := readImageList(filepath.Join(subDirPath, expectedImagesName))
+	if err != nil {
+		return err
+	}
+	if expected == nil {
+		return nil
+	}
+
+	var missing, unexpected []string
+	for _, ref := range expected {
+		if !slices.Contains(loaded, ref) {
+			missing = append(missing, ref)
+		}
+	}
+	for _, ref := range loaded {
+		if !slices.Contains(expected, ref) && !slices.Contains(unexpected, ref) {
+			unexpected = append(unexpected, ref)
+		}
+	}
+	if len(missing) == 0 && len(unexpected) == 0 {
+		return nil
+	}
+
+	slices.Sort(loaded)
+	details := []string{"预期: " + strings.Join(expected, ", "), "实际: " + strings.Join(loaded, ", ")}
+	if len(missing) > 0 {
+		details = append(details, "缺少: "+strings.Join(missing, ", "))
+	}
+	if len(unexpected) > 0 {
+		details = append(details, "多出: "+strings.Join(unexpected, ", "))
+	}
+	return fmt.Errorf("已加载的镜像与 %s 不一致，%s", expectedImagesName, strings.Join(details, "，"))
+}
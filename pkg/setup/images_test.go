@@ -0,0 +1,84 @@
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCleanupCorruptLoad(t *testing.T) {
+	const layer = "sha256:" + "ab12ab12ab12ab12ab12ab12ab12ab12ab12ab12ab12ab12ab12ab12ab12ab12"
+	filePath := writeTestTar(t, "app.tar", []testEntry{
+		{Name: "manifest.json", Typeflag: tar.TypeReg, Body: `[{"Config":"c.json","RepoTags":["app:1","app:2","app:3"]}]`},
+	})
+
+	// 加载前已有 app:1 和 app:3，损坏的镜像文件加载了一部分，新增了 app:2 并覆盖了 app:3
+	listings := []string{
+		"app:1 sha256:old1\napp:3 sha256:old3\n",
+		"app:1 sha256:old1\napp:2 sha256:new2\napp:3 sha256:new3\n",
+	}
+	runner := &fakeRunner{respond: func(args []string) ([]byte, error) {
+		switch {
+		case slices.Contains(args, "load"):
+			return []byte("Error processing tar file(exit status 1): unexpected EOF while reading " + layer), errors.New("exit status 1")
+		case slices.Contains(args, "ls"):
+			listing := listings[0]
+			listings = listings[1:]
+			return []byte(listing), nil
+		}
+		return nil, nil
+	}}
+	cfg := testConfig(t, runner)
+	cfg.CleanupCorruptLoads = true
+
+	_, err := loadImage(context.Background(), filePath, subDirManifest{}, cfg)
+	if err == nil || !strings.Contains(err.Error(), "已损坏") || !strings.Contains(err.Error(), layer) {
+		t.Fatalf("loadImage() error = %v, want 镜像文件已损坏并给出出错的层", err)
+	}
+
+	var removed []string
+	for _, call := range runner.called("docker image rm ") {
+		removed = append(removed, strings.TrimPrefix(call, "docker image rm "))
+	}
+	if want := []string{"app:2", "app:3"}; !slices.Equal(removed, want) {
+		t.Errorf("清理了 %v, want %v，加载前已有且没有变化的 app:1 应保留", removed, want)
+	}
+}
+
+func TestSkipExistingImagesRelay(t *testing.T) {
+	filePath := writeTestTar(t, "app.tar", []testEntry{
+		{Name: "manifest.json", Typeflag: tar.TypeReg, Body: `[{"Config":"c.json","RepoTags":["app:1"]}]`},
+	})
+
+	// 镜像都已存在
+	runner := &fakeRunner{respond: func(args []string) ([]byte, error) {
+		if slices.Contains(args, "inspect") {
+			return []byte("sha256:app\n"), nil
+		}
+		return nil, nil
+	}}
+	cfg := testConfig(t, runner)
+	cfg.SkipExistingImages = true
+	cfg.Relay = RelayConfig{Enabled: true, Registry: "relay.example.com"}
+
+	if _, err := loadImage(context.Background(), filePath, subDirManifest{}, cfg); err != nil {
+		t.Fatalf("loadImage() error = %v", err)
+	}
+	if err := pullImage(context.Background(), "db:2", subDirManifest{}, cfg); err != nil {
+		t.Fatalf("pullImage() error = %v", err)
+	}
+
+	if got := runner.called("docker load"); len(got) > 0 {
+		t.Errorf("镜像已存在时执行了 %q", got)
+	}
+	if got := runner.called("docker pull"); len(got) > 0 {
+		t.Errorf("镜像已存在时执行了 %q", got)
+	}
+	want := []string{"docker push relay.example.com/app:1", "docker push relay.example.com/db:2"}
+	if got := runner.called("docker push"); !slices.Equal(got, want) {
+		t.Errorf("推送了 %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package setup
+
+import (
+	"log/slog"
+	"runtime"
+)
+
+// 自动并发任务数的上限，避免并发的 docker load 压垮 Docker 守护进程
+const maxAutoConcurrency = 8
+
+// 根据 CPU 核数计算自动并发任务数
+func autoConcurrency(numCPU int) int {
+	return max(1, min(numCPU, maxAutoConcurrency))
+}
+
+// ConcurrentTasks 小于等于 0 时按 CPU 核数自动计算，正数时按配置
+func resolveConcurrency(cfg *Config) {
+	if cfg.ConcurrentTasks > 0 {
+		return
+	}
+
+	cfg.ConcurrentTasks = autoConcurrency(runtime.NumCPU())
+	slog.Info("按 CPU 核数自动设置并发任务数", "concurrentTasks", cfg.ConcurrentTasks, "numCPU", runtime.NumCPU())
+}
+
+// 估算文件描述符占用：进程自身预留数量和每个并发任务的占用数量
+const (
+	reservedFiles = 64
+	filesPerTask  = 32
+)
+
+// 根据文件描述符软限制计算可用的并发任务数，至少为 1
+func concurrencyForFileLimit(tasks int, soft uint64) int {
+	if soft <= reservedFiles {
+		return 1
+	}
+
+	allowed := int((soft - reservedFiles) / filesPerTask)
+	return max(1, min(tasks, allowed))
+}
+
+// 按配置尝试将文件描述符软限制提升到硬限制，无法提升时降低并发任务数
+func adjustFileLimit(cfg *Config) {
+	soft, hard, ok := fileLimit()
+	if !ok {
+		return
+	}
+
+	if cfg.RaiseFileLimit && soft < hard {
+		if err := setFileLimit(hard); err != nil {
+			slog.Warn("提升文件描述符限制失败", "soft", soft, "hard", hard, "error", err)
+		} else {
+			soft = hard
+		}
+	}
+
+	tasks := concurrencyForFileLimit(cfg.ConcurrentTasks, soft)
+	if tasks < cfg.ConcurrentTasks {
+		slog.Warn("文件描述符限制不足，降低并发任务数", "from", cfg.ConcurrentTasks, "to", tasks)
+		cfg.ConcurrentTasks = tasks
+	}
+
+	slog.Info("文件描述符限制", "limit", soft, "concurrentTasks", cfg.ConcurrentTasks)
+}
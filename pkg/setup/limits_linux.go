@@ -0,0 +1,26 @@
+//go:build linux
+
+package setup
+
+import "syscall"
+
+// 获取文件描述符的软限制和硬限制
+func fileLimit() (soft, hard uint64, ok bool) {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return 0, 0, false
+	}
+
+	return rlim.Cur, rlim.Max, true
+}
+
+// 设置文件描述符的软限制
+func setFileLimit(soft uint64) error {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return err
+	}
+
+	rlim.Cur = soft
+	return syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlim)
+}
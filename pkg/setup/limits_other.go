@@ -0,0 +1,15 @@
+//go:build !linux
+
+package setup
+
+import "errors"
+
+// 当前平台不检查文件描述符限制
+func fileLimit() (soft, hard uint64, ok bool) {
+	return 0, 0, false
+}
+
+// 当前平台不支持设置文件描述符限制
+func setFileLimit(soft uint64) error {
+	return errors.New("当前平台不支持设置文件描述符限制")
+}
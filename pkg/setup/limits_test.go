@@ -0,0 +1,69 @@
+package setup
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestAutoConcurrency(t *testing.T) {
+	tests := []struct {
+		numCPU int
+		want   int
+	}{
+		{numCPU: 0, want: 1},
+		{numCPU: 1, want: 1},
+		{numCPU: 4, want: 4},
+		{numCPU: maxAutoConcurrency, want: maxAutoConcurrency},
+		{numCPU: 64, want: maxAutoConcurrency},
+	}
+
+	for _, tt := range tests {
+		if got := autoConcurrency(tt.numCPU); got != tt.want {
+			t.Errorf("autoConcurrency(%d) = %d, want %d", tt.numCPU, got, tt.want)
+		}
+	}
+}
+
+func TestResolveConcurrency(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks int
+		want  int
+	}{
+		{name: "自动", tasks: 0, want: autoConcurrency(runtime.NumCPU())},
+		{name: "负数时自动", tasks: -1, want: autoConcurrency(runtime.NumCPU())},
+		{name: "指定的并发数", tasks: 3, want: 3},
+		{name: "指定的并发数不受自动上限限制", tasks: 32, want: 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.ConcurrentTasks = tt.tasks
+
+			resolveConcurrency(cfg)
+			if cfg.ConcurrentTasks != tt.want {
+				t.Errorf("ConcurrentTasks = %d, want %d", cfg.ConcurrentTasks, tt.want)
+			}
+		})
+	}
+}
+
+func TestConcurrencyForFileLimit(t *testing.T) {
+	tests := []struct {
+		tasks int
+		soft  uint64
+		want  int
+	}{
+		{tasks: 8, soft: 1024, want: 8},
+		{tasks: 8, soft: reservedFiles + 2*filesPerTask, want: 2},
+		{tasks: 8, soft: reservedFiles, want: 1},
+		{tasks: 8, soft: 16, want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := concurrencyForFileLimit(tt.tasks, tt.soft); got != tt.want {
+			t.Errorf("concurrencyForFileLimit(%d, %d) = %d, want %d", tt.tasks, tt.soft, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package setup
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// 在 Stub 文件中查找包含指定镜像引用的镜像文件
+func findImageFile(summary *stubSummary, ref string) (string, bool) {
+	files := make([]string, 0, len(summary.Tags))
+	for file := range summary.Tags {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		if slices.Contains(summary.Tags[file], ref) {
+			return file, true
+		}
+	}
+
+	return "", false
+}
+
+// load-image 子命令：只从 Stub 文件中解压并加载包含指定镜像引用的镜像文件
+func runLoadImage(ctx context.Context, args []string, cfg *Config) error {
+	fs := flag.NewFlagSet("load-image", flag.ExitOnError)
+	ref := fs.String("ref", "", "要加载的镜像引用，例如 repo:tag")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: setup load-image -ref repo:tag")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *ref == "" {
+		fs.Usage()
+		return fmt.Errorf("load-image 需要指定 -ref")
+	}
+
+	// 只加载镜像，不启动 Compose
+	cfg.StartCompose = false
+	if err := checkDependencies(ctx, cfg); err != nil {
+		return withCategory(ErrDependencyMissing, err)
+	}
+
+	cwd, err := filepath.Abs(cfg.WorkDir)
+	if err != nil {
+		return fmt.Errorf("获取当前工作目录失败: %w", err)
+	}
+
+	stubTar := filepath.Join(cwd, cfg.StubTarName)
+	if _, err := os.Stat(stubTar); os.IsNotExist(err) {
+		return fmt.Errorf("STUB 文件不存在: %w", err)
+	}
+
+	summary, err := summarizeStub(stubTar)
+	if err != nil {
+		return err
+	}
+
+	member, ok := findImageFile(summary, *ref)
+	if !ok {
+		return fmt.Errorf("STUB 文件中没有镜像文件包含 %s", *ref)
+	}
+
+	if err := extractTar(ctx, stubTar, cwd, cfg, member); err != nil {
+		return withCategory(ErrExtractFailed, fmt.Errorf("解压镜像文件 %s 失败: %w", member, err))
+	}
+
+	m, err := loadManifest(filepath.Join(cwd, cfg.ManifestName))
+	if err != nil {
+		return err
+	}
+
+	if _, err := loadImage(ctx, filepath.Join(cwd, member), m.subDir(path.Dir(member)), cfg); err != nil {
+		return withCategory(ErrDockerLoadFailed, err)
+	}
+
+	slog.Info("镜像加载完成", "image", *ref, "file", member)
+	return nil
+}
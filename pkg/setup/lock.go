@@ -0,0 +1,97 @@
+package setup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 防止同一目录中同时运行多个 setup 的锁文件，位于工作目录中
+const lockFileName = ".setup.lock"
+
+// 锁文件内容，用于判断持有锁的进程
+type lockInfo struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// 在工作目录中创建锁文件，已被其他进程持有时报错
+// force 时只删除残留的锁文件，即由本机已退出的进程创建的锁文件，持有锁的进程仍在运行或位于其他主机时同样报错
+// 返回释放锁的函数，只在锁文件仍属于当前进程时删除
+func acquireLock(cwd string, force bool) (func(), error) {
+	path := filepath.Join(cwd, lockFileName)
+	host, _ := os.Hostname()
+	info := lockInfo{PID: os.Getpid(), Host: host, StartedAt: time.Now()}
+
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			err = json.NewEncoder(f).Encode(info)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("写入锁文件失败: %w", err)
+			}
+
+			return func() {
+				if held := readLock(path); held.PID != info.PID || held.Host != info.Host {
+					slog.Warn("锁文件已不属于当前进程，不删除", "file", path, "pid", held.PID, "host", held.Host)
+					return
+				}
+				if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+					slog.Warn("删除锁文件失败", "file", path, "error", err)
+				}
+			}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("创建锁文件失败: %w", err)
+		}
+
+		held := readLock(path)
+		if !force || !held.stale(host) {
+			return nil, lockHeldError(path, held, host)
+		}
+
+		slog.Warn("删除残留的锁文件", "file", path, "pid", held.PID, "host", held.Host, "startedAt", held.StartedAt)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("删除锁文件失败: %w", err)
+		}
+		force = false
+	}
+}
+
+// 读取锁文件，内容无效时返回零值
+func readLock(path string) lockInfo {
+	var info lockInfo
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &info)
+	}
+
+	return info
+}
+
+// 锁文件是否为残留的锁文件：由本机已退出的进程创建，内容无效或由其他主机创建时无法判断
+func (l lockInfo) stale(host string) bool {
+	return l.PID != 0 && l.Host == host && !processAlive(l.PID)
+}
+
+// 锁已被持有时的错误，持有锁的进程已不存在时提示可能是残留的锁文件
+func lockHeldError(path string, held lockInfo, host string) error {
+	if held.PID == 0 {
+		return fmt.Errorf("另一个 setup 正在运行：锁文件 %s 已存在但内容无效，确认没有其他 setup 运行后手动删除", path)
+	}
+	if held.stale(host) {
+		return fmt.Errorf("锁文件 %s 由已退出的进程 %d 于 %s 创建，可能是残留的锁文件，可使用 -force 删除",
+			path, held.PID, held.StartedAt.Format(time.RFC3339))
+	}
+
+	return fmt.Errorf("另一个 setup 正在运行：进程 %d(%s) 于 %s 开始运行，锁文件 %s",
+		held.PID, held.Host, held.StartedAt.Format(time.RFC3339), path)
+}
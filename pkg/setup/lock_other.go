@@ -0,0 +1,8 @@
+//go:build !unix
+
+package setup
+
+// 无法判断进程是否存在时视为存在
+func processAlive(pid int) bool {
+	return true
+}
@@ -0,0 +1,64 @@
+package setup
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 以指定进程的名义写入锁文件
+func writeLock(t *testing.T, cwd string, info lockInfo) {
+	t.Helper()
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cwd, lockFileName), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireLockConcurrent(t *testing.T) {
+	cwd := t.TempDir()
+	unlock, err := acquireLock(cwd, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 持有锁的进程仍在运行时拒绝第二次运行，force 也不能删除
+	for _, force := range []bool{false, true} {
+		if second, err := acquireLock(cwd, force); err == nil {
+			second()
+			t.Fatalf("acquireLock(force=%v) 在锁被持有时成功", force)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cwd, lockFileName)); err != nil {
+		t.Fatalf("锁文件被删除: %v", err)
+	}
+
+	unlock()
+	if _, err := os.Stat(filepath.Join(cwd, lockFileName)); !os.IsNotExist(err) {
+		t.Errorf("释放后锁文件仍存在: %v", err)
+	}
+}
+
+func TestReleaseKeepsOtherLock(t *testing.T) {
+	cwd := t.TempDir()
+	unlock, err := acquireLock(cwd, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 锁文件已被其他进程重新创建时释放不删除它
+	host, _ := os.Hostname()
+	other := lockInfo{PID: os.Getpid() + 1, Host: host, StartedAt: time.Now()}
+	writeLock(t, cwd, other)
+	unlock()
+
+	if held := readLock(filepath.Join(cwd, lockFileName)); held.PID != other.PID {
+		t.Errorf("释放时删除了其他进程的锁文件，锁文件为 %+v", held)
+	}
+}
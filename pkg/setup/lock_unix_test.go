@@ -0,0 +1,52 @@
+//go:build unix
+
+package setup
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireLockStale(t *testing.T) {
+	// 已退出的进程
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip("无法运行 true:", err)
+	}
+	host, _ := os.Hostname()
+
+	tests := []struct {
+		name    string
+		held    lockInfo
+		force   bool
+		wantErr bool
+	}{
+		{name: "残留的锁文件需要 force", held: lockInfo{PID: cmd.Process.Pid, Host: host}, wantErr: true},
+		{name: "force 删除残留的锁文件", held: lockInfo{PID: cmd.Process.Pid, Host: host}, force: true},
+		{name: "其他主机的锁文件", held: lockInfo{PID: cmd.Process.Pid, Host: host + "-other"}, force: true, wantErr: true},
+		{name: "内容无效的锁文件", held: lockInfo{}, force: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cwd := t.TempDir()
+			tt.held.StartedAt = time.Now()
+			writeLock(t, cwd, tt.held)
+
+			unlock, err := acquireLock(cwd, tt.force)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("acquireLock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if held := readLock(filepath.Join(cwd, lockFileName)); held.PID != os.Getpid() {
+				t.Errorf("锁文件为 %+v, want 当前进程", held)
+			}
+			unlock()
+		})
+	}
+}
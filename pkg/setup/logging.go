@@ -0,0 +1,65 @@
+package setup
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// 日志格式
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// 按配置的格式和级别创建日志处理器，日志中的密钥会被隐藏
+func newLogHandler(w io.Writer, cfg *Config) (slog.Handler, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return nil, fmt.Errorf("未知的日志级别: %s，可选 debug、info、warn 或 error", cfg.LogLevel)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: cfg.session.redactor.redactAttr,
+	}
+
+	var handler slog.Handler
+	switch cfg.LogFormat {
+	case logFormatText:
+		handler = slog.NewTextHandler(w, opts)
+	case logFormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("未知的日志格式: %s，可选 text 或 json", cfg.LogFormat)
+	}
+
+	// 每条日志都带上运行 ID，便于在日志系统中关联同一次运行
+	if cfg.RunID != "" {
+		handler = handler.WithAttrs([]slog.Attr{slog.String("runID", cfg.RunID)})
+	}
+	return handler, nil
+}
+
+// 日志的输出目标，指定 LogFile 时同时追加写入该文件，返回的函数关闭日志文件
+func logOutput(w io.Writer, cfg *Config) (io.Writer, func(), error) {
+	if cfg.LogFile == "" {
+		return w, func() {}, nil
+	}
+
+	f, err := os.OpenFile(cfg.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开日志文件失败: %w", err)
+	}
+	return io.MultiWriter(w, f), func() { f.Close() }, nil
+}
+
+// 生成随机的运行 ID
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,162 @@
+package setup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Stub 清单文件，位于解压后的 Stub 根目录，可选
+type manifest struct {
+	Platform *platform                 `json:"platform,omitempty"`
+	SubDirs  map[string]subDirManifest `json:"subdirs,omitempty"`
+}
+
+// Stub 的目标平台，字段为空表示不限制
+type platform struct {
+	OS   string `json:"os,omitempty"`
+	Arch string `json:"arch,omitempty"`
+}
+
+// 单个子目录的清单配置
+type subDirManifest struct {
+	DockerContext string `json:"dockerContext,omitempty"`
+	ExtractTarget string `json:"extractTarget,omitempty"`
+}
+
+// 读取清单文件，文件不存在时返回空清单
+func loadManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &manifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取清单文件失败: %w", err)
+	}
+
+	return parseManifest(data, path)
+}
+
+// 解析清单文件内容，name 用于错误信息
+func parseManifest(data []byte, name string) (*manifest, error) {
+	var m manifest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("解析清单文件 %s 失败: %w", name, err)
+	}
+
+	return &m, nil
+}
+
+// 获取子目录的清单配置
+func (m *manifest) subDir(name string) subDirManifest {
+	return m.SubDirs[name]
+}
+
+// 清单中引用的所有 Docker 上下文
+func (m *manifest) dockerContexts() []string {
+	seen := make(map[string]bool)
+	var contexts []string
+	for _, sub := range m.SubDirs {
+		if sub.DockerContext != "" && !seen[sub.DockerContext] {
+			seen[sub.DockerContext] = true
+			contexts = append(contexts, sub.DockerContext)
+		}
+	}
+	sort.Strings(contexts)
+
+	return contexts
+}
+
+// 构造 docker 命令参数，指定上下文时添加 --context
+func dockerArgs(dockerContext string, args ...string) []string {
+	if dockerContext == "" {
+		return args
+	}
+
+	return append([]string{"--context", dockerContext}, args...)
+}
+
+// 检查清单中引用的 Docker 上下文是否存在
+func checkDockerContexts(ctx context.Context, m *manifest, cfg *Config) error {
+	if contexts := m.dockerContexts(); len(contexts) > 0 && !runtimes[cfg.Runtime].contexts {
+		return fmt.Errorf("容器运行时 %s 不支持清单中的 Docker 上下文: %s", cfg.Runtime, strings.Join(contexts, ", "))
+	}
+
+	for _, name := range m.dockerContexts() {
+		cmd := command(ctx, cfg, cfg.DockerCmd, "context", "inspect", name)
+		if output, err := cfg.runner().CombinedOutput(cmd); err != nil {
+			return fmt.Errorf("Docker 上下文 %s 不存在: %w, 输出: %s", name, err, output)
+		}
+	}
+
+	return nil
+}
+
+// 判断 p 是否位于 root 目录内(含 root 本身)
+func isWithin(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// 检查清单中声明的解压目标目录是否在允许范围内
+func checkExtractTargets(m *manifest, cfg *Config) error {
+	var errs []error
+	for name, sub := range m.SubDirs {
+		if sub.ExtractTarget == "" {
+			continue
+		}
+
+		if !filepath.IsAbs(sub.ExtractTarget) {
+			errs = append(errs, fmt.Errorf("子目录 %s 的解压目标 %s 不是绝对路径", name, sub.ExtractTarget))
+			continue
+		}
+
+		target := filepath.Clean(sub.ExtractTarget)
+		allowed := slices.ContainsFunc(cfg.AllowedExtractRoots, func(root string) bool {
+			return isWithin(filepath.Clean(root), target)
+		})
+		if !allowed {
+			errs = append(errs, fmt.Errorf("子目录 %s 的解压目标 %s 不在允许的目录中", name, target))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("检查解压目标失败: %w", errorList(errs))
+	}
+
+	return nil
+}
+
+// 检查清单声明的目标平台是否与主机一致，不一致时警告，strict 模式下返回错误
+func checkPlatform(m *manifest, cfg *Config) error {
+	if m.Platform == nil {
+		return nil
+	}
+
+	osMatch := m.Platform.OS == "" || m.Platform.OS == runtime.GOOS
+	archMatch := m.Platform.Arch == "" || m.Platform.Arch == runtime.GOARCH
+	if osMatch && archMatch {
+		return nil
+	}
+
+	if cfg.StrictPlatform {
+		return fmt.Errorf("Stub 的目标平台 %s/%s 与主机 %s/%s 不一致", m.Platform.OS, m.Platform.Arch, runtime.GOOS, runtime.GOARCH)
+	}
+
+	slog.Warn("Stub 的目标平台与主机不一致", "os", m.Platform.OS, "arch", m.Platform.Arch, "hostOS", runtime.GOOS, "hostArch", runtime.GOARCH)
+	return nil
+}
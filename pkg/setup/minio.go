@@ -0,0 +1,418 @@
+package setup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// mc 命令错误类型
+type mcErrorKind int
+
+const (
+	mcErrorFatal    mcErrorKind = iota // 无法恢复的错误
+	mcErrorRace                        // 并发竞争导致的暂时性错误，可重试
+	mcErrorConflict                    // 资源已存在，视为成功
+)
+
+// 并发竞争错误的特征
+var mcRaceSignatures = []string{
+	"operation in progress",
+	"another operation is in progress",
+	"resource busy",
+	"try again",
+	"please retry",
+	"operationaborted",
+}
+
+// 资源已存在错误的特征
+var mcConflictSignatures = []string{
+	"already exists",
+	"bucketalreadyownedbyyou",
+	"bucketalreadyexists",
+	"you already own it",
+}
+
+// 根据 mc 命令输出判断错误类型
+func classifyMcError(output []byte) mcErrorKind {
+	text := strings.ToLower(string(output))
+
+	for _, sig := range mcConflictSignatures {
+		if strings.Contains(text, sig) {
+			return mcErrorConflict
+		}
+	}
+
+	for _, sig := range mcRaceSignatures {
+		if strings.Contains(text, sig) {
+			return mcErrorRace
+		}
+	}
+
+	return mcErrorFatal
+}
+
+// 在 Minio 容器中执行 mc 命令，失败时按 MaxRetries 重试
+func runMcCommand(ctx context.Context, cfg *Config, args ...string) error {
+	name := strings.Join(args[:min(2, len(args))], " ")
+	return retry(ctx, cfg, "mc "+name, func(ctx context.Context) error {
+		return runMcOnce(ctx, cfg, args...)
+	})
+}
+
+// 执行一次 mc 命令，并发竞争时退避重试，资源已存在时视为成功
+func runMcOnce(ctx context.Context, cfg *Config, args ...string) error {
+	// 使用子命令作为日志和错误信息中的名称，例如 "alias set"
+	name := strings.Join(args[:min(2, len(args))], " ")
+	backoff := cfg.MinioRaceBackoff
+
+	for attempt := 0; ; attempt++ {
+		cmd := cfg.runtime().Exec(ctx, cfg.MinioContainer, append([]string{"mc"}, args...), cfg)
+		if dryRun(cmd, cfg) {
+			return nil
+		}
+		output, err := cfg.runner().CombinedOutput(cmd)
+		if err == nil {
+			return nil
+		}
+
+		switch classifyMcError(output) {
+		case mcErrorConflict:
+			slog.Info("Minio 资源已存在，跳过", "command", name)
+			return nil
+		case mcErrorRace:
+			if attempt < cfg.MinioRaceRetries {
+				slog.Warn("Minio 操作发生并发竞争，稍后重试", "command", name, "attempt", attempt+1, "backoff", backoff)
+				if err := sleepContext(ctx, backoff); err != nil {
+					return fmt.Errorf("minio %s 命令失败: %w", name, err)
+				}
+				backoff *= 2
+				continue
+			}
+		}
+
+		return fmt.Errorf("minio %s 命令失败: %w, 输出: %s", name, err, cfg.session.redactor.redact(string(output)))
+	}
+}
+
+// 等待 Minio 就绪时的重试间隔
+const minioReadyInterval = time.Second
+
+// 每秒重试 mc 命令直到成功，用于等待 Minio 服务就绪，最长等待 MinioReadyTimeout
+func waitMinioReady(ctx context.Context, cfg *Config, args ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.MinioReadyTimeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		err := runMcOnce(ctx, cfg, args...)
+		if err == nil {
+			return nil
+		}
+
+		slog.Debug("Minio 尚未就绪，稍后重试", "attempt", attempt, "error", err)
+		if sleepErr := sleepContext(ctx, minioReadyInterval); sleepErr != nil {
+			return fmt.Errorf("等待Minio就绪超时: %w", err)
+		}
+	}
+}
+
+// 等待指定时间，上下文取消时提前返回
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// 在 Minio 容器中执行 mc 命令并返回输出，用于查询当前状态
+func mcOutput(ctx context.Context, cfg *Config, args ...string) ([]byte, error) {
+	cmd := cfg.runtime().Exec(ctx, cfg.MinioContainer, append([]string{"mc"}, args...), cfg)
+	if dryRun(cmd, cfg) {
+		return nil, errDryRun
+	}
+	return cfg.runner().Output(cmd)
+}
+
+// 解析 mc --json 输出，每行一个 JSON 对象
+func decodeMcJSON(output []byte) []map[string]any {
+	var objects []map[string]any
+	dec := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var obj map[string]any
+		if err := dec.Decode(&obj); err != nil {
+			break
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects
+}
+
+// 检查 Minio 别名是否已按当前配置设置，地址、用户和密码都一致时才不需要重新设置
+// 旧版本 mc 的输出中没有 secretKey，此时总是重新设置
+func minioAliasConfigured(ctx context.Context, cfg *Config) bool {
+	output, err := mcOutput(ctx, cfg, "alias", "list", cfg.MinioAlias, "--json")
+	if err != nil {
+		return false
+	}
+
+	for _, obj := range decodeMcJSON(output) {
+		if obj["status"] == "success" && obj["URL"] == cfg.MinioEndpoint && obj["accessKey"] == cfg.MinioUser && obj["secretKey"] == cfg.MinioUserPass {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 查询 Minio 用户已有的访问密钥，查询失败时返回空集合
+func minioAccessKeys(ctx context.Context, cfg *Config) map[string]bool {
+	keys := make(map[string]bool)
+
+	output, err := mcOutput(ctx, cfg, "admin", "accesskey", "ls", cfg.MinioAlias, cfg.MinioUser, "--json")
+	if err != nil {
+		slog.Debug("查询Minio访问密钥失败", "error", err)
+		return keys
+	}
+
+	// 不同版本的 mc 输出结构不同，收集所有名为 accessKey 的字段
+	var collect func(v any)
+	collect = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, item := range v {
+				if s, ok := item.(string); ok && k == "accessKey" {
+					keys[s] = true
+				} else {
+					collect(item)
+				}
+			}
+		case []any:
+			for _, item := range v {
+				collect(item)
+			}
+		}
+	}
+	for _, obj := range decodeMcJSON(output) {
+		collect(obj)
+	}
+
+	return keys
+}
+
+// 需要创建的 Minio 存储桶，Policy 为匿名访问策略，为空时不设置
+type MinioBucket struct {
+	Name       string `yaml:"name"`
+	Policy     string `yaml:"policy"`
+	Versioning bool   `yaml:"versioning"`
+}
+
+// mc anonymous set 支持的匿名访问策略
+var minioBucketPolicies = []string{"none", "download", "upload", "public"}
+
+// 解析 name[:policy] 格式的存储桶参数
+func parseMinioBucket(s string) (MinioBucket, error) {
+	name, rest, _ := strings.Cut(s, ":")
+	if name == "" {
+		return MinioBucket{}, fmt.Errorf("存储桶名称为空")
+	}
+
+	policy, versioning, _ := strings.Cut(rest, ":")
+	if versioning != "" && versioning != "versioning" {
+		return MinioBucket{}, fmt.Errorf("存储桶 %s 的选项 %s 无效，应为 versioning", name, versioning)
+	}
+
+	return MinioBucket{Name: name, Policy: policy, Versioning: versioning != ""}, nil
+}
+
+// Minio 中已有存储桶的匿名访问策略和版本控制状态
+type minioBucketState struct {
+	policy     string
+	versioning bool
+}
+
+// 存储桶的匿名访问策略是否已是 policy，mc anonymous get 将 none 显示为 private
+func (s minioBucketState) hasPolicy(policy string) bool {
+	return s.policy == policy || (policy == "none" && s.policy == "private")
+}
+
+// 查询配置的存储桶中已存在的存储桶及其匿名访问策略和版本控制状态，查询失败时视为不存在
+func minioBucketStates(ctx context.Context, cfg *Config) map[string]minioBucketState {
+	states := make(map[string]minioBucketState)
+
+	output, err := mcOutput(ctx, cfg, "ls", cfg.MinioAlias, "--json")
+	if err != nil {
+		slog.Debug("查询Minio存储桶失败", "error", err)
+		return states
+	}
+	existing := make(map[string]bool)
+	for _, obj := range decodeMcJSON(output) {
+		if key, ok := obj["key"].(string); ok && obj["status"] == "success" {
+			existing[strings.TrimSuffix(key, "/")] = true
+		}
+	}
+
+	for _, bucket := range cfg.MinioBuckets {
+		if !existing[bucket.Name] {
+			continue
+		}
+
+		var state minioBucketState
+		target := cfg.MinioAlias + "/" + bucket.Name
+		if output, err := mcOutput(ctx, cfg, "anonymous", "get", target, "--json"); err == nil {
+			for _, obj := range decodeMcJSON(output) {
+				if policy, ok := obj["permission"].(string); ok {
+					state.policy = policy
+				}
+			}
+		}
+		if output, err := mcOutput(ctx, cfg, "version", "info", target, "--json"); err == nil {
+			for _, obj := range decodeMcJSON(output) {
+				if versioning, ok := obj["versioning"].(map[string]any); ok {
+					state.versioning = versioning["status"] == "Enabled"
+				}
+			}
+		}
+		states[bucket.Name] = state
+	}
+
+	return states
+}
+
+// 创建配置的存储桶并设置匿名访问策略，汇总所有存储桶的错误
+// 先查询已有的存储桶，只执行尚未完成的步骤，之前的运行中途失败时可以安全地重新运行
+func createMinioBuckets(ctx context.Context, cfg *Config) error {
+	existing := minioBucketStates(ctx, cfg)
+
+	var errs []error
+	for _, bucket := range cfg.MinioBuckets {
+		target := cfg.MinioAlias + "/" + bucket.Name
+
+		if bucket.Policy != "" && !slices.Contains(minioBucketPolicies, bucket.Policy) {
+			errs = append(errs, fmt.Errorf("存储桶 %s 的访问策略 %s 无效，可选 %s", bucket.Name, bucket.Policy, strings.Join(minioBucketPolicies, "、")))
+			continue
+		}
+
+		state, exists := existing[bucket.Name]
+		if exists {
+			slog.Info("Minio存储桶已存在，跳过创建", "bucket", bucket.Name)
+		} else if err := runMcCommand(ctx, cfg, "mb", "--ignore-existing", target); err != nil {
+			errs = append(errs, fmt.Errorf("创建存储桶 %s 失败: %w", bucket.Name, err))
+			continue
+		}
+
+		if bucket.Policy != "" && !state.hasPolicy(bucket.Policy) {
+			if err := runMcCommand(ctx, cfg, "anonymous", "set", bucket.Policy, target); err != nil {
+				errs = append(errs, fmt.Errorf("设置存储桶 %s 的访问策略失败: %w", bucket.Name, err))
+				continue
+			}
+		}
+
+		if bucket.Versioning && !state.versioning {
+			if err := runMcCommand(ctx, cfg, "version", "enable", target); err != nil {
+				errs = append(errs, fmt.Errorf("启用存储桶 %s 的版本控制失败: %w", bucket.Name, err))
+				continue
+			}
+		}
+
+		// 试运行时只打印了命令
+		if !cfg.DryRun {
+			slog.Info("Minio存储桶已就绪", "bucket", bucket.Name, "policy", bucket.Policy, "versioning", bucket.Versioning)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// 需要创建的 Minio 访问密钥
+type MinioKey struct {
+	AccessKey   string `yaml:"accessKey"`
+	SecretKey   string `yaml:"secretKey"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+}
+
+// 解析 accessKey:secretKey[:name] 格式的访问密钥参数，描述与名称相同
+func parseMinioKey(s string) (MinioKey, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return MinioKey{}, fmt.Errorf("访问密钥格式应为 accessKey:secretKey[:name]")
+	}
+
+	key := MinioKey{AccessKey: parts[0], SecretKey: parts[1]}
+	if len(parts) == 3 {
+		key.Name = parts[2]
+		key.Description = parts[2]
+	}
+	return key, nil
+}
+
+// 需要创建的所有访问密钥，未配置 MinioAccessKeys 时使用 MinioAccessKey、MinioSecretKey 和 MinioDesc
+func minioKeys(cfg *Config) []MinioKey {
+	if len(cfg.MinioAccessKeys) > 0 {
+		return cfg.MinioAccessKeys
+	}
+
+	return []MinioKey{{
+		AccessKey:   cfg.MinioAccessKey,
+		SecretKey:   cfg.MinioSecretKey,
+		Name:        cfg.MinioDesc,
+		Description: cfg.MinioDesc,
+	}}
+}
+
+// 创建配置的访问密钥，已存在的访问密钥跳过，汇总所有访问密钥的错误
+func createMinioAccessKeys(ctx context.Context, cfg *Config) error {
+	existing := minioAccessKeys(ctx, cfg)
+
+	var errs []error
+	for _, key := range minioKeys(cfg) {
+		if existing[key.AccessKey] {
+			slog.Info("Minio访问密钥已存在，跳过", "accessKey", key.AccessKey)
+			continue
+		}
+
+		args := []string{
+			"admin",
+			"accesskey",
+			"create",
+			cfg.MinioAlias,
+			cfg.MinioUser,
+			fmt.Sprintf("--access-key=%s", key.AccessKey),
+			fmt.Sprintf("--secret-key=%s", key.SecretKey),
+		}
+		if key.Name != "" {
+			args = append(args, "--name", key.Name)
+		}
+		if key.Description != "" {
+			args = append(args, "--description", key.Description)
+		}
+
+		if err := runMcCommand(ctx, cfg, args...); err != nil {
+			errs = append(errs, fmt.Errorf("创建访问密钥 %s 失败: %w", key.AccessKey, err))
+			continue
+		}
+
+		// 试运行时只打印了命令
+		if !cfg.DryRun {
+			slog.Info("Minio访问密钥已创建", "accessKey", key.AccessKey, "name", key.Name)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,377 @@
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 模拟 Minio 服务，记录收到的请求(去掉路径末尾的 /)，ListBuckets 返回空列表，其他请求都成功
+type fakeMinio struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (m *fakeMinio) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.requests = append(m.requests, r.Method+" "+strings.TrimSuffix(r.URL.Path, "/"))
+	m.mu.Unlock()
+
+	if r.Method == http.MethodGet && r.URL.Path == "/" {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<ListAllMyBucketsResult><Owner><ID>minio</ID></Owner><Buckets></Buckets></ListAllMyBucketsResult>`))
+	}
+}
+
+func (m *fakeMinio) received(request string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Contains(m.requests, request)
+}
+
+// 连接模拟 Minio 服务的测试配置，配置一个存储桶
+func minioTestConfig(t *testing.T, runner *fakeRunner) (*Config, *fakeMinio) {
+	t.Helper()
+
+	server := &fakeMinio{}
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	cfg := testConfig(t, runner)
+	cfg.MinioEndpoint = ts.URL
+	cfg.MinioHealthURL = ts.URL + minioHealthPath
+	cfg.MinioBuckets = []MinioBucket{{Name: "assets"}}
+	return cfg, server
+}
+
+func TestStartServicesConfiguresMinio(t *testing.T) {
+	tests := []struct {
+		name      string
+		filesOnly bool
+		compose   bool
+		wantMinio bool
+	}{
+		{name: "启动 Compose 后配置 Minio", compose: true, wantMinio: true},
+		{name: "不启动 Compose", compose: false},
+		{name: "仅准备文件", compose: true, filesOnly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{respond: func(args []string) ([]byte, error) {
+				if slices.Contains(args, "ps") {
+					return []byte(`[{"Name":"yoo-oss","Service":"minio","State":"running"}]`), nil
+				}
+				return nil, nil
+			}}
+			cfg, _ := minioTestConfig(t, runner)
+			cfg.StartCompose = tt.compose
+			cfg.FilesOnly = tt.filesOnly
+
+			if err := startServices(context.Background(), "", cfg); err != nil {
+				t.Fatalf("startServices() error = %v", err)
+			}
+			if got := len(runner.called("docker exec yoo-oss mc mb")) > 0; got != tt.wantMinio {
+				t.Errorf("创建存储桶 = %v, want %v", got, tt.wantMinio)
+			}
+		})
+	}
+}
+func TestConfigureMinio(t *testing.T) {
+	tests := []struct {
+		name   string
+		sdk    bool
+		wantMc bool
+	}{
+		{name: "mc", wantMc: true},
+		{name: "SDK", sdk: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{}
+			cfg, server := minioTestConfig(t, runner)
+			cfg.MinioSDK = tt.sdk
+
+			if err := configureMinio(context.Background(), "", cfg); err != nil {
+				t.Fatalf("configureMinio() error = %v", err)
+			}
+
+			// 存储桶通过 mc 或 SDK 之一创建
+			if got := len(runner.called("docker exec yoo-oss mc mb --ignore-existing myminio/assets")) > 0; got != tt.wantMc {
+				t.Errorf("mc mb 执行 = %v, want %v", got, tt.wantMc)
+			}
+			if got := server.received("PUT /assets"); got != tt.sdk {
+				t.Errorf("SDK 创建存储桶 = %v, want %v", got, tt.sdk)
+			}
+			// 访问密钥通过 mc 创建，创建前已配置 mc 别名
+			alias := slices.IndexFunc(runner.calls, func(call string) bool {
+				return strings.HasPrefix(call, "docker exec yoo-oss mc alias set myminio ")
+			})
+			create := slices.IndexFunc(runner.calls, func(call string) bool {
+				return strings.HasPrefix(call, "docker exec yoo-oss mc admin accesskey create myminio ")
+			})
+			if create < 0 || alias < 0 || alias > create {
+				t.Errorf("创建访问密钥前没有配置 mc 别名，执行了 %q", runner.calls)
+			}
+		})
+	}
+}
+
+// 模拟 Minio 中已有的状态：existing 为 mc ls 的输出，其余为各存储桶查询命令的输出
+func minioStateRunner(existing string, queries map[string]string) *fakeRunner {
+	return &fakeRunner{respond: func(args []string) ([]byte, error) {
+		call := strings.Join(args, " ")
+		if strings.HasSuffix(call, "mc ls myminio --json") {
+			return []byte(existing), nil
+		}
+		for query, output := range queries {
+			if strings.HasSuffix(call, query) {
+				return []byte(output), nil
+			}
+		}
+		return nil, nil
+	}}
+}
+
+func TestCreateMinioBuckets(t *testing.T) {
+	const listed = `{"status":"success","type":"folder","key":"assets/"}`
+	tests := []struct {
+		name    string
+		bucket  MinioBucket
+		runner  *fakeRunner
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "只创建存储桶",
+			bucket: MinioBucket{Name: "assets"},
+			want:   []string{"mc mb --ignore-existing myminio/assets"},
+		},
+		{
+			name:   "设置访问策略并启用版本控制",
+			bucket: MinioBucket{Name: "assets", Policy: "download", Versioning: true},
+			want: []string{
+				"mc mb --ignore-existing myminio/assets",
+				"mc anonymous set download myminio/assets",
+				"mc version enable myminio/assets",
+			},
+		},
+		{
+			name:    "无效的访问策略",
+			bucket:  MinioBucket{Name: "assets", Policy: "private"},
+			wantErr: true,
+		},
+		{
+			name:   "存储桶已存在，访问策略和版本控制尚未设置",
+			bucket: MinioBucket{Name: "assets", Policy: "download", Versioning: true},
+			runner: minioStateRunner(listed, map[string]string{
+				"mc anonymous get myminio/assets --json": `{"status":"success","permission":"private"}`,
+				"mc version info myminio/assets --json":  `{"status":"success","versioning":{"status":""}}`,
+			}),
+			want: []string{
+				"mc anonymous set download myminio/assets",
+				"mc version enable myminio/assets",
+			},
+		},
+		{
+			name:   "只有版本控制尚未启用",
+			bucket: MinioBucket{Name: "assets", Policy: "download", Versioning: true},
+			runner: minioStateRunner(listed, map[string]string{
+				"mc anonymous get myminio/assets --json": `{"status":"success","permission":"download"}`,
+			}),
+			want: []string{"mc version enable myminio/assets"},
+		},
+		{
+			name:   "已全部完成",
+			bucket: MinioBucket{Name: "assets", Policy: "none", Versioning: true},
+			runner: minioStateRunner(listed, map[string]string{
+				"mc anonymous get myminio/assets --json": `{"status":"success","permission":"private"}`,
+				"mc version info myminio/assets --json":  `{"status":"success","versioning":{"status":"Enabled"}}`,
+			}),
+		},
+		{
+			name:   "其他存储桶已存在",
+			bucket: MinioBucket{Name: "logs"},
+			runner: minioStateRunner(listed, nil),
+			want:   []string{"mc mb --ignore-existing myminio/logs"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := tt.runner
+			if runner == nil {
+				runner = &fakeRunner{}
+			}
+			cfg := testConfig(t, runner)
+			cfg.MinioBuckets = []MinioBucket{tt.bucket}
+
+			err := createMinioBuckets(context.Background(), cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("createMinioBuckets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// 只比较修改 Minio 的命令，不包括查询当前状态的命令
+			var got []string
+			for _, call := range runner.called("docker exec yoo-oss mc ") {
+				if !strings.HasSuffix(call, " --json") {
+					got = append(got, strings.TrimPrefix(call, "docker exec yoo-oss "))
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("createMinioBuckets() 执行了 %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigureMinioDryRun(t *testing.T) {
+	for _, sdk := range []bool{false, true} {
+		runner := &fakeRunner{}
+		cfg, server := minioTestConfig(t, runner)
+		cfg.DryRun = true
+		cfg.MinioSDK = sdk
+		cfg.MinioBuckets = []MinioBucket{{Name: "logs", Policy: "download", Versioning: true}}
+
+		// 试运行时主Stub文件没有解压，初始数据的存储桶从主Stub文件的条目中列出
+		stubTar := writeTestTar(t, "stub.tar", []testEntry{
+			{Name: "minio-data/", Typeflag: tar.TypeDir},
+			{Name: "minio-data/README", Typeflag: tar.TypeReg, Body: "x"},
+			{Name: "minio-data/assets/logo.png", Typeflag: tar.TypeReg, Body: "x"},
+			{Name: "./minio-data/media/", Typeflag: tar.TypeDir},
+			{Name: "10-app/app.tar", Typeflag: tar.TypeReg, Body: "x"},
+		})
+		_, seeds, err := minioSeedBuckets(context.Background(), stubTar, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"assets", "media"}; !slices.Equal(seeds, want) {
+			t.Errorf("minioSeedBuckets() = %v, want %v", seeds, want)
+		}
+
+		if err := configureMinio(context.Background(), stubTar, cfg); err != nil {
+			t.Fatalf("configureMinio() error = %v", err)
+		}
+		if len(runner.calls) > 0 || len(server.requests) > 0 {
+			t.Errorf("试运行时执行了命令 %v 或请求 %v", runner.calls, server.requests)
+		}
+		var names []string
+		for _, bucket := range cfg.MinioBuckets {
+			names = append(names, bucket.Name)
+		}
+		if want := []string{"logs", "assets", "media"}; !slices.Equal(names, want) {
+			t.Errorf("试运行时的存储桶 = %v, want %v", names, want)
+		}
+	}
+}
+
+func TestMinioAliasConfigured(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   bool
+	}{
+		{name: "与配置一致", output: `{"status":"success","alias":"myminio","URL":"http://localhost:9000","accessKey":"minioadmin","secretKey":"minioadmin"}`, want: true},
+		{name: "密码已修改", output: `{"status":"success","alias":"myminio","URL":"http://localhost:9000","accessKey":"minioadmin","secretKey":"old-password"}`},
+		{name: "地址不同", output: `{"status":"success","alias":"myminio","URL":"http://other:9000","accessKey":"minioadmin","secretKey":"minioadmin"}`},
+		{name: "输出中没有密码", output: `{"status":"success","alias":"myminio","URL":"http://localhost:9000","accessKey":"minioadmin"}`},
+		{name: "别名不存在", output: `{"status":"error","error":{"message":"No such alias myminio found."}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, minioStateRunner("", map[string]string{"mc alias list myminio --json": tt.output}))
+
+			if got := minioAliasConfigured(context.Background(), cfg); got != tt.want {
+				t.Errorf("minioAliasConfigured() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateMinioAccessKeys(t *testing.T) {
+	multi := []MinioKey{
+		{AccessKey: "app-key", SecretKey: "app-secret", Name: "app", Description: "app"},
+		{AccessKey: "ci-key", SecretKey: "ci-secret"},
+	}
+	tests := []struct {
+		name     string
+		keys     []MinioKey
+		existing string
+		want     []string
+	}{
+		{
+			name: "未配置 minioAccessKeys 时使用单个访问密钥",
+			want: []string{"--access-key=yoo-oss-access-key --secret-key=yoo-oss-secret-key --name proxy --description proxy"},
+		},
+		{
+			name: "多个访问密钥",
+			keys: multi,
+			want: []string{
+				"--access-key=app-key --secret-key=app-secret --name app --description app",
+				"--access-key=ci-key --secret-key=ci-secret",
+			},
+		},
+		{
+			name:     "跳过已存在的访问密钥",
+			keys:     multi,
+			existing: `{"status":"success","user":{"accessKey":"minioadmin"},"stsKeys":null,"svcaccs":[{"accessKey":"app-key"}]}`,
+			want:     []string{"--access-key=ci-key --secret-key=ci-secret"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := minioStateRunner("", map[string]string{"mc admin accesskey ls myminio minioadmin --json": tt.existing})
+			cfg := testConfig(t, runner)
+			cfg.MinioAccessKeys = tt.keys
+
+			if err := createMinioAccessKeys(context.Background(), cfg); err != nil {
+				t.Fatalf("createMinioAccessKeys() error = %v", err)
+			}
+
+			const prefix = "docker exec yoo-oss mc admin accesskey create myminio minioadmin "
+			var got []string
+			for _, call := range runner.called(prefix) {
+				got = append(got, strings.TrimPrefix(call, prefix))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("创建了 %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMinioKey(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    MinioKey
+		wantErr bool
+	}{
+		{arg: "ak:sk", want: MinioKey{AccessKey: "ak", SecretKey: "sk"}},
+		{arg: "ak:sk:app", want: MinioKey{AccessKey: "ak", SecretKey: "sk", Name: "app", Description: "app"}},
+		{arg: "ak:s:k:app", want: MinioKey{AccessKey: "ak", SecretKey: "s", Name: "k:app", Description: "k:app"}},
+		{arg: "ak", wantErr: true},
+		{arg: ":sk", wantErr: true},
+		{arg: "ak:", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := parseMinioKey(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMinioKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseMinioKey() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package setup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// 创建连接 MinioEndpoint 的 Minio SDK 客户端，使用 Minio 用户名和密码认证
+func newMinioClient(cfg *Config) (*minio.Client, error) {
+	u, err := url.Parse(cfg.MinioEndpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("Minio 服务地址 %s 无效，应为 http://host:port 格式", cfg.MinioEndpoint)
+	}
+
+	return minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.MinioUser, cfg.MinioUserPass, ""),
+		Secure: u.Scheme == "https",
+	})
+}
+
+// 通过 Minio SDK 等待服务就绪并确认用户名和密码有效，相当于 mc alias set，最长等待 MinioReadyTimeout
+func waitMinioReadySDK(ctx context.Context, client *minio.Client, cfg *Config) error {
+	if cfg.DryRun {
+		slog.Info("试运行，跳过等待Minio就绪", "endpoint", cfg.MinioEndpoint)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.MinioReadyTimeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		_, err := client.ListBuckets(ctx)
+		if err == nil {
+			return nil
+		}
+
+		slog.Debug("Minio 尚未就绪，稍后重试", "attempt", attempt, "error", err)
+		if sleepErr := sleepContext(ctx, minioReadyInterval); sleepErr != nil {
+			return fmt.Errorf("等待Minio就绪超时: %w", err)
+		}
+	}
+}
+
+// 匿名访问策略对应的存储桶级和对象级操作，与 mc anonymous set 一致
+var minioPolicyActions = map[string][2][]string{
+	"download": {
+		{"s3:GetBucketLocation", "s3:ListBucket"},
+		{"s3:GetObject"},
+	},
+	"upload": {
+		{"s3:GetBucketLocation", "s3:ListBucketMultipartUploads"},
+		{"s3:AbortMultipartUpload", "s3:DeleteObject", "s3:ListMultipartUploadParts", "s3:PutObject"},
+	},
+	"public": {
+		{"s3:GetBucketLocation", "s3:ListBucket", "s3:ListBucketMultipartUploads"},
+		{"s3:AbortMultipartUpload", "s3:DeleteObject", "s3:GetObject", "s3:ListMultipartUploadParts", "s3:PutObject"},
+	},
+}
+
+// 生成存储桶的匿名访问策略，none 时返回空字符串表示删除策略
+func minioBucketPolicy(bucket, policy string) (string, error) {
+	if policy == "none" {
+		return "", nil
+	}
+
+	actions, ok := minioPolicyActions[policy]
+	if !ok {
+		return "", fmt.Errorf("未知的访问策略 %s", policy)
+	}
+
+	type statement struct {
+		Effect    string              `json:"Effect"`
+		Principal map[string][]string `json:"Principal"`
+		Action    []string            `json:"Action"`
+		Resource  []string            `json:"Resource"`
+	}
+	anyone := map[string][]string{"AWS": {"*"}}
+	doc := struct {
+		Version   string      `json:"Version"`
+		Statement []statement `json:"Statement"`
+	}{
+		Version: "2012-10-17",
+		Statement: []statement{
+			{Effect: "Allow", Principal: anyone, Action: actions[0], Resource: []string{"arn:aws:s3:::" + bucket}},
+			{Effect: "Allow", Principal: anyone, Action: actions[1], Resource: []string{"arn:aws:s3:::" + bucket + "/*"}},
+		},
+	}
+
+	data, err := json.Marshal(doc)
+	return string(data), err
+}
+
+// 通过 Minio SDK 创建配置的存储桶并设置匿名访问策略，已存在的存储桶不报错，汇总所有存储桶的错误
+func createMinioBucketsSDK(ctx context.Context, client *minio.Client, cfg *Config) error {
+	var errs []error
+	for _, bucket := range cfg.MinioBuckets {
+		if bucket.Policy != "" && !slices.Contains(minioBucketPolicies, bucket.Policy) {
+			errs = append(errs, fmt.Errorf("存储桶 %s 的访问策略 %s 无效，可选 %s", bucket.Name, bucket.Policy, strings.Join(minioBucketPolicies, "、")))
+			continue
+		}
+		if cfg.DryRun {
+			slog.Info("试运行，跳过创建存储桶", "bucket", bucket.Name, "policy", bucket.Policy, "versioning", bucket.Versioning)
+			continue
+		}
+
+		err := retry(ctx, cfg, "minio make bucket "+bucket.Name, func(ctx context.Context) error {
+			err := client.MakeBucket(ctx, bucket.Name, minio.MakeBucketOptions{})
+			if code := minio.ToErrorResponse(err).Code; code == "BucketAlreadyOwnedByYou" || code == "BucketAlreadyExists" {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("创建存储桶 %s 失败: %w", bucket.Name, err))
+			continue
+		}
+
+		if bucket.Policy != "" {
+			policy, err := minioBucketPolicy(bucket.Name, bucket.Policy)
+			if err == nil {
+				err = retry(ctx, cfg, "minio set bucket policy "+bucket.Name, func(ctx context.Context) error {
+					return client.SetBucketPolicy(ctx, bucket.Name, policy)
+				})
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("设置存储桶 %s 的访问策略失败: %w", bucket.Name, err))
+				continue
+			}
+		}
+
+		if bucket.Versioning {
+			err := retry(ctx, cfg, "minio enable versioning "+bucket.Name, func(ctx context.Context) error {
+				return client.EnableVersioning(ctx, bucket.Name)
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("启用存储桶 %s 的版本控制失败: %w", bucket.Name, err))
+				continue
+			}
+		}
+
+		slog.Info("Minio存储桶已就绪", "bucket", bucket.Name, "policy", bucket.Policy, "versioning", bucket.Versioning)
+	}
+
+	return errors.Join(errs...)
+}
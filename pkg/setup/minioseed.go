@@ -0,0 +1,194 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// 主Stub文件中 Minio 初始数据所在的目录，其中每个子目录对应一个存储桶，不作为子目录处理
+const minioDataDir = "minio-data"
+
+// 上传初始数据时在 Minio 容器中临时存放数据的目录
+const minioSeedContainerDir = "/tmp/setup-minio-data"
+
+// 工作目录 minio-data 中有初始数据的存储桶，按名称排序，目录不存在时为空
+// 试运行时主Stub文件没有解压，根据 stubTar 中的条目列出，stubTar 为空时不列出
+func minioSeedBuckets(ctx context.Context, stubTar string, cfg *Config) (string, []string, error) {
+	cwd, err := filepath.Abs(cfg.WorkDir)
+	if err != nil {
+		return "", nil, fmt.Errorf("获取当前工作目录失败: %w", err)
+	}
+
+	dir := filepath.Join(cwd, minioDataDir)
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) && cfg.DryRun && stubTar != "" {
+		names, err := listTarEntries(ctx, stubTar, cfg)
+		if err != nil {
+			return "", nil, err
+		}
+		return dir, seedBucketsFromEntries(names), nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return dir, nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("读取 Minio 初始数据目录失败: %w", err)
+	}
+
+	var buckets []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			buckets = append(buckets, entry.Name())
+		}
+	}
+
+	return dir, buckets, nil
+}
+
+// 主Stub文件条目中 minio-data 下的一级目录，按名称排序
+func seedBucketsFromEntries(names []string) []string {
+	var buckets []string
+	for _, name := range names {
+		rest, ok := strings.CutPrefix(strings.TrimPrefix(name, "./"), minioDataDir+"/")
+		if !ok {
+			continue
+		}
+		// minio-data 下的文件不是存储桶，与读取目录时一致
+		bucket, _, isDir := strings.Cut(rest, "/")
+		if isDir && bucket != "" && !slices.Contains(buckets, bucket) {
+			buckets = append(buckets, bucket)
+		}
+	}
+
+	slices.Sort(buckets)
+	return buckets
+}
+
+// 为有初始数据但未配置的存储桶补充配置，不设置访问策略
+func withSeedBuckets(buckets []MinioBucket, seeds []string) []MinioBucket {
+	for _, name := range seeds {
+		if !slices.ContainsFunc(buckets, func(b MinioBucket) bool { return b.Name == name }) {
+			buckets = append(buckets, MinioBucket{Name: name})
+		}
+	}
+
+	return buckets
+}
+
+// 通过 mc 上传初始数据：复制到 Minio 容器后 mc mirror 到对应存储桶，汇总所有存储桶的错误
+// 未指定 MinioSeedOverwrite 时不覆盖存储桶中已有的对象
+func seedMinioBuckets(ctx context.Context, dir string, buckets []string, cfg *Config) error {
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	mkdir := cfg.runtime().Exec(ctx, cfg.MinioContainer, []string{"mkdir", "-p", minioSeedContainerDir}, cfg)
+	if !dryRun(mkdir, cfg) {
+		if output, err := cfg.runner().CombinedOutput(mkdir); err != nil {
+			return fmt.Errorf("在 Minio 容器中创建临时目录失败: %w, 输出: %s", err, output)
+		}
+	}
+
+	var errs []error
+	for _, bucket := range buckets {
+		if err := seedMinioBucket(ctx, filepath.Join(dir, bucket), bucket, cfg); err != nil {
+			errs = append(errs, fmt.Errorf("上传存储桶 %s 的初始数据失败: %w", bucket, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// 上传单个存储桶的初始数据，完成后删除容器中的临时数据
+func seedMinioBucket(ctx context.Context, src, bucket string, cfg *Config) error {
+	dst := path.Join(minioSeedContainerDir, bucket)
+
+	cp := command(ctx, cfg, cfg.DockerCmd, "cp", src, cfg.MinioContainer+":"+dst)
+	if !dryRun(cp, cfg) {
+		if output, err := combinedOutput(cp, "minio-seed", cfg); err != nil {
+			return fmt.Errorf("复制到 Minio 容器失败: %w, 输出: %s", err, output)
+		}
+	}
+	defer func() {
+		rm := cfg.runtime().Exec(ctx, cfg.MinioContainer, []string{"rm", "-rf", dst}, cfg)
+		if dryRun(rm, cfg) {
+			return
+		}
+		if output, err := cfg.runner().CombinedOutput(rm); err != nil {
+			slog.Warn("删除 Minio 容器中的临时数据失败", "dir", dst, "error", err, "output", string(output))
+		}
+	}()
+
+	args := []string{"mirror"}
+	if cfg.MinioSeedOverwrite {
+		args = append(args, "--overwrite")
+	}
+	if err := runMcCommand(ctx, cfg, append(args, dst, cfg.MinioAlias+"/"+bucket)...); err != nil {
+		return err
+	}
+
+	// 试运行时只打印了命令
+	if !cfg.DryRun {
+		slog.Info("已上传 Minio 初始数据", "bucket", bucket)
+	}
+	return nil
+}
+
+// 通过 Minio SDK 上传初始数据，未指定 MinioSeedOverwrite 时跳过已存在的对象，汇总所有存储桶的错误
+func seedMinioBucketsSDK(ctx context.Context, client *minio.Client, dir string, buckets []string, cfg *Config) error {
+	var errs []error
+	for _, bucket := range buckets {
+		if cfg.DryRun {
+			slog.Info("试运行，跳过上传初始数据", "bucket", bucket, "dir", filepath.Join(dir, bucket))
+			continue
+		}
+
+		uploaded, skipped := 0, 0
+		src := filepath.Join(dir, bucket)
+		err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			rel, err := filepath.Rel(src, p)
+			if err != nil {
+				return err
+			}
+			key := filepath.ToSlash(rel)
+
+			if !cfg.MinioSeedOverwrite {
+				if _, err := client.StatObject(ctx, bucket, key, minio.StatObjectOptions{}); err == nil {
+					skipped++
+					return nil
+				}
+			}
+			err = retry(ctx, cfg, "minio put "+bucket+"/"+key, func(ctx context.Context) error {
+				_, err := client.FPutObject(ctx, bucket, key, p, minio.PutObjectOptions{})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("上传 %s 失败: %w", key, err)
+			}
+			uploaded++
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("上传存储桶 %s 的初始数据失败: %w", bucket, err))
+			continue
+		}
+
+		slog.Info("已上传 Minio 初始数据", "bucket", bucket, "uploaded", uploaded, "skipped", skipped)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,109 @@
+package setup
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// 子目录名开头的数字前缀，没有前缀时 ok 为 false
+func subDirPrefix(name string) (n int, ok bool) {
+	end := 0
+	for end < len(name) && name[end] >= '0' && name[end] <= '9' {
+		end++
+	}
+	if end == 0 {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(name[:end])
+	if err != nil {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// 按数字前缀将子目录分批，批次之间按顺序处理，同一批次内并发处理
+//
+// 规则：
+//   - 数字前缀相同的子目录为同一批次，例如 00-base 和 0-common
+//   - 批次按前缀数值从小到大排列，例如 9-db 在 10-app 之前
+//   - 没有数字前缀的子目录在最后一个批次中处理
+//
+// 子目录都没有数字前缀时只有一个批次，与原来全部并发处理一致
+func subDirBatches(names []string) [][]string {
+	byPrefix := make(map[int][]string)
+	var unprefixed []string
+	for _, name := range names {
+		if n, ok := subDirPrefix(name); ok {
+			byPrefix[n] = append(byPrefix[n], name)
+		} else {
+			unprefixed = append(unprefixed, name)
+		}
+	}
+
+	prefixes := make([]int, 0, len(byPrefix))
+	for n := range byPrefix {
+		prefixes = append(prefixes, n)
+	}
+	sort.Ints(prefixes)
+
+	batches := make([][]string, 0, len(prefixes)+1)
+	for _, n := range prefixes {
+		batches = append(batches, byPrefix[n])
+	}
+	if len(unprefixed) > 0 {
+		batches = append(batches, unprefixed)
+	}
+
+	return batches
+}
+
+// 子目录的处理顺序，与 subDirBatches 的批次顺序一致，同一批次内按名称排序
+func subDirLess(a, b string) bool {
+	na, oka := subDirPrefix(a)
+	nb, okb := subDirPrefix(b)
+	switch {
+	case oka != okb:
+		return oka
+	case oka && na != nb:
+		return na < nb
+	default:
+		return a < b
+	}
+}
+
+// 子目录处理进度，可并发使用
+// 子目录不超过 subDirProgressEvery 个时每完成一个输出一次日志，否则每完成 10% 输出一次
+type subDirProgress struct {
+	mu     sync.Mutex
+	phase  string
+	total  int
+	done   int
+	logged int
+}
+
+// 子目录数量不超过该值时每个子目录完成都输出进度
+const subDirProgressEvery = 20
+
+// 记录一个子目录处理完成并按需输出进度
+func (p *subDirProgress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done++
+	percent := p.done * 100 / p.total
+	if p.total > subDirProgressEvery && percent < p.logged+10 && p.done < p.total {
+		return
+	}
+
+	p.logged = percent
+	attrs := []any{"progress", fmt.Sprintf("%d/%d (%d%%)", p.done, p.total, percent)}
+	if p.phase != "" {
+		attrs = append(attrs, "phase", p.phase)
+	}
+	slog.Info("子目录处理进度", attrs...)
+}
@@ -0,0 +1,83 @@
+package setup
+
+import (
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+)
+
+// 警告日志中最多列出的路径数
+const maxReportedPaths = 20
+
+// 判断指定用户是否拥有 want 所表示的权限(r=4, w=2, x=1)
+func canAccess(mode fs.FileMode, fileUID, fileGID, uid, gid int, want fs.FileMode) bool {
+	if uid == 0 {
+		return true
+	}
+
+	perm := mode.Perm()
+	switch {
+	case fileUID == uid:
+		perm >>= 6
+	case fileGID == gid:
+		perm >>= 3
+	}
+
+	return perm&want == want
+}
+
+// 扫描解压后的文件，找出容器运行用户无法读取的路径
+func findInaccessible(root string, uid, gid int) ([]string, error) {
+	var paths []string
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		fileUID, fileGID, ok := fileOwner(info)
+		if !ok {
+			return nil
+		}
+
+		// 目录需要读取和进入权限
+		want := fs.FileMode(4)
+		if d.IsDir() {
+			want = 5
+		}
+
+		if !canAccess(info.Mode(), fileUID, fileGID, uid, gid, want) {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+
+	return paths, err
+}
+
+// 检查解压后的文件权限，发现容器运行用户无法读取的文件时输出警告
+func checkOwnership(targetDir string, cfg *Config) error {
+	if cfg.RuntimeUID < 0 {
+		return nil
+	}
+
+	paths, err := findInaccessible(targetDir, cfg.RuntimeUID, cfg.RuntimeGID)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	reported := paths[:min(len(paths), maxReportedPaths)]
+	slog.Warn("部分文件容器运行用户无法读取", "uid", cfg.RuntimeUID, "gid", cfg.RuntimeGID, "count", len(paths), "paths", reported)
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package setup
+
+import "io/fs"
+
+// 当前平台不支持获取文件的属主和属组
+func fileOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package setup
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// 获取文件的属主和属组
+func fileOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return int(st.Uid), int(st.Gid), true
+}
@@ -0,0 +1,445 @@
+package setup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"gopkg.in/yaml.v3"
+)
+
+// 打包描述文件：主Stub文件的内容，路径相对于描述文件所在目录
+type packSpec struct {
+	Output    string       `yaml:"output"`
+	Compose   string       `yaml:"compose"`
+	Manifest  string       `yaml:"manifest"`
+	MinioData string       `yaml:"minioData"`
+	SubDirs   []packSubDir `yaml:"subdirs"`
+}
+
+// 打包描述文件中的子目录：通过 docker save 导出的镜像和打包为 files.tar 的目录
+type packSubDir struct {
+	Name   string   `yaml:"name"`
+	Images []string `yaml:"images"`
+	Files  string   `yaml:"files"`
+}
+
+// 写入主Stub文件的条目：name 为 Stub 中的路径，src 为本地文件或目录
+type packEntry struct {
+	name string
+	src  string
+}
+
+// 读取打包描述文件，相对路径转换为相对于描述文件所在目录
+func loadPackSpec(specPath string) (*packSpec, error) {
+	data, err := os.ReadFile(specPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取打包描述文件失败: %w", err)
+	}
+
+	var spec packSpec
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("解析打包描述文件 %s 失败: %w", specPath, err)
+	}
+
+	base := filepath.Dir(specPath)
+	resolve := func(p *string) {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(base, *p)
+		}
+	}
+	resolve(&spec.Compose)
+	resolve(&spec.Manifest)
+	resolve(&spec.MinioData)
+	for i := range spec.SubDirs {
+		resolve(&spec.SubDirs[i].Files)
+	}
+
+	return &spec, spec.validate()
+}
+
+// 检查打包描述文件，列出所有问题
+func (spec *packSpec) validate() error {
+	var problems []string
+	if spec.Compose != "" && !slices.Contains(composeFileNames, filepath.Base(spec.Compose)) {
+		problems = append(problems, fmt.Sprintf("Compose 文件名应为 %s 之一", strings.Join(composeFileNames, "、")))
+	}
+	if len(spec.SubDirs) == 0 {
+		problems = append(problems, "没有子目录")
+	}
+
+	seen := make(map[string]bool)
+	for _, sub := range spec.SubDirs {
+		switch {
+		case sub.Name == "" || strings.ContainsAny(sub.Name, `/\`) || sub.Name == "." || sub.Name == "..":
+			problems = append(problems, fmt.Sprintf("子目录名 %q 无效", sub.Name))
+		case sub.Name == minioDataDir:
+			problems = append(problems, fmt.Sprintf("子目录名 %s 保留给 Minio 初始数据", minioDataDir))
+		case seen[sub.Name]:
+			problems = append(problems, fmt.Sprintf("子目录 %s 重复", sub.Name))
+		}
+		seen[sub.Name] = true
+
+		if len(sub.Images) == 0 && sub.Files == "" {
+			problems = append(problems, fmt.Sprintf("子目录 %s 没有镜像也没有文件", sub.Name))
+		}
+		files := make(map[string]string)
+		for _, ref := range sub.Images {
+			name := imageFileName(ref)
+			if other, ok := files[name]; ok {
+				problems = append(problems, fmt.Sprintf("子目录 %s 中的镜像 %s 和 %s 导出的文件名相同", sub.Name, other, ref))
+			}
+			files[name] = ref
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("打包描述文件无效: %s", strings.Join(problems, "；"))
+	}
+	return nil
+}
+
+// 镜像导出的文件名，例如 library/redis:7 为 library_redis_7.tar
+func imageFileName(ref string) string {
+	name := strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(ref)
+	if name == "files" {
+		// files.tar 表示需要解压的文件
+		name = "files_"
+	}
+	return name + ".tar"
+}
+
+// pack 子命令：按打包描述文件导出镜像、打包目录并生成带校验和的主Stub文件
+func runPack(ctx context.Context, args []string, cfg *Config) error {
+	fs := flag.NewFlagSet("pack", flag.ContinueOnError)
+	specPath := fs.String("spec", "pack.yaml", "打包描述文件")
+	output := fs.String("o", "", "生成的主Stub文件，默认为描述文件中的 output，未指定时为 stub.tar；后缀决定压缩格式")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: setup pack [-spec pack.yaml] [-o stub.tar.gz]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		// -h 时已输出用法
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	spec, err := loadPackSpec(*specPath)
+	if err != nil {
+		return err
+	}
+
+	out := *output
+	if out == "" {
+		out = spec.Output
+	}
+	if out == "" {
+		out = "stub.tar"
+	}
+	if _, ok := trimArchiveSuffix(filepath.Base(out)); !ok {
+		return fmt.Errorf("主Stub文件 %s 的后缀应为 %s 之一", out, strings.Join(archiveSuffixes, "、"))
+	}
+
+	// 导出镜像前确认容器运行时
+	if slices.ContainsFunc(spec.SubDirs, func(sub packSubDir) bool { return len(sub.Images) > 0 }) {
+		if err := resolveRuntime(cfg); err != nil {
+			return err
+		}
+	}
+
+	// 导出的镜像和打包的目录先写入同目录下的临时目录
+	staging, err := os.MkdirTemp(filepath.Dir(out), ".setup-pack-")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	entries, err := preparePack(ctx, spec, staging, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := writePack(out, entries); err != nil {
+		return err
+	}
+
+	// 按 install 的方式校验生成的主Stub文件
+	verifyCfg := *cfg
+	verifyCfg.VerifyChecksums = true
+	if err := verifyArchive(out, &verifyCfg); err != nil {
+		return err
+	}
+	if err := checkArchiveEntries(ctx, out); err != nil {
+		return err
+	}
+	if err := verifyStubChecksums(ctx, out, cfg); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(out)
+	if err != nil {
+		return err
+	}
+	slog.Info("主Stub文件已生成", "file", out, "size", formatBytes(info.Size()), "subDirs", len(spec.SubDirs))
+	return nil
+}
+
+// 导出镜像并打包子目录中的文件，返回主Stub文件的条目
+func preparePack(ctx context.Context, spec *packSpec, staging string, cfg *Config) ([]packEntry, error) {
+	var entries []packEntry
+	if spec.Compose != "" {
+		entries = append(entries, packEntry{name: filepath.Base(spec.Compose), src: spec.Compose})
+	}
+	if spec.Manifest != "" {
+		if _, err := loadManifest(spec.Manifest); err != nil {
+			return nil, err
+		}
+		entries = append(entries, packEntry{name: cfg.ManifestName, src: spec.Manifest})
+	}
+	if spec.MinioData != "" {
+		entries = append(entries, packEntry{name: minioDataDir, src: spec.MinioData})
+	}
+
+	for _, sub := range spec.SubDirs {
+		dir := filepath.Join(staging, sub.Name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建临时目录失败: %w", err)
+		}
+
+		for _, ref := range sub.Images {
+			file := filepath.Join(dir, imageFileName(ref))
+			slog.Info("正在导出镜像", "image", ref, "file", path.Join(sub.Name, filepath.Base(file)))
+			err := retry(ctx, cfg, "docker save "+ref, func(ctx context.Context) error {
+				cmd := command(ctx, cfg, cfg.DockerCmd, "save", "-o", file, ref)
+				if output, err := combinedOutput(cmd, ref, cfg); err != nil {
+					return fmt.Errorf("docker save 命令失败: %w, 输出: %s", err, output)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// 安装时检查加载的镜像与导出的镜像一致
+		if len(sub.Images) > 0 {
+			list := strings.Join(sub.Images, "\n") + "\n"
+			if err := os.WriteFile(filepath.Join(dir, expectedImagesName), []byte(list), 0o644); err != nil {
+				return nil, err
+			}
+		}
+
+		if sub.Files != "" {
+			slog.Info("正在打包文件", "dir", sub.Files, "subDir", sub.Name)
+			if err := writeFilesTar(filepath.Join(dir, "files.tar"), sub.Files); err != nil {
+				return nil, err
+			}
+		}
+
+		// 每个压缩文件旁生成 .sha256 文件，供安装时 -verify 校验
+		archives, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, archive := range archives {
+			if _, ok := classifyArchive(archive.Name()); ok {
+				if err := writeChecksumFile(filepath.Join(dir, archive.Name())); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		entries = append(entries, packEntry{name: sub.Name, src: dir})
+	}
+
+	return entries, nil
+}
+
+// 生成与 sha256sum 输出格式一致的 .sha256 文件
+func writeChecksumFile(p string) error {
+	sum, err := fileSHA256(p)
+	if err != nil {
+		return fmt.Errorf("计算 %s 的校验和失败: %w", filepath.Base(p), err)
+	}
+
+	return os.WriteFile(p+checksumSuffix, []byte(fmt.Sprintf("%s  %s\n", sum, filepath.Base(p))), 0o644)
+}
+
+// 将目录打包为 tar 文件，条目路径相对于该目录
+func writeFilesTar(tarPath, dir string) error {
+	f, err := os.Create(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	if err := addPackTree(tw, "", dir, nil); err != nil {
+		return fmt.Errorf("打包 %s 失败: %w", dir, err)
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// 按文件后缀选择压缩格式写入主Stub文件，末尾写入压缩文件的校验和清单，并生成 .sha256 文件
+func writePack(out string, entries []packEntry) error {
+	tmp := out + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	w, err := packCompressor(f, out)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	sums := make(map[string]string)
+	for _, entry := range entries {
+		if err := addPackTree(tw, entry.name, entry.src, sums); err != nil {
+			return fmt.Errorf("写入 %s 失败: %w", entry.name, err)
+		}
+	}
+
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var list strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&list, "%s  %s\n", sums[name], name)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: checksumListName, Mode: 0o644, Size: int64(list.Len()), Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(tw, list.String()); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		return err
+	}
+
+	return writeChecksumFile(out)
+}
+
+// 按主Stub文件的后缀返回压缩写入器，未压缩时关闭写入器不做任何操作
+func packCompressor(w io.Writer, name string) (io.WriteCloser, error) {
+	switch {
+	case isGzipArchive(name):
+		return gzip.NewWriter(w), nil
+	case isZstdArchive(name):
+		return zstd.NewWriter(w)
+	case isXzArchive(name):
+		return xz.NewWriter(w)
+	}
+	return nopWriteCloser{w}, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// 将文件或目录写入 tar，prefix 为条目路径前缀；sums 不为 nil 时记录其中压缩文件的校验和
+func addPackTree(tw *tar.Writer, prefix, src string, sums map[string]string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+		if name == "." {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		// 不保留打包机器上的用户，解压后的所有者由 checkOwnership 检查
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if err := checkEntryLink(hdr); err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var w io.Writer = tw
+		h := sha256.New()
+		_, archive := classifyArchive(path.Base(name))
+		if sums != nil && archive {
+			w = io.MultiWriter(tw, h)
+		}
+		if _, err := io.CopyBuffer(w, f, make([]byte, hashBufferSize)); err != nil {
+			return err
+		}
+		if sums != nil && archive {
+			sums[name] = hex.EncodeToString(h.Sum(nil))
+		}
+		return nil
+	})
+}
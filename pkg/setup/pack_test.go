@@ -0,0 +1,26 @@
+package setup
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRunPackFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{name: "未知参数", args: []string{"-unknown"}, wantErr: true},
+		{name: "参数缺少值", args: []string{"-spec"}, wantErr: true},
+		{name: "帮助", args: []string{"-h"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := runPack(context.Background(), tt.args, testConfig(t, &fakeRunner{})); (err != nil) != tt.wantErr {
+				t.Errorf("runPack() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
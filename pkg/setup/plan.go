@@ -0,0 +1,318 @@
+package setup
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// 文件处理操作类型
+const (
+	opExtract = "extract"
+	opLoad    = "load"
+	opPull    = "pull"
+)
+
+// 单个文件的处理任务
+type fileTask struct {
+	Name string
+	Op   string
+}
+
+// 单个子目录的处理计划
+type subDirPlan struct {
+	Name  string
+	Tasks []fileTask
+}
+
+// 支持的压缩文件后缀，.tar.gz 和 .tgz 为 gzip 压缩
+var archiveSuffixes = []string{".tar", ".tar.gz", ".tgz", ".tar.zst", ".tzst", ".tar.xz", ".txz"}
+
+// 去掉压缩文件后缀，不是支持的压缩文件时返回 false
+func trimArchiveSuffix(name string) (string, bool) {
+	for _, suffix := range archiveSuffixes {
+		if base, ok := strings.CutSuffix(name, suffix); ok {
+			return base, true
+		}
+	}
+
+	return "", false
+}
+
+// 判断文件是否为 gzip 压缩的 tar 文件
+func isGzipArchive(name string) bool {
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// 判断文件是否为 zstd 压缩的 tar 文件
+func isZstdArchive(name string) bool {
+	return strings.HasSuffix(name, ".tar.zst") || strings.HasSuffix(name, ".tzst")
+}
+
+// 判断文件是否为 xz 压缩的 tar 文件
+func isXzArchive(name string) bool {
+	return strings.HasSuffix(name, ".tar.xz") || strings.HasSuffix(name, ".txz")
+}
+
+// 是否使用 archive/tar 处理 tar 文件，zstd 压缩的文件不依赖外部 tar 命令对 zstd 的支持，总是使用 archive/tar
+func useNativeTar(tarPath string, cfg *Config) bool {
+	return cfg.NativeExtract || isZstdArchive(tarPath)
+}
+
+// 构造 tar 命令的操作参数，例如 -xf、-xzvf
+func tarFlags(op, tarPath string, verbose bool) string {
+	flags := "-" + op
+	if isGzipArchive(tarPath) {
+		flags += "z"
+	}
+	if isXzArchive(tarPath) {
+		flags += "J"
+	}
+	if verbose {
+		flags += "v"
+	}
+
+	return flags + "f"
+}
+
+// 根据文件名判断处理方式，不是支持的压缩文件时返回 false
+func classifyArchive(name string) (string, bool) {
+	base, ok := trimArchiveSuffix(name)
+	if !ok {
+		return "", false
+	}
+
+	if base == "files" {
+		return opExtract, true
+	}
+
+	return opLoad, true
+}
+
+// gzip、zstd 和 xz 压缩的文件返回解压后的数据流
+func archiveReader(r io.Reader, name string) (io.Reader, error) {
+	if isZstdArchive(name) {
+		// 并发数为 1 时在调用方的 goroutine 中同步解压，无需关闭解压器
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("读取 zstd 文件 %s 失败: %w", name, err)
+		}
+		return zr, nil
+	}
+	if isXzArchive(name) {
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("读取 xz 文件 %s 失败: %w", name, err)
+		}
+		return xr, nil
+	}
+	if !isGzipArchive(name) {
+		return r, nil
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("读取 gzip 文件 %s 失败: %w", name, err)
+	}
+
+	return gz, nil
+}
+
+// 列出 tar 文件中的所有条目
+func listTarEntries(ctx context.Context, tarPath string, cfg *Config) ([]string, error) {
+	if useNativeTar(tarPath, cfg) {
+		return listNativeEntries(tarPath)
+	}
+
+	cmd := command(ctx, cfg, cfg.TarCmd, tarFlags("t", tarPath, false), tarPath)
+	output, err := cfg.runner().Output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("列出 tar 条目失败: %w", err)
+	}
+
+	var entries []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			entries = append(entries, line)
+		}
+	}
+
+	return entries, nil
+}
+
+// 根据主Stub文件的条目生成子目录处理计划
+// 与 processSubDir 保持一致，只处理 maxDepth 层以内子目录中的文件，更深的文件任务名为相对一级子目录的路径
+func buildPlan(entries []string, maxDepth int) []subDirPlan {
+	plans := make(map[string]*subDirPlan)
+
+	for _, entry := range entries {
+		parts := strings.Split(strings.TrimPrefix(path.Clean(entry), "./"), "/")
+		if len(parts) < 2 || len(parts) > max(1, maxDepth)+1 || parts[0] == minioDataDir {
+			continue
+		}
+
+		op, ok := classifyArchive(parts[len(parts)-1])
+		if !ok {
+			continue
+		}
+
+		plan, exists := plans[parts[0]]
+		if !exists {
+			plan = &subDirPlan{Name: parts[0]}
+			plans[parts[0]] = plan
+		}
+		plan.Tasks = append(plan.Tasks, fileTask{Name: path.Join(parts[1:]...), Op: op})
+	}
+
+	result := make([]subDirPlan, 0, len(plans))
+	for _, plan := range plans {
+		sort.Slice(plan.Tasks, func(i, j int) bool { return plan.Tasks[i].Name < plan.Tasks[j].Name })
+		result = append(result, *plan)
+	}
+	sort.Slice(result, func(i, j int) bool { return subDirLess(result[i].Name, result[j].Name) })
+
+	return result
+}
+
+// 以 DOT 格式输出处理计划，边表示处理顺序：解压后处理第一批子目录，每一批完成后处理下一批
+func writePlanDot(w io.Writer, stubName string, plans []subDirPlan) error {
+	var b strings.Builder
+
+	b.WriteString("digraph plan {\n")
+	b.WriteString("\trankdir=LR;\n")
+	fmt.Fprintf(&b, "\t%q [shape=box, label=%q];\n", stubName, stubName+"\nextract")
+
+	names := make([]string, 0, len(plans))
+	for _, plan := range plans {
+		label := plan.Name
+		for _, task := range plan.Tasks {
+			label += "\n" + task.Op + ": " + task.Name
+		}
+		fmt.Fprintf(&b, "\t%q [label=%q];\n", plan.Name, label)
+		names = append(names, plan.Name)
+	}
+
+	// 第一批子目录在解压后处理，之后的每一批在上一批全部完成后处理
+	prev := []string{stubName}
+	for _, batch := range subDirBatches(names) {
+		for _, from := range prev {
+			for _, to := range batch {
+				fmt.Fprintf(&b, "\t%q -> %q;\n", from, to)
+			}
+		}
+		prev = batch
+	}
+
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// 生成处理计划并写入 DOT 文件
+func emitPlanDot(ctx context.Context, stubTar string, cfg *Config) error {
+	if _, err := os.Stat(stubTar); os.IsNotExist(err) {
+		return fmt.Errorf("STUB 文件不存在: %w", err)
+	}
+
+	entries, err := listTarEntries(ctx, stubTar, cfg)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(cfg.EmitDot)
+	if err != nil {
+		return fmt.Errorf("创建 DOT 文件失败: %w", err)
+	}
+	defer f.Close()
+
+	if err := writePlanDot(f, filepath.Base(stubTar), buildPlan(entries, cfg.MaxDepth)); err != nil {
+		return fmt.Errorf("写入 DOT 文件失败: %w", err)
+	}
+
+	slog.Info("处理计划已写入", "file", cfg.EmitDot)
+	return nil
+}
+
+// 只读地检查主机状态：哪些镜像已存在、哪些将被加载、Compose 项目是否在运行
+// 通过 DOCKER_HOST 或 Docker 上下文可以检查远程主机
+func remotePlan(ctx context.Context, stubTar, cwd string, cfg *Config) error {
+	if _, err := os.Stat(stubTar); os.IsNotExist(err) {
+		return fmt.Errorf("STUB 文件不存在: %w", err)
+	}
+
+	summary, err := summarizeStub(stubTar)
+	if err != nil {
+		return err
+	}
+
+	files := make([]string, 0, len(summary.Tags))
+	for file := range summary.Tags {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var present, missing int
+	for _, file := range files {
+		for _, tag := range summary.Tags[file] {
+			if imageID(ctx, tag, subDirManifest{}, cfg) != "" {
+				present++
+				slog.Info("镜像已存在", "file", file, "image", tag)
+			} else {
+				missing++
+				slog.Info("将加载镜像", "file", file, "image", tag)
+			}
+		}
+	}
+
+	project := strings.ToLower(filepath.Base(cwd))
+	state, err := composeProjectStatus(ctx, project, cfg)
+	if err != nil {
+		slog.Warn("查询 Compose 项目状态失败", "project", project, "error", err)
+	} else {
+		slog.Info("Compose 项目状态", "project", project, "status", state)
+	}
+
+	slog.Info("检查完成，未做任何修改", "present", present, "toLoad", missing)
+	return nil
+}
+
+// 查询 Compose 项目的运行状态，项目不存在时返回 "not running"
+// 使用 ComposeCmd 和 ComposeFile，docker-compose v1 不支持 ls 命令
+func composeProjectStatus(ctx context.Context, project string, cfg *Config) (string, error) {
+	if isComposeV1(cfg) {
+		return "", fmt.Errorf("%s 不支持 ls 命令", cfg.ComposeCmd)
+	}
+
+	output, err := cfg.runner().Output(composeCommand(ctx, cfg, "ls", "--all", "--format", "json"))
+	if err != nil {
+		return "", fmt.Errorf("%s ls 命令失败: %w", cfg.ComposeCmd, err)
+	}
+
+	var projects []struct {
+		Name   string
+		Status string
+	}
+	if err := json.Unmarshal(output, &projects); err != nil {
+		return "", fmt.Errorf("解析 %s ls 输出失败: %w", cfg.ComposeCmd, err)
+	}
+
+	for _, p := range projects {
+		if p.Name == project {
+			return p.Status, nil
+		}
+	}
+
+	return "not running", nil
+}
@@ -0,0 +1,104 @@
+package setup
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWritePlanDotBatches(t *testing.T) {
+	plans := []subDirPlan{
+		{Name: "00-base"},
+		{Name: "0-common"},
+		{Name: "10-app"},
+		{Name: "extras"},
+	}
+
+	var b strings.Builder
+	if err := writePlanDot(&b, "stub.tar.gz", plans); err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+
+	want := []string{
+		`"stub.tar.gz" -> "00-base";`,
+		`"stub.tar.gz" -> "0-common";`,
+		`"00-base" -> "10-app";`,
+		`"0-common" -> "10-app";`,
+		`"10-app" -> "extras";`,
+	}
+	for _, edge := range want {
+		if !strings.Contains(got, edge) {
+			t.Errorf("writePlanDot() 缺少边 %s:\n%s", edge, got)
+		}
+	}
+	if n := strings.Count(got, "->"); n != len(want) {
+		t.Errorf("writePlanDot() 有 %d 条边, want %d:\n%s", n, len(want), got)
+	}
+}
+
+func TestComposeProjectStatus(t *testing.T) {
+	runner := &fakeRunner{respond: func(args []string) ([]byte, error) {
+		return []byte(`[{"Name":"other","Status":"running(1)"},{"Name":"app","Status":"running(3)"}]`), nil
+	}}
+	cfg := testConfig(t, runner)
+	cfg.ComposeCmd = "podman compose"
+	cfg.ComposeFile = "compose.prod.yml"
+
+	got, err := composeProjectStatus(context.Background(), "app", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "running(3)" {
+		t.Errorf("composeProjectStatus() = %q, want running(3)", got)
+	}
+	if calls := runner.called("podman compose -f compose.prod.yml ls --all --format json"); len(calls) != 1 {
+		t.Errorf("没有使用 ComposeCmd 和 ComposeFile 查询，执行了 %v", runner.calls)
+	}
+
+	if got, err := composeProjectStatus(context.Background(), "missing", cfg); err != nil || got != "not running" {
+		t.Errorf("composeProjectStatus() = %q, %v, want not running", got, err)
+	}
+}
+
+func TestClassifyArchive(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		op        string
+		ok        bool
+		flags     string
+		verbFlags string
+	}{
+		{name: "app.tar", base: "app", op: opLoad, ok: true, flags: "-xf", verbFlags: "-xvf"},
+		{name: "app.tar.gz", base: "app", op: opLoad, ok: true, flags: "-xzf", verbFlags: "-xzvf"},
+		{name: "app.tgz", base: "app", op: opLoad, ok: true, flags: "-xzf", verbFlags: "-xzvf"},
+		{name: "app.tar.zst", base: "app", op: opLoad, ok: true, flags: "-xf", verbFlags: "-xvf"},
+		{name: "app.tzst", base: "app", op: opLoad, ok: true, flags: "-xf", verbFlags: "-xvf"},
+		{name: "app.tar.xz", base: "app", op: opLoad, ok: true, flags: "-xJf", verbFlags: "-xJvf"},
+		{name: "app.txz", base: "app", op: opLoad, ok: true, flags: "-xJf", verbFlags: "-xJvf"},
+		{name: "files.tar", base: "files", op: opExtract, ok: true, flags: "-xf", verbFlags: "-xvf"},
+		{name: "files.tar.gz", base: "files", op: opExtract, ok: true, flags: "-xzf", verbFlags: "-xzvf"},
+		{name: "myfiles.tar", base: "myfiles", op: opLoad, ok: true, flags: "-xf", verbFlags: "-xvf"},
+		{name: "app.zip", flags: "-xf", verbFlags: "-xvf"},
+		{name: "app.gz", flags: "-xf", verbFlags: "-xvf"},
+		{name: "README", flags: "-xf", verbFlags: "-xvf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if base, ok := trimArchiveSuffix(tt.name); base != tt.base || ok != tt.ok {
+				t.Errorf("trimArchiveSuffix() = %q, %v, want %q, %v", base, ok, tt.base, tt.ok)
+			}
+			if op, ok := classifyArchive(tt.name); op != tt.op || ok != tt.ok {
+				t.Errorf("classifyArchive() = %q, %v, want %q, %v", op, ok, tt.op, tt.ok)
+			}
+			if got := tarFlags("x", tt.name, false); got != tt.flags {
+				t.Errorf("tarFlags(x) = %q, want %q", got, tt.flags)
+			}
+			if got := tarFlags("x", tt.name, true); got != tt.verbFlags {
+				t.Errorf("tarFlags(x, verbose) = %q, want %q", got, tt.verbFlags)
+			}
+		})
+	}
+}
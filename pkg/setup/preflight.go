@@ -0,0 +1,327 @@
+package setup
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 镜像 tar 中可能是镜像配置的文件的最大大小，更大的文件视为镜像层，不读取内容
+const maxImageConfigSize = 1 << 20
+
+// 开始修改前执行预检：依赖命令、剩余磁盘空间、Docker 守护进程、需要的端口以及镜像和 Stub 的架构
+// 依赖命令缺失时其余检查可能无法执行，直接返回；其余检查全部完成后一并报告所有失败
+func preflight(ctx context.Context, stubTar, cwd string, cfg *Config) error {
+	if err := checkDependencies(ctx, cfg); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(stubTar); os.IsNotExist(err) {
+		return fmt.Errorf("STUB 文件不存在: %w", err)
+	}
+
+	summary, err := summarizeStub(stubTar)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	if err := checkFreeSpace(summary.Size, cwd, cfg); err != nil {
+		errs = append(errs, err)
+	}
+	if !cfg.FilesOnly {
+		if err := checkDaemonReachable(ctx, cfg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := checkPreflightPorts(ctx, summary, cfg); err != nil {
+		errs = append(errs, err)
+	}
+	if err := checkPreflightArch(summary, cfg); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("预检失败: %w", errorList(errs))
+	}
+
+	slog.Info("预检通过", "required", formatBytes(int64(summary.Size)), "images", len(selectedImageArches(summary, cfg)))
+	return nil
+}
+
+// 从 docker save 生成的镜像 tar 数据流中读取镜像的 RepoTags 和每个镜像的架构，没有标签的镜像以配置文件名代替
+// 镜像配置可能位于 manifest.json 之前或之后，先记录所有较小的 JSON 文件中的架构
+func imageArchesFromTar(r io.Reader) ([]string, map[string]string, error) {
+	configs := make(map[string]string)
+	var entries []struct {
+		Config   string
+		RepoTags []string
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取失败: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Size > maxImageConfigSize {
+			continue
+		}
+
+		name := strings.TrimPrefix(path.Clean(hdr.Name), "./")
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取 %s 失败: %w", name, err)
+		}
+		if name == "manifest.json" {
+			if err := json.Unmarshal(data, &entries); err != nil {
+				return nil, nil, fmt.Errorf("解析 manifest.json 失败: %w", err)
+			}
+			continue
+		}
+
+		var config struct {
+			Architecture string `json:"architecture"`
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) && json.Unmarshal(data, &config) == nil && config.Architecture != "" {
+			configs[name] = config.Architecture
+		}
+	}
+	if entries == nil {
+		return nil, nil, fmt.Errorf("没有 manifest.json")
+	}
+
+	var tags []string
+	arches := make(map[string]string)
+	for _, entry := range entries {
+		tags = append(tags, entry.RepoTags...)
+		arch, ok := configs[path.Clean(entry.Config)]
+		if !ok {
+			continue
+		}
+		if len(entry.RepoTags) == 0 {
+			arches[entry.Config] = arch
+		}
+		for _, tag := range entry.RepoTags {
+			arches[tag] = arch
+		}
+	}
+
+	return tags, arches, nil
+}
+
+// 确认 Docker 守护进程可以连接，使用 Docker SDK 时已在 checkDependencies 中检查
+func checkDaemonReachable(ctx context.Context, cfg *Config) error {
+	if !needDockerCLI(cfg) {
+		return nil
+	}
+
+	if output, err := cfg.runner().CombinedOutput(command(ctx, cfg, cfg.DockerCmd, "info")); err != nil {
+		return fmt.Errorf("连接 Docker 守护进程失败: %w, 输出: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// compose ps 输出的端口中发布到主机的端口，例如 0.0.0.0:9000->9000/tcp
+var publishedPortPattern = regexp.MustCompile(`:(\d+)->`)
+
+// 检查 PreflightPorts 和 Compose 文件中发布的 TCP 端口未被占用
+// 已被本项目 Compose 服务占用的端口视为可用，以便重复运行
+func checkPreflightPorts(ctx context.Context, summary *stubSummary, cfg *Config) error {
+	ports := slices.Clone(cfg.PreflightPorts)
+	var own []int
+	if cfg.composeEnabled() {
+		for _, name := range composeFileNames {
+			data, ok := summary.Root[name]
+			if !ok || name == ".env" {
+				continue
+			}
+			composePorts, err := composePublishedPorts(data)
+			if err != nil {
+				return fmt.Errorf("解析 Compose 文件 %s 失败: %w", name, err)
+			}
+			ports = append(ports, composePorts...)
+		}
+
+		if services, err := composeStatus(ctx, cfg); err == nil {
+			for _, s := range services {
+				for _, m := range publishedPortPattern.FindAllStringSubmatch(s.Ports, -1) {
+					port, _ := strconv.Atoi(m[1])
+					own = append(own, port)
+				}
+			}
+		} else {
+			slog.Debug("无法获取已运行的 Compose 服务，不排除其占用的端口", "error", err)
+		}
+	}
+	slices.Sort(ports)
+	ports = slices.Compact(ports)
+
+	var busy []string
+	for _, port := range ports {
+		if slices.Contains(own, port) {
+			continue
+		}
+		if portInUse(port) {
+			busy = append(busy, strconv.Itoa(port))
+		}
+	}
+
+	if len(busy) > 0 {
+		return fmt.Errorf("端口已被占用: %s", strings.Join(busy, ", "))
+	}
+	return nil
+}
+
+// 端口是否已被其他进程监听，没有权限监听等其他错误不视为占用
+func portInUse(port int) bool {
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return errors.Is(err, syscall.EADDRINUSE)
+	}
+	l.Close()
+	return false
+}
+
+// 解析 Compose 文件中各服务发布到主机的 TCP 端口，支持短格式和长格式，无法解析的端口（例如包含变量）跳过
+func composePublishedPorts(data []byte) ([]int, error) {
+	var doc struct {
+		Services map[string]struct {
+			Ports []yaml.Node `yaml:"ports"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var ports []int
+	for _, service := range doc.Services {
+		for _, node := range service.Ports {
+			switch node.Kind {
+			case yaml.ScalarNode:
+				ports = append(ports, parseShortPort(node.Value)...)
+			case yaml.MappingNode:
+				var long struct {
+					Published string `yaml:"published"`
+					Protocol  string `yaml:"protocol"`
+				}
+				if err := node.Decode(&long); err != nil {
+					return nil, err
+				}
+				if long.Protocol == "" || long.Protocol == "tcp" {
+					ports = append(ports, parsePortRange(long.Published)...)
+				}
+			}
+		}
+	}
+
+	return ports, nil
+}
+
+// 解析短格式的端口，例如 8080:80、127.0.0.1:8080:80、[::1]:8080:80、9090-9091:8080-8081/tcp
+// 只指定容器端口时主机端口随机分配，不需要检查
+func parseShortPort(s string) []int {
+	s, protocol, _ := strings.Cut(s, "/")
+	if protocol != "" && protocol != "tcp" {
+		return nil
+	}
+
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return nil
+	}
+	host := s[:i]
+	if j := strings.LastIndex(host, ":"); j >= 0 {
+		host = host[j+1:]
+	}
+
+	return parsePortRange(host)
+}
+
+// 解析 8080 或 8080-8081 格式的端口范围
+func parsePortRange(s string) []int {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		to = from
+	}
+
+	first, err1 := strconv.Atoi(from)
+	last, err2 := strconv.Atoi(to)
+	if err1 != nil || err2 != nil || first <= 0 || last > 65535 || first > last {
+		return nil
+	}
+
+	var ports []int
+	for port := first; port <= last; port++ {
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// 检查清单声明的目标平台以及镜像文件中镜像的架构是否与目标架构一致
+// ArchCheck 为 error 时镜像架构不一致视为失败，否则只警告
+func checkPreflightArch(summary *stubSummary, cfg *Config) error {
+	var errs []error
+	if data, ok := summary.Root[cfg.ManifestName]; ok {
+		m, err := parseManifest(data, cfg.ManifestName)
+		if err != nil {
+			return err
+		}
+		if err := checkPlatform(m, cfg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if !cfg.FilesOnly {
+		want := targetArch(cfg)
+		var mismatched []string
+		for image, arch := range selectedImageArches(summary, cfg) {
+			if arch != want {
+				mismatched = append(mismatched, fmt.Sprintf("%s(%s)", image, arch))
+			}
+		}
+		slices.Sort(mismatched)
+
+		if len(mismatched) > 0 {
+			if cfg.ArchCheck == archCheckError {
+				errs = append(errs, fmt.Errorf("镜像架构与目标架构 %s 不一致: %s", want, strings.Join(mismatched, ", ")))
+			} else {
+				slog.Warn("镜像架构与目标架构不一致", "targetArch", want, "images", mismatched)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// 按目标架构选择的镜像文件中镜像的架构，键为 文件:镜像
+func selectedImageArches(summary *stubSummary, cfg *Config) map[string]string {
+	arches := make(map[string]string)
+	for file, images := range summary.Arches {
+		if !archSelected(path.Base(file), cfg) {
+			continue
+		}
+		for image, arch := range images {
+			arches[file+":"+image] = arch
+		}
+	}
+	return arches
+}
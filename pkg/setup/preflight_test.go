@@ -0,0 +1,108 @@
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+// 读取测试用 tar 文件的内容，用作其他 tar 文件中的条目
+func readTestTar(t *testing.T, name string, entries []testEntry) string {
+	t.Helper()
+
+	data, err := os.ReadFile(writeTestTar(t, name, entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSummarizeStubForPreflight(t *testing.T) {
+	image := readTestTar(t, "app.tar", []testEntry{
+		{Name: "abc.json", Typeflag: tar.TypeReg, Body: `{"architecture":"arm64"}`},
+		{Name: "manifest.json", Typeflag: tar.TypeReg, Body: `[{"Config":"abc.json","RepoTags":["app:1.0"]}]`},
+	})
+	files := readTestTar(t, "files.tar", []testEntry{
+		{Name: "data.bin", Typeflag: tar.TypeReg, Body: strings.Repeat("x", 100)},
+	})
+	stubTar := writeTestTar(t, "stub.tar", []testEntry{
+		{Name: "./docker-compose.yml", Typeflag: tar.TypeReg, Body: "services: {}"},
+		{Name: "10-app/app.tar", Typeflag: tar.TypeReg, Body: image},
+		{Name: "10-app/files.tar", Typeflag: tar.TypeReg, Body: files},
+	})
+
+	summary, err := summarizeStub(stubTar)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := uint64(len("services: {}") + len(image) + len(files) + 100); summary.Size != want {
+		t.Errorf("Size = %d, want %d", summary.Size, want)
+	}
+	if got := string(summary.Root["docker-compose.yml"]); got != "services: {}" {
+		t.Errorf("Root[docker-compose.yml] = %q", got)
+	}
+	if _, ok := summary.Root["10-app/files.tar"]; ok {
+		t.Errorf("Root 中包含了子目录中的文件")
+	}
+	if got := summary.Arches["10-app/app.tar"]["app:1.0"]; got != "arm64" {
+		t.Errorf("Arches = %v, want app:1.0 为 arm64", summary.Arches)
+	}
+	if got := summary.Tags["10-app/app.tar"]; len(got) != 1 || got[0] != "app:1.0" {
+		t.Errorf("Tags = %v, want [app:1.0]", summary.Tags)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Arch = "amd64"
+	if err := checkPreflightArch(summary, cfg); err != nil {
+		t.Errorf("镜像架构不一致默认只警告: %v", err)
+	}
+	cfg.ArchCheck = archCheckError
+	if err := checkPreflightArch(summary, cfg); err == nil || !strings.Contains(err.Error(), "10-app/app.tar:app:1.0(arm64)") {
+		t.Errorf("checkPreflightArch() error = %v, want 镜像架构不一致", err)
+	}
+}
+
+func TestCheckPreflightPorts(t *testing.T) {
+	if ports := DefaultConfig().PreflightPorts; len(ports) > 0 {
+		t.Errorf("默认的 PreflightPorts = %v, 应只检查 Compose 文件中发布的端口", ports)
+	}
+
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	busy := l.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name    string
+		compose string
+		ports   []int
+		wantErr bool
+	}{
+		{name: "默认不检查固定端口", compose: "services: {}"},
+		{name: "Compose 文件中发布的端口被占用", compose: fmt.Sprintf("services:\n  app:\n    ports: [\"%d:80\"]\n", busy), wantErr: true},
+		{name: "额外指定的端口被占用", compose: "services: {}", ports: []int{busy}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, &fakeRunner{})
+			cfg.StartCompose = true
+			if tt.ports != nil {
+				cfg.PreflightPorts = tt.ports
+			}
+			summary := &stubSummary{Root: map[string][]byte{"docker-compose.yml": []byte(tt.compose)}}
+
+			err := checkPreflightPorts(context.Background(), summary, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkPreflightPorts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package setup
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 整体进度的输出方式
+const (
+	progressAuto = "auto" // 输出到终端时显示进度条，否则定时输出日志
+	progressBar  = "bar"
+	progressLog  = "log"
+	progressOff  = "off"
+)
+
+// 进度条的刷新间隔
+const progressBarInterval = 500 * time.Millisecond
+
+// 进度条的宽度
+const progressBarWidth = 30
+
+// 单个子目录的处理进度
+type dirProgress struct {
+	total      int64
+	done       int64
+	images     int
+	imagesDone int
+}
+
+// 整体处理进度：按子目录统计已处理的压缩文件字节数和镜像数，可并发使用
+type overallProgress struct {
+	mu    sync.Mutex
+	cwd   string
+	phase string
+	dirs  map[string]*dirProgress
+	order []string
+	files map[string]int64
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// 统计 subDirs 中需要处理的压缩文件和镜像，按 cfg.Progress 定时输出整体进度，返回停止输出的函数
+func (p *overallProgress) start(cwd string, subDirs []string, only string, cfg *Config) func() {
+	mode := cfg.Progress
+	if mode == progressAuto {
+		mode = progressLog
+		if isTerminal(os.Stderr) {
+			mode = progressBar
+		}
+	}
+	if mode == progressOff || len(subDirs) == 0 {
+		return func() {}
+	}
+
+	p.mu.Lock()
+	p.cwd, p.phase = cwd, only
+	p.dirs = make(map[string]*dirProgress)
+	p.order = slices.Clone(subDirs)
+	p.files = make(map[string]int64)
+	for _, subDir := range subDirs {
+		d := &dirProgress{}
+		p.dirs[subDir] = d
+		p.scan(filepath.Join(cwd, subDir), d, only, 1, cfg)
+	}
+	p.stop, p.done = make(chan struct{}), make(chan struct{})
+	p.mu.Unlock()
+
+	interval := cfg.ProgressInterval
+	if mode == progressBar {
+		interval = progressBarInterval
+	}
+	go p.run(mode, interval)
+
+	return func() {
+		close(p.stop)
+		<-p.done
+	}
+}
+
+// 统计目录中需要处理的压缩文件大小和镜像数，调用方需持有 p.mu
+func (p *overallProgress) scan(dir string, d *dirProgress, only string, depth int, cfg *Config) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	if refs, _ := readImageList(filepath.Join(dir, imageListName)); refs != nil && only != opExtract {
+		d.images += len(refs)
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if depth < cfg.MaxDepth {
+				p.scan(path, d, only, depth+1, cfg)
+			}
+			continue
+		}
+
+		op, ok := classifyArchive(entry.Name())
+		if !ok || (only != "" && op != only) || (op == opLoad && cfg.FilesOnly) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		p.files[path] = info.Size()
+		d.total += info.Size()
+		if op == opLoad {
+			d.images++
+		}
+	}
+}
+
+// 记录一个文件或镜像引用处理完成，未统计过的文件(例如解压出的下一级目录中的文件)一并计入总量
+func (p *overallProgress) fileDone(filePath, op string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.dirs == nil {
+		return
+	}
+	rel, err := filepath.Rel(p.cwd, filePath)
+	if err != nil {
+		return
+	}
+	subDir, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	d, ok := p.dirs[subDir]
+	if !ok {
+		return
+	}
+
+	if op == opPull {
+		d.imagesDone++
+		return
+	}
+
+	size, ok := p.files[filePath]
+	if !ok {
+		if info, err := os.Stat(filePath); err == nil {
+			size = info.Size()
+		}
+		d.total += size
+		if op == opLoad {
+			d.images++
+		}
+	}
+	delete(p.files, filePath)
+
+	d.done += size
+	if op == opLoad {
+		d.imagesDone++
+	}
+}
+
+// 定时输出进度直到停止，停止时输出最终进度
+func (p *overallProgress) run(mode string, interval time.Duration) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := ""
+	for {
+		select {
+		case <-p.stop:
+			if mode == progressBar {
+				fmt.Fprintf(os.Stderr, "\r\033[K%s\n", p.bar())
+			} else {
+				p.log()
+			}
+
+			p.mu.Lock()
+			p.dirs = nil
+			p.mu.Unlock()
+			return
+		case <-ticker.C:
+			if mode == progressBar {
+				fmt.Fprintf(os.Stderr, "\r\033[K%s", p.bar())
+				continue
+			}
+			// 没有变化时不重复输出日志
+			if line := p.bar(); line != last {
+				last = line
+				p.log()
+			}
+		}
+	}
+}
+
+// 汇总所有子目录的进度，并列出正在处理的子目录
+func (p *overallProgress) totals() (total, done int64, images, imagesDone int, active []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, name := range p.order {
+		d := p.dirs[name]
+		total += d.total
+		done += d.done
+		images += d.images
+		imagesDone += d.imagesDone
+		if d.done > 0 && d.done < d.total {
+			active = append(active, fmt.Sprintf("%s %d%%", name, d.done*100/d.total))
+		}
+	}
+
+	return total, done, images, imagesDone, active
+}
+
+// 进度条，例如 [#######.......] 45% 12.3 GiB/27.0 GiB 镜像 3/10
+func (p *overallProgress) bar() string {
+	total, done, images, imagesDone, active := p.totals()
+
+	percent := int64(100)
+	if total > 0 {
+		percent = done * 100 / total
+	}
+	filled := int(percent) * progressBarWidth / 100
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s%s] %3d%% %s/%s 镜像 %d/%d",
+		strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled),
+		percent, formatBytes(done), formatBytes(total), imagesDone, images)
+	if len(active) > 0 {
+		fmt.Fprintf(&b, " | %s", strings.Join(active, ", "))
+	}
+
+	return b.String()
+}
+
+// 以结构化日志输出整体进度和正在处理的子目录
+func (p *overallProgress) log() {
+	total, done, images, imagesDone, active := p.totals()
+
+	percent := int64(100)
+	if total > 0 {
+		percent = done * 100 / total
+	}
+	attrs := []any{
+		"progress", fmt.Sprintf("%d%%", percent),
+		"bytes", formatBytes(done) + "/" + formatBytes(total),
+		"images", fmt.Sprintf("%d/%d", imagesDone, images),
+	}
+	if len(active) > 0 {
+		attrs = append(attrs, "subdirs", active)
+	}
+	if p.phase != "" {
+		attrs = append(attrs, "phase", p.phase)
+	}
+	slog.Info("整体处理进度", attrs...)
+}
+
+// 判断输出是否为终端
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
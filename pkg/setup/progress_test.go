@@ -0,0 +1,64 @@
+package setup
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProgressFinalLog(t *testing.T) {
+	var buf bytes.Buffer
+	orig := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(orig) })
+
+	cfg := testConfig(t, &fakeRunner{respond: loadedImages("app:1")})
+	cfg.Progress = progressLog
+	cfg.ProgressInterval = time.Hour
+
+	// 下一级目录中的镜像文件在开始时没有统计，处理完成后计入总量
+	cfg.MaxDepth = 2
+	files := map[string]string{
+		"10-app/app.tar":       "image",
+		"10-app/files.tar":     readTestTar(t, "files.tar", []testEntry{{Name: "config.yaml", Typeflag: tar.TypeReg, Body: "a: 1"}}),
+		"10-app/plugins/p.tar": "plugin",
+		"20-web/web.tar":       "web image",
+	}
+	for name, body := range files {
+		p := filepath.Join(cfg.WorkDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := processStubDir(context.Background(), cfg.WorkDir, &manifest{}, "", nil, cfg); err != nil {
+		t.Fatalf("processStubDir() error = %v", err)
+	}
+
+	var last map[string]any
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var record map[string]any
+		if err := dec.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		if record["msg"] == "整体处理进度" {
+			last = record
+		}
+	}
+	if last == nil {
+		t.Fatal("没有输出整体处理进度")
+	}
+	if last["progress"] != "100%" || last["images"] != "3/3" {
+		t.Errorf("最终进度为 %v，镜像 %v, want 100%%，3/3", last["progress"], last["images"])
+	}
+}
@@ -0,0 +1,115 @@
+package setup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// 子目录中列出需要从仓库拉取的镜像的文件，每行一个 repo:tag
+const imageListName = "images.txt"
+
+// 拉取镜像前登录的仓库
+type RegistryLogin struct {
+	Server   string `yaml:"server"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// 读取镜像列表文件，忽略空行和 # 开头的注释，文件不存在时返回 nil
+func readImageList(listPath string) ([]string, error) {
+	f, err := os.Open(listPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取镜像列表失败: %w", err)
+	}
+	defer f.Close()
+
+	var refs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		refs = append(refs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取镜像列表失败: %w", err)
+	}
+
+	return refs, nil
+}
+
+// 登录镜像仓库，密码通过标准输入传入
+func dockerLogin(ctx context.Context, cfg *Config) error {
+	login := cfg.RegistryLogin
+
+	cmd := command(ctx, cfg, cfg.DockerCmd, "login", login.Server, "--username", login.Username, "--password-stdin")
+	if dryRun(cmd, cfg) {
+		return nil
+	}
+
+	slog.Info("正在登录镜像仓库", "server", login.Server, "username", login.Username)
+	return retry(ctx, cfg, "docker login "+login.Server, func(ctx context.Context) error {
+		cmd := command(ctx, cfg, cfg.DockerCmd, "login", login.Server, "--username", login.Username, "--password-stdin")
+		cmd.Stdin = strings.NewReader(login.Password)
+		if output, err := cfg.runner().CombinedOutput(cmd); err != nil {
+			return fmt.Errorf("docker login 命令失败: %w, 输出: %s", err, output)
+		}
+		return nil
+	})
+}
+
+// 从仓库拉取镜像
+func pullImage(ctx context.Context, ref string, sub subDirManifest, cfg *Config) error {
+	if !repoAllowed(ref, cfg) {
+		return fmt.Errorf("镜像 %s 不在允许的仓库列表中", ref)
+	}
+
+	if cfg.SkipExistingImages && imageID(ctx, ref, sub, cfg) != "" {
+		slog.Info("镜像已存在，跳过拉取", "image", ref)
+		// 中继模式下已存在的镜像同样需要推送到中继仓库
+		if cfg.Relay.Enabled {
+			return relayImages(ctx, []string{ref}, sub, cfg)
+		}
+		return nil
+	}
+
+	pullArgs := dockerArgs(sub.DockerContext, "pull", ref)
+	if dryRun(command(ctx, cfg, cfg.DockerCmd, pullArgs...), cfg) {
+		return nil
+	}
+
+	slog.Info("正在拉取Docker镜像", "image", ref, "context", sub.DockerContext)
+	err := retry(ctx, cfg, "docker pull "+ref, func(ctx context.Context) error {
+		output, err := combinedOutput(command(ctx, cfg, cfg.DockerCmd, pullArgs...), ref, cfg)
+		if err != nil {
+			return fmt.Errorf("docker pull 命令失败: %w, 输出: %s", err, output)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	images := []string{ref}
+	if err := checkImageArch(ctx, images, sub, cfg); err != nil {
+		return err
+	}
+
+	// 中继模式下推送到中继仓库
+	if cfg.Relay.Enabled {
+		if err := relayImages(ctx, images, sub, cfg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package setup
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadImageList(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		missing bool
+		want    []string
+	}{
+		{name: "文件不存在", missing: true},
+		{name: "忽略空行和注释", content: "# 基础镜像\nnginx:1.25\n\n  redis:7  \n# registry.example.com/app:1\nregistry.example.com/app:2\n", want: []string{"nginx:1.25", "redis:7", "registry.example.com/app:2"}},
+		{name: "Windows 换行", content: "nginx:1.25\r\nredis:7\r\n", want: []string{"nginx:1.25", "redis:7"}},
+		{name: "空文件", content: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listPath := filepath.Join(t.TempDir(), imageListName)
+			if !tt.missing {
+				if err := os.WriteFile(listPath, []byte(tt.content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := readImageList(listPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("readImageList() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 记录命令标准输入的 fakeRunner
+type stdinRunner struct {
+	fakeRunner
+	stdin []string
+}
+
+func (r *stdinRunner) Run(cmd *exec.Cmd) error {
+	_, err := r.CombinedOutput(cmd)
+	return err
+}
+
+func (r *stdinRunner) Output(cmd *exec.Cmd) ([]byte, error) { return r.CombinedOutput(cmd) }
+
+func (r *stdinRunner) CombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	if cmd.Stdin != nil {
+		data, _ := io.ReadAll(cmd.Stdin)
+		r.mu.Lock()
+		r.stdin = append(r.stdin, string(data))
+		r.mu.Unlock()
+	}
+	return r.fakeRunner.CombinedOutput(cmd)
+}
+
+func TestPullImages(t *testing.T) {
+	runner := &stdinRunner{}
+	cfg := testConfig(t, nil)
+	cfg.Runner = runner
+	cfg.RegistryLogin = RegistryLogin{Server: "registry.example.com", Username: "deploy", Password: "s3cret"}
+
+	if err := dockerLogin(context.Background(), cfg); err != nil {
+		t.Fatalf("dockerLogin() error = %v", err)
+	}
+	if err := pullImage(context.Background(), "registry.example.com/app:2", subDirManifest{DockerContext: "remote"}, cfg); err != nil {
+		t.Fatalf("pullImage() error = %v", err)
+	}
+
+	// 密码只通过标准输入传入
+	want := []string{
+		"docker login registry.example.com --username deploy --password-stdin",
+		"docker --context remote pull registry.example.com/app:2",
+	}
+	if !slices.Equal(runner.calls, want) {
+		t.Errorf("执行了 %q, want %q", runner.calls, want)
+	}
+	if !slices.Equal(runner.stdin, []string{"s3cret"}) {
+		t.Errorf("标准输入为 %q, want 只有登录密码", runner.stdin)
+	}
+	if strings.Contains(strings.Join(runner.calls, " "), "s3cret") {
+		t.Errorf("命令参数中包含密码")
+	}
+}
@@ -0,0 +1,114 @@
+package setup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 中继模式配置：加载镜像后重新打标签并推送到指定仓库，默认不启动 Compose 和 Minio
+// Services 时推送后照常启动服务，供其他节点从该仓库拉取；RemoveLocal 时推送后删除本地镜像，只保留在仓库中
+// ListFile 不为空时将推送的镜像引用写入该文件，格式与 images.txt 相同，其他节点可直接使用
+type RelayConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Registry    string `yaml:"registry"`
+	Prefix      string `yaml:"prefix"`
+	Services    bool   `yaml:"services"`
+	RemoveLocal bool   `yaml:"removeLocal"`
+	ListFile    string `yaml:"listFile"`
+}
+
+// 已推送到中继仓库的镜像引用，可并发使用
+type relayList struct {
+	mu   sync.Mutex
+	refs []string
+}
+
+func (l *relayList) add(ref string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refs = append(l.refs, ref)
+}
+
+// 将推送的镜像引用按推送顺序写入文件，每行一个
+func (l *relayList) write(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# setup 推送到中继仓库的镜像\n")
+	for _, ref := range l.refs {
+		b.WriteString(ref + "\n")
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("写入中继镜像列表失败: %w", err)
+	}
+
+	slog.Info("已写入中继镜像列表", "file", path, "images", len(l.refs))
+	return nil
+}
+
+// 计算镜像在中继仓库中的引用，去掉原有的仓库地址
+func relayRef(ref string, relay RelayConfig) string {
+	// 第一段包含 "." 或 ":" 或为 localhost 时视为仓库地址
+	if first, rest, ok := strings.Cut(ref, "/"); ok {
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			ref = rest
+		}
+	}
+
+	parts := []string{strings.TrimSuffix(relay.Registry, "/")}
+	if prefix := strings.Trim(relay.Prefix, "/"); prefix != "" {
+		parts = append(parts, prefix)
+	}
+
+	return strings.Join(append(parts, ref), "/")
+}
+
+// 将已加载的镜像重新打标签并推送到中继仓库
+func relayImages(ctx context.Context, images []string, sub subDirManifest, cfg *Config) error {
+	for _, image := range images {
+		// 只有镜像 ID 没有标签的镜像无法推送
+		if strings.HasPrefix(image, "sha256:") {
+			slog.Warn("镜像没有标签，跳过推送", "image", image)
+			continue
+		}
+
+		target := relayRef(image, cfg.Relay)
+
+		tagCmd := command(ctx, cfg, cfg.DockerCmd, dockerArgs(sub.DockerContext, "tag", image, target)...)
+		if output, err := cfg.runner().CombinedOutput(tagCmd); err != nil {
+			return fmt.Errorf("docker tag 命令失败: %w, 输出: %s", err, output)
+		}
+
+		slog.Info("正在推送镜像", "image", image, "target", target)
+		err := retry(ctx, cfg, "docker push "+target, func(ctx context.Context) error {
+			pushCmd := command(ctx, cfg, cfg.DockerCmd, dockerArgs(sub.DockerContext, "push", target)...)
+			if output, err := combinedOutput(pushCmd, target, cfg); err != nil {
+				return fmt.Errorf("docker push 命令失败: %w, 输出: %s", err, output)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		cfg.session.relayed.add(target)
+
+		// 只保留在中继仓库中，删除本地的原标签和中继标签
+		if cfg.Relay.RemoveLocal {
+			for _, ref := range []string{target, image} {
+				rmCmd := command(ctx, cfg, cfg.DockerCmd, dockerArgs(sub.DockerContext, "image", "rm", ref)...)
+				if output, err := cfg.runner().CombinedOutput(rmCmd); err != nil {
+					return fmt.Errorf("删除本地镜像 %s 失败: %w, 输出: %s", ref, err, output)
+				}
+			}
+			slog.Info("已删除本地镜像", "image", image)
+		}
+	}
+
+	return nil
+}
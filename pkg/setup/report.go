@@ -0,0 +1,209 @@
+package setup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// 单个处理步骤的结果
+type reportStep struct {
+	SubDir   string            `json:"subDir"`
+	File     string            `json:"file"`
+	Op       string            `json:"op"`
+	Seconds  float64           `json:"seconds"`
+	Bytes    int64             `json:"bytes,omitempty"`
+	Images   []string          `json:"images,omitempty"`
+	ImageIDs map[string]string `json:"imageIds,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// 运行中加载或拉取的镜像
+type reportImage struct {
+	Name string `json:"name"`
+	ID   string `json:"id,omitempty"`
+	File string `json:"file"`
+}
+
+// 结果汇总中的运行信息，便于集中收集和比较多台设备的运行结果
+type reportRun struct {
+	RunID      string        `json:"runId,omitempty"`
+	Host       string        `json:"host,omitempty"`
+	Version    string        `json:"version"`
+	Commit     string        `json:"commit,omitempty"`
+	DryRun     bool          `json:"dryRun,omitempty"`
+	Status     string        `json:"status"`
+	ExitCode   int           `json:"exitCode"`
+	Error      string        `json:"error,omitempty"`
+	StartedAt  time.Time     `json:"startedAt"`
+	FinishedAt time.Time     `json:"finishedAt"`
+	Seconds    float64       `json:"seconds"`
+	Stages     []stageTiming `json:"stages,omitempty"`
+}
+
+// 运行的最终状态
+const (
+	runSucceeded   = "succeeded"
+	runFailed      = "failed"
+	runInterrupted = "interrupted"
+)
+
+// 根据运行结果生成结果汇总中的运行信息，started 为开始运行的时间
+func newReportRun(started time.Time, err error, cfg *Config) reportRun {
+	host, _ := os.Hostname()
+	finished := time.Now()
+
+	result := runSucceeded
+	if errors.Is(err, ErrInterrupted) {
+		result = runInterrupted
+	} else if err != nil {
+		result = runFailed
+	}
+
+	return reportRun{
+		RunID:      cfg.RunID,
+		Host:       host,
+		Version:    version,
+		Commit:     commit,
+		DryRun:     cfg.DryRun,
+		Status:     result,
+		ExitCode:   ExitCode(err),
+		Error:      errorString(err),
+		StartedAt:  started,
+		FinishedAt: finished,
+		Seconds:    finished.Sub(started).Seconds(),
+		Stages:     cfg.session.status.stageTimings(),
+	}
+}
+
+// 运行结果汇总，可并发使用
+// 输出的结果汇总中的密钥由 redactor 隐藏
+type runReport struct {
+	mu       sync.Mutex
+	steps    []reportStep
+	redactor *secretRedactor
+}
+
+// 记录一个处理步骤的结果
+// file 为压缩文件路径或拉取的镜像引用，size 为压缩文件的大小，images 为加载或拉取的镜像，ids 为镜像对应的镜像 ID
+func (r *runReport) record(subDirPath, file, op string, size int64, images []string, ids map[string]string, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.steps = append(r.steps, reportStep{
+		SubDir:   filepath.Base(subDirPath),
+		File:     file,
+		Op:       op,
+		Seconds:  d.Seconds(),
+		Bytes:    size,
+		Images:   images,
+		ImageIDs: ids,
+		Error:    errorString(err),
+	})
+}
+
+// 返回所有步骤及成功、失败的数量
+func (r *runReport) summary() (steps []reportStep, succeeded, failed int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	steps = append([]reportStep{}, r.steps...)
+	for _, step := range steps {
+		if step.Error == "" {
+			succeeded++
+		} else {
+			failed++
+		}
+	}
+
+	return steps, succeeded, failed
+}
+
+// 以表格形式输出结果汇总
+func (r *runReport) writeTable(w io.Writer) error {
+	steps, succeeded, failed := r.summary()
+	if len(steps) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "子目录\t文件\t操作\t耗时\t结果")
+	for _, step := range steps {
+		result := "成功"
+		if step.Error != "" {
+			// 错误中的换行会打乱表格
+			result = "失败: " + strings.Join(strings.Fields(step.Error), " ")
+		}
+		d := time.Duration(step.Seconds * float64(time.Second)).Round(time.Millisecond)
+		file := step.File
+		if step.Op != opPull {
+			file = filepath.Base(file)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", step.SubDir, file, step.Op, d, r.redactor.redact(result))
+	}
+	fmt.Fprintf(tw, "共 %d 项，成功 %d 项，失败 %d 项\n", len(steps), succeeded, failed)
+
+	return tw.Flush()
+}
+
+// 查询加载或拉取的镜像对应的镜像 ID，试运行或没有镜像时为空
+func reportImageIDs(ctx context.Context, images []string, sub subDirManifest, cfg *Config) map[string]string {
+	if len(images) == 0 || cfg.DryRun {
+		return nil
+	}
+	return imageIDs(ctx, images, sub, cfg)
+}
+
+// 输出单个输入目录的结果汇总，JSON 格式的结果汇总写入该目录中与 Report 同名的文件
+func writeRootReport(root string, started time.Time, err error, cfg *Config) {
+	cfg.session.report.writeTable(os.Stdout)
+	if cfg.Report == "" {
+		return
+	}
+
+	path := filepath.Join(root, filepath.Base(cfg.Report))
+	if reportErr := cfg.session.report.writeJSON(path, newReportRun(started, err, cfg)); reportErr != nil {
+		slog.Error("写入结果汇总失败", "file", path, "error", reportErr)
+	}
+}
+
+// 将运行信息和结果汇总以 JSON 格式写入文件，包括所有步骤、处理的总字节数和加载的镜像
+func (r *runReport) writeJSON(path string, run reportRun) error {
+	steps, succeeded, failed := r.summary()
+
+	var bytes int64
+	images := []reportImage{}
+	for _, step := range steps {
+		bytes += step.Bytes
+		for _, image := range step.Images {
+			images = append(images, reportImage{Name: image, ID: step.ImageIDs[image], File: step.File})
+		}
+	}
+
+	data, err := json.MarshalIndent(struct {
+		reportRun
+		Steps     []reportStep  `json:"steps"`
+		Succeeded int           `json:"succeeded"`
+		Failed    int           `json:"failed"`
+		Bytes     int64         `json:"bytes"`
+		Images    []reportImage `json:"images"`
+	}{run, steps, succeeded, failed, bytes, images}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, append(r.redactor.redactJSON(data), '\n'), 0o644); err != nil {
+		return fmt.Errorf("写入结果汇总失败: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+)
+
+// 暂时性错误的特征，例如 Docker 守护进程或 Minio 暂时不可用、网络中断和仓库限流
+var transientSignatures = []string{
+	"cannot connect to the docker daemon",
+	"is the docker daemon running",
+	"error during connect",
+	"connection refused",
+	"connection reset",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"temporary failure in name resolution",
+	"request canceled while waiting for connection",
+	"toomanyrequests",
+	"too many requests",
+	"service unavailable",
+	"bad gateway",
+	"gateway timeout",
+	"server not initialized",
+	"reduce your request rate",
+}
+
+// 命令失败的错误及其输出，错误信息中不包含输出，用于判断是否为暂时性错误
+type outputError struct {
+	err    error
+	output []byte
+}
+
+func (e *outputError) Error() string { return e.err.Error() }
+
+func (e *outputError) Unwrap() error { return e.err }
+
+// 错误是否为暂时性错误，只有暂时性错误需要重试
+// 文件不存在、没有权限、校验和不匹配、镜像文件损坏和上下文取消等错误重试也不会成功
+// 单个任务超时(PerTaskTimeout)视为暂时性错误，整体或阶段超时时 retry 已不再重试
+func transientError(err error) bool {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrPermission), errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	text := err.Error()
+	var outErr *outputError
+	if errors.As(err, &outErr) {
+		text += "\n" + string(outErr.output)
+	}
+	if classifyMcError([]byte(text)) == mcErrorRace {
+		return true
+	}
+	text = strings.ToLower(text)
+	for _, sig := range transientSignatures {
+		if strings.Contains(text, sig) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 执行 fn，暂时性错误时按指数退避重试，最多重试 MaxRetries 次，上下文结束后不再重试，见 transientError
+// 配置了 PerTaskTimeout 时每次执行使用单独的超时时间
+func retry(ctx context.Context, cfg *Config, name string, fn func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		err := runTask(ctx, cfg.PerTaskTimeout, name, fn)
+		if err == nil || attempt >= cfg.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+		if !transientError(err) {
+			slog.Debug("命令失败不是暂时性错误，不重试", "command", name, "error", err)
+			return err
+		}
+
+		if cfg.retryCount != nil {
+			cfg.retryCount.Add(1)
+		}
+		backoff := retryBackoff(attempt, cfg)
+		slog.Warn("命令执行失败，稍后重试", "command", name, "attempt", attempt+1, "backoff", backoff, "error", err)
+		if sleepErr := sleepContext(ctx, backoff); sleepErr != nil {
+			return fmt.Errorf("%w (等待重试时中断: %v)", err, sleepErr)
+		}
+	}
+}
+
+// 第 attempt 次重试前的等待时间：从 RetryBackoff 开始每次翻倍，不超过 RetryMaxBackoff
+// 文件在之前的运行中需要重试时，初始等待时间按之前的重试次数预先翻倍，最多 maxHistoryBackoffShift 次
+// 并按 RetryJitter 上下随机浮动，避免多个任务同时重试
+func retryBackoff(attempt int, cfg *Config) time.Duration {
+	backoff := cfg.RetryBackoff
+	for i := 0; i < attempt+min(cfg.retryHistory, maxHistoryBackoffShift) && (cfg.RetryMaxBackoff <= 0 || backoff < cfg.RetryMaxBackoff); i++ {
+		backoff *= 2
+	}
+	if cfg.RetryMaxBackoff > 0 && backoff > cfg.RetryMaxBackoff {
+		backoff = cfg.RetryMaxBackoff
+	}
+
+	if cfg.RetryJitter > 0 {
+		backoff += time.Duration((rand.Float64()*2 - 1) * cfg.RetryJitter * float64(backoff))
+	}
+
+	return backoff
+}
+
+// 在单独的超时时间内执行 fn，超时时在错误中注明任务名称
+func runTask(ctx context.Context, timeout time.Duration, name string, fn func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+
+	taskCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fn(taskCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(taskCtx.Err(), context.DeadlineExceeded) {
+		// 超时被终止的命令返回 signal: killed 等错误，需要同时包含 taskCtx.Err()，transientError 才能识别为超时
+		return fmt.Errorf("%s 超过单个任务超时时间 %s: %w", name, timeout, errors.Join(err, taskCtx.Err()))
+	}
+
+	return err
+}
+
+// 在阶段超时时间内执行 fn，超时时在错误中注明阶段名称
+func runStage(ctx context.Context, stage string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+
+	stageCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fn(stageCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(stageCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s 阶段超过超时时间 %s: %w", stage, timeout, errors.Join(err, stageCtx.Err()))
+	}
+
+	return err
+}
+
+// 整体超时时间：未配置 Timeout 时为各阶段超时时间之和，有阶段未配置超时时间时为 0，表示不限制
+func (cfg *Config) totalTimeout() time.Duration {
+	if cfg.Timeout > 0 {
+		return cfg.Timeout
+	}
+
+	t := cfg.StageTimeouts
+	if t.Extract <= 0 || t.Load <= 0 || t.Compose <= 0 || t.Minio <= 0 {
+		return 0
+	}
+	return t.Extract + t.Load + t.Compose + t.Minio
+}
@@ -0,0 +1,78 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRetryTransientErrors(t *testing.T) {
+	exitErr := &exec.ExitError{}
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{name: "Docker 守护进程不可用", err: fmt.Errorf("docker pull 命令失败: %w, 输出: Cannot connect to the Docker daemon at unix:///var/run/docker.sock", exitErr), wantCalls: 3},
+		{name: "mc 并发竞争", err: errors.New("minio mb 命令失败: exit status 1, 输出: another operation is in progress"), wantCalls: 3},
+		{name: "命令输出中的网络错误", err: &outputError{err: exitErr, output: []byte("read: connection reset by peer")}, wantCalls: 3},
+		{name: "文件不存在", err: fmt.Errorf("打开镜像文件失败: %w", os.ErrNotExist), wantCalls: 1},
+		{name: "校验和不匹配", err: errors.New("app.tar 校验和不匹配，期望 a，实际 b"), wantCalls: 1},
+		{name: "镜像文件损坏", err: &outputError{err: exitErr, output: []byte("archive/tar: invalid tar header")}, wantCalls: 1},
+		{name: "上下文取消", err: fmt.Errorf("docker load 命令失败: %w", context.Canceled), wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.MaxRetries = 2
+			cfg.RetryBackoff = time.Millisecond
+			cfg.RetryJitter = 0
+
+			calls := 0
+			err := retry(context.Background(), cfg, "test", func(ctx context.Context) error {
+				calls++
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("retry() error = %v, want %v", err, tt.err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("执行了 %d 次, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryPerTaskTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("没有 sleep 命令")
+	}
+
+	cfg := DefaultConfig()
+	cfg.MaxRetries = 1
+	cfg.RetryBackoff = time.Millisecond
+	cfg.RetryJitter = 0
+	cfg.PerTaskTimeout = 50 * time.Millisecond
+
+	// 超时被终止的命令返回 signal: killed，也应识别为单个任务超时并重试
+	calls := 0
+	start := time.Now()
+	err := retry(context.Background(), cfg, "sleep", func(ctx context.Context) error {
+		calls++
+		return exec.CommandContext(ctx, "sleep", "5").Run()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("retry() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if calls != 2 {
+		t.Errorf("执行了 %d 次, want 2", calls)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("超时后 %s 才返回", elapsed)
+	}
+}
@@ -0,0 +1,309 @@
+package setup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 记录运行中所做修改的文件，位于工作目录中
+const rollbackFileName = ".setup-rollback.json"
+
+// 回滚的最长时间，运行失败时上下文可能已取消，回滚使用独立的超时
+const rollbackTimeout = 5 * time.Minute
+
+// 运行中加载的镜像标签
+type rollbackImage struct {
+	Ref     string `json:"ref"`
+	Context string `json:"context,omitempty"`
+}
+
+// 运行中所做的修改：新建的文件和目录、加载前不存在的镜像标签以及是否启动了 Compose 服务
+// 新建文件和目录前、加载镜像后立即写入文件，失败后可通过 -rollback-on-failure 或 clean 子命令撤销，可并发使用
+type changeJournal struct {
+	mu   sync.Mutex
+	path string
+
+	Paths   []string        `json:"paths"`
+	Images  []rollbackImage `json:"images"`
+	Compose bool            `json:"compose"`
+}
+
+// 开始记录修改，之前失败的运行留下的记录会保留，返回停止记录的函数
+func (j *changeJournal) start(cwd string) (func(), error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	saved, err := readJournal(cwd)
+	if err != nil {
+		return nil, err
+	}
+	j.path = saved.path
+	j.Paths, j.Images, j.Compose = saved.Paths, saved.Images, saved.Compose
+
+	return func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.path = ""
+	}, nil
+}
+
+// 读取工作目录中的修改记录，文件不存在时返回空记录
+func readJournal(cwd string) (*changeJournal, error) {
+	j := &changeJournal{path: filepath.Join(cwd, rollbackFileName)}
+
+	data, err := os.ReadFile(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取修改记录失败: %w", err)
+	}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("解析修改记录 %s 失败: %w", j.path, err)
+	}
+
+	return j, nil
+}
+
+// 是否正在记录修改
+func (j *changeJournal) active() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.path != ""
+}
+
+// 写入修改记录文件，调用方需持有 j.mu
+func (j *changeJournal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(j.path, data, 0o644); err != nil {
+		return fmt.Errorf("写入修改记录失败: %w", err)
+	}
+	return nil
+}
+
+// 记录解压压缩文件将要新建的文件和目录，只记录解压前不存在的最上层路径
+func (j *changeJournal) recordExtract(ctx context.Context, tarPath, targetDir string, cfg *Config) error {
+	if !j.active() {
+		return nil
+	}
+
+	created, err := newExtractPaths(ctx, tarPath, targetDir, cfg)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, p := range created {
+		if !slices.Contains(j.Paths, p) {
+			j.Paths = append(j.Paths, p)
+		}
+	}
+	return j.save()
+}
+
+// 解压将要新建的最上层路径，解压目标目录不存在时为目录本身
+func newExtractPaths(ctx context.Context, tarPath, targetDir string, cfg *Config) ([]string, error) {
+	if _, err := os.Lstat(targetDir); errors.Is(err, os.ErrNotExist) {
+		return []string{targetDir}, nil
+	}
+
+	entries, err := listTarEntries(ctx, tarPath, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []string
+	for _, entry := range entries {
+		p := targetDir
+		for _, part := range strings.Split(filepath.Clean(entry), string(filepath.Separator)) {
+			if part == "." || part == "" {
+				continue
+			}
+			p = filepath.Join(p, part)
+			if _, err := os.Lstat(p); errors.Is(err, os.ErrNotExist) {
+				if !slices.Contains(created, p) {
+					created = append(created, p)
+				}
+				break
+			}
+		}
+	}
+
+	return created, nil
+}
+
+// 记录加载的镜像中加载前不存在的镜像标签，before 为加载前的本地镜像标签
+// 加载后才能从 docker load 的输出得知镜像标签，无需在加载前额外读取一遍镜像文件
+func (j *changeJournal) recordImages(images []string, before map[string]string, sub subDirManifest) error {
+	if !j.active() {
+		return nil
+	}
+
+	var created []rollbackImage
+	for _, image := range images {
+		if _, ok := before[image]; !ok && !strings.HasPrefix(image, "sha256:") {
+			created = append(created, rollbackImage{Ref: image, Context: sub.DockerContext})
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, image := range created {
+		if !slices.Contains(j.Images, image) {
+			j.Images = append(j.Images, image)
+		}
+	}
+	return j.save()
+}
+
+// 记录即将启动 Compose 服务
+func (j *changeJournal) recordCompose() error {
+	if !j.active() {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.Compose = true
+	return j.save()
+}
+
+// 运行成功后删除修改记录
+func (j *changeJournal) discard() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.path == "" {
+		return nil
+	}
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除修改记录失败: %w", err)
+	}
+	j.Paths, j.Images, j.Compose = nil, nil, false
+	return nil
+}
+
+// 按相反顺序撤销记录的修改：停止 Compose 服务、删除镜像标签、删除新建的文件和目录
+// 全部撤销成功后删除修改记录，否则保留未撤销的部分以便再次执行
+func rollback(ctx context.Context, cwd string, cfg *Config) error {
+	j, err := readJournal(cwd)
+	if err != nil {
+		return err
+	}
+	if !j.Compose && len(j.Images) == 0 && len(j.Paths) == 0 {
+		slog.Info("没有需要撤销的修改")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	slog.Info("正在撤销运行中所做的修改", "compose", j.Compose, "images", len(j.Images), "paths", len(j.Paths))
+	var errs []error
+
+	if j.Compose {
+		if err := rollbackCompose(ctx, cfg); err != nil {
+			errs = append(errs, err)
+		} else {
+			j.Compose = false
+		}
+	}
+
+	var images []rollbackImage
+	for _, image := range slices.Backward(j.Images) {
+		if err := removeImage(ctx, image.Ref, subDirManifest{DockerContext: image.Context}, cfg); err != nil {
+			errs = append(errs, fmt.Errorf("删除镜像 %s 失败: %w", image.Ref, err))
+			images = append(images, image)
+			continue
+		}
+		slog.Info("已删除镜像", "image", image.Ref)
+	}
+	slices.Reverse(images)
+	j.Images = images
+
+	var paths []string
+	for _, p := range slices.Backward(j.Paths) {
+		if !filepath.IsAbs(p) || filepath.Dir(p) == p {
+			errs = append(errs, fmt.Errorf("拒绝删除路径 %s", p))
+			continue
+		}
+		if err := os.RemoveAll(p); err != nil {
+			errs = append(errs, fmt.Errorf("删除 %s 失败: %w", p, err))
+			paths = append(paths, p)
+			continue
+		}
+		slog.Info("已删除", "path", p)
+	}
+	slices.Reverse(paths)
+	j.Paths = paths
+
+	if len(errs) > 0 {
+		if err := j.save(); err != nil {
+			errs = append(errs, err)
+		}
+		return fmt.Errorf("撤销修改失败: %w", errors.Join(errs...))
+	}
+
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除修改记录失败: %w", err)
+	}
+	// 解压出的文件已删除，之前的处理进度不再有效
+	state := &runState{path: filepath.Join(cwd, stateFileName)}
+	if err := state.remove(); err != nil {
+		return err
+	}
+	slog.Info("已撤销运行中所做的修改")
+	return nil
+}
+
+// 停止并删除 Compose 服务的容器
+func rollbackCompose(ctx context.Context, cfg *Config) error {
+	if cfg.ComposeCmd == "" || cfg.Runtime == runtimeAuto {
+		if err := resolveRuntime(cfg); err != nil {
+			return err
+		}
+		if err := detectComposeCmd(ctx, cfg); err != nil {
+			return err
+		}
+	}
+
+	if output, err := combinedOutput(composeCommand(ctx, cfg, "down"), "compose", cfg); err != nil {
+		return fmt.Errorf("%s down 命令失败: %w, 输出: %s", cfg.ComposeCmd, err, output)
+	}
+	slog.Info("已停止 Compose 服务")
+	return nil
+}
+
+// 删除镜像标签，标签已不存在时不报错
+func removeImage(ctx context.Context, ref string, sub subDirManifest, cfg *Config) error {
+	if imageID(ctx, ref, sub, cfg) == "" {
+		return nil
+	}
+	if cfg.UseDockerSDK {
+		return removeImageSDK(ctx, ref, sub)
+	}
+
+	cmd := command(ctx, cfg, cfg.DockerCmd, dockerArgs(sub.DockerContext, "image", "rm", ref)...)
+	if output, err := cfg.runner().CombinedOutput(cmd); err != nil {
+		return fmt.Errorf("%w, 输出: %s", err, output)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package setup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+)
+
+// 支持的容器运行时
+const (
+	runtimeAuto    = "auto"
+	runtimeDocker  = "docker"
+	runtimePodman  = "podman"
+	runtimeNerdctl = "nerdctl"
+)
+
+// 容器运行时：加载镜像、启动 Compose 服务和在容器中执行命令
+// 拉取、标签、推送和查询镜像等其他操作使用与 docker 兼容的命令行参数，命令为 DockerCmd
+type containerRuntime interface {
+	// 从标准输入加载镜像 tar 的命令
+	Load(ctx context.Context, sub subDirManifest, cfg *Config) *exec.Cmd
+	// 启动 Compose 服务的命令，args 为 composeUpArgs 构造的参数
+	ComposeUp(ctx context.Context, args []string, cfg *Config) *exec.Cmd
+	// 在容器中执行命令
+	Exec(ctx context.Context, container string, args []string, cfg *Config) *exec.Cmd
+}
+
+// 通过命令行调用的容器运行时，docker、podman 和 nerdctl 的镜像和容器命令相同
+type cliRuntime struct {
+	name string
+	// 运行时的 compose 子命令不可用时使用的独立 Compose 命令，为空时不支持
+	composeStandalone string
+	// 是否支持 Docker 上下文
+	contexts bool
+}
+
+var runtimes = map[string]cliRuntime{
+	runtimeDocker:  {name: runtimeDocker, composeStandalone: composeV1Cmd, contexts: true},
+	runtimePodman:  {name: runtimePodman, composeStandalone: "podman-compose"},
+	runtimeNerdctl: {name: runtimeNerdctl},
+}
+
+func (r cliRuntime) Load(ctx context.Context, sub subDirManifest, cfg *Config) *exec.Cmd {
+	return command(ctx, cfg, cfg.DockerCmd, dockerArgs(sub.DockerContext, "load")...)
+}
+
+func (r cliRuntime) ComposeUp(ctx context.Context, args []string, cfg *Config) *exec.Cmd {
+	return composeCommand(ctx, cfg, args...)
+}
+
+func (r cliRuntime) Exec(ctx context.Context, container string, args []string, cfg *Config) *exec.Cmd {
+	return command(ctx, cfg, cfg.DockerCmd, append([]string{"exec", container}, args...)...)
+}
+
+// 当前配置的容器运行时，未确定时为 docker
+func (cfg *Config) runtime() containerRuntime {
+	if r, ok := runtimes[cfg.Runtime]; ok {
+		return r
+	}
+	return runtimes[runtimeDocker]
+}
+
+// 确定容器运行时，auto 时依次查找 DockerCmd、podman 和 nerdctl 命令
+// 使用 podman 或 nerdctl 且 DockerCmd 为默认的 docker 时，DockerCmd 改为对应的命令
+func resolveRuntime(cfg *Config) error {
+	switch cfg.Runtime {
+	case runtimeDocker, runtimePodman, runtimeNerdctl:
+	case runtimeAuto, "":
+		cfg.Runtime = runtimeDocker
+		for _, name := range []string{cfg.DockerCmd, runtimePodman, runtimeNerdctl} {
+			if _, err := exec.LookPath(name); err == nil {
+				if name != cfg.DockerCmd {
+					cfg.Runtime = name
+				}
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("未知的容器运行时: %s", cfg.Runtime)
+	}
+
+	if cfg.Runtime != runtimeDocker && cfg.DockerCmd == runtimeDocker {
+		cfg.DockerCmd = cfg.Runtime
+	}
+
+	slog.Debug("容器运行时", "runtime", cfg.Runtime, "command", cfg.DockerCmd)
+	return nil
+}
@@ -0,0 +1,167 @@
+package setup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// 密钥来源，按 File、Env、Command 的顺序取第一个已设置的来源
+type SecretSource struct {
+	File    string `yaml:"file"`
+	Env     string `yaml:"env"`
+	Command string `yaml:"command"`
+}
+
+// 是否设置了任一来源
+func (s SecretSource) isSet() bool {
+	return s.File != "" || s.Env != "" || s.Command != ""
+}
+
+// 从来源读取密钥，去掉末尾的换行
+func (s SecretSource) resolve(ctx context.Context) (string, error) {
+	var value string
+
+	switch {
+	case s.File != "":
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return "", fmt.Errorf("读取密钥文件失败: %w", err)
+		}
+		value = string(data)
+	case s.Env != "":
+		v, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("环境变量 %s 未设置", s.Env)
+		}
+		value = v
+	case s.Command != "":
+		cmd := exec.CommandContext(ctx, "sh", "-c", s.Command)
+		output, err := cmd.Output()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return "", fmt.Errorf("执行密钥命令失败: %w, 输出: %s", err, exitErr.Stderr)
+			}
+			return "", fmt.Errorf("执行密钥命令失败: %w", err)
+		}
+		value = string(output)
+	}
+
+	value = strings.TrimRight(value, "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("密钥为空")
+	}
+
+	return value, nil
+}
+
+// 解析 Minio 凭据的外部来源，覆盖配置中的值
+func resolveMinioSecrets(ctx context.Context, cfg *Config) error {
+	sources := []struct {
+		name   string
+		source SecretSource
+		target *string
+	}{
+		{"MinioSecretKey", cfg.MinioSecretKeySource, &cfg.MinioSecretKey},
+		{"MinioUserPass", cfg.MinioUserPassSource, &cfg.MinioUserPass},
+	}
+
+	for _, s := range sources {
+		// 直接配置的密钥已在运行开始时由 registerSecrets 添加
+		if !s.source.isSet() {
+			continue
+		}
+
+		value, err := s.source.resolve(ctx)
+		if err != nil {
+			return fmt.Errorf("获取 %s 失败: %w", s.name, err)
+		}
+		cfg.session.redactor.add(value)
+		*s.target = value
+	}
+
+	return nil
+}
+
+// 配置中直接设置的所有密钥
+func (cfg *Config) secrets() []string {
+	secrets := []string{cfg.MinioSecretKey, cfg.MinioUserPass, cfg.StubS3.SecretKey, cfg.RegistryLogin.Password}
+	for _, key := range cfg.MinioAccessKeys {
+		secrets = append(secrets, key.SecretKey)
+	}
+	return secrets
+}
+
+// 在运行开始时添加配置中的所有密钥，之后的日志、命令输出、状态、事件和结果汇总中都会隐藏
+// 从外部来源获取的密钥在 resolveMinioSecrets 中添加
+func registerSecrets(cfg *Config) {
+	for _, secret := range cfg.secrets() {
+		cfg.session.redactor.add(secret)
+	}
+}
+
+// 密钥脱敏器，可并发使用
+type secretRedactor struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+// 添加需要隐藏的密钥，忽略空字符串
+func (r *secretRedactor) add(secret string) {
+	if secret == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.secrets = append(r.secrets, secret)
+}
+
+// 将字符串中的密钥替换为 ******
+func (r *secretRedactor) redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, "******")
+	}
+
+	return s
+}
+
+// 将 JSON 中的密钥替换为 ******，密钥中的引号、反斜杠和 HTML 字符在 JSON 中是转义后的形式
+func (r *secretRedactor) redactJSON(data []byte) []byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, secret := range r.secrets {
+		quoted, err := json.Marshal(secret)
+		if err != nil {
+			continue
+		}
+		data = bytes.ReplaceAll(data, quoted[1:len(quoted)-1], []byte("******"))
+	}
+
+	return data
+}
+
+// 日志处理器的属性替换函数，隐藏字符串和错误中的密钥
+func (r *secretRedactor) redactAttr(groups []string, a slog.Attr) slog.Attr {
+	switch v := a.Value.Any().(type) {
+	case string:
+		a.Value = slog.StringValue(r.redact(v))
+	case error:
+		a.Value = slog.StringValue(r.redact(v.Error()))
+	}
+
+	return a
+}
@@ -0,0 +1,79 @@
+package setup
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 包含 JSON 中需要转义的字符的密钥
+const testSecret = `s3cr<e>t&"pw`
+
+func TestRedactJSONOutputs(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RegistryLogin.Password = testSecret
+	cfg.session = newRunSession()
+	registerSecrets(cfg)
+
+	failure := errors.New("login failed: " + testSecret)
+
+	// 结果汇总
+	report := filepath.Join(t.TempDir(), "report.json")
+	cfg.session.report.record("00-base", "images.txt", opPull, 0, nil, nil, time.Second, failure)
+	if err := cfg.session.report.writeJSON(report, newReportRun(time.Now(), failure, cfg)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRedacted(t, "结果汇总", string(data))
+
+	// 状态服务
+	cfg.session.status.finish(failure)
+	rec := httptest.NewRecorder()
+	statusHandler(cfg.session).ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+	assertRedacted(t, "/status", rec.Body.String())
+
+	// 事件流
+	client, server := net.Pipe()
+	defer client.Close()
+	cfg.session.events.conn = server
+	go cfg.session.events.emit(event{Type: eventRunEnd, Error: failure.Error()})
+	line, err := bufio.NewReader(client).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRedacted(t, "事件", line)
+}
+
+func TestPrintUsageHidesSecrets(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinioUserPass = testSecret
+
+	var out strings.Builder
+	fs := flag.NewFlagSet("setup", flag.ContinueOnError)
+	fs.SetOutput(&out)
+	RegisterFlags(fs, cfg)
+	PrintUsage(fs)
+
+	assertRedacted(t, "帮助信息", out.String())
+	if got := fs.Lookup("minio-password").DefValue; got != testSecret {
+		t.Errorf("PrintUsage() 修改了默认值 %q", got)
+	}
+}
+
+func assertRedacted(t *testing.T, name, output string) {
+	t.Helper()
+
+	if strings.Contains(output, "s3cr") || !strings.Contains(output, "******") {
+		t.Errorf("%s中的密钥没有隐藏:\n%s", name, output)
+	}
+}
@@ -0,0 +1,99 @@
+package setup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 需要等待就绪的服务，健康检查地址返回 2xx 时视为就绪
+type ServiceWait struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+// 解析 name=url 格式的服务等待参数
+func parseServiceWait(s string) (ServiceWait, error) {
+	name, url, ok := strings.Cut(s, "=")
+	if !ok || name == "" || url == "" {
+		return ServiceWait{}, fmt.Errorf("服务等待参数格式应为 name=url")
+	}
+
+	return ServiceWait{Name: name, URL: url}, nil
+}
+
+// Minio 的就绪检查路径
+const minioHealthPath = "/minio/health/ready"
+
+// 轮询健康检查地址的间隔
+const serviceWaitInterval = time.Second
+
+// 单次健康检查请求的超时时间
+const serviceProbeTimeout = 5 * time.Second
+
+// 轮询服务的健康检查地址直到返回 2xx，最长等待 timeout
+func waitForService(ctx context.Context, name, url string, timeout time.Duration, cfg *Config) error {
+	if cfg.DryRun {
+		slog.Info("试运行，跳过等待服务就绪", "service", name, "url", url)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	slog.Info("正在等待服务就绪", "service", name, "url", url, "timeout", timeout)
+	client := &http.Client{Timeout: serviceProbeTimeout}
+	for attempt := 1; ; attempt++ {
+		err := probeService(ctx, client, url)
+		if err == nil {
+			slog.Info("服务已就绪", "service", name, "attempts", attempt)
+			return nil
+		}
+
+		slog.Debug("服务尚未就绪，稍后重试", "service", name, "attempt", attempt, "error", err)
+		if sleepErr := sleepContext(ctx, serviceWaitInterval); sleepErr != nil {
+			return fmt.Errorf("等待服务 %s 就绪超时: %w", name, err)
+		}
+	}
+}
+
+// 请求一次健康检查地址，返回 2xx 以外的状态码时报错
+func probeService(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("健康检查返回 %s", resp.Status)
+	}
+	return nil
+}
+
+// 依次等待配置的服务就绪，每个服务最长等待 ServiceWaitTimeout
+func waitForServices(ctx context.Context, cfg *Config) error {
+	for _, s := range cfg.WaitForServices {
+		if err := waitForService(ctx, s.Name, s.URL, cfg.ServiceWaitTimeout, cfg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Minio 的健康检查地址，未配置 MinioHealthURL 时使用 MinioEndpoint 的就绪检查路径
+func minioHealthURL(cfg *Config) string {
+	if cfg.MinioHealthURL != "" {
+		return cfg.MinioHealthURL
+	}
+	return strings.TrimRight(cfg.MinioEndpoint, "/") + minioHealthPath
+}
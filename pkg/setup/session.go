@@ -0,0 +1,41 @@
+package setup
+
+// 一次运行的状态、结果汇总、修改记录、事件流和密钥脱敏器，每次调用 Run 单独创建，互不影响
+// 同一次运行中复制的 Config 共用同一个 runSession
+type runSession struct {
+	status   *runStatus
+	report   *runReport
+	changes  *changeJournal
+	events   *eventStream
+	redactor *secretRedactor
+	progress *overallProgress
+	relayed  *relayList
+}
+
+// 新建一次运行的状态
+func newRunSession() *runSession {
+	redactor := &secretRedactor{}
+	return &runSession{
+		status:   &runStatus{Stage: stageIdle},
+		report:   &runReport{redactor: redactor},
+		changes:  &changeJournal{},
+		events:   &eventStream{redactor: redactor},
+		redactor: redactor,
+		progress: &overallProgress{},
+		relayed:  &relayList{},
+	}
+}
+
+// 处理多个输入目录时单个输入目录的状态，结果汇总、修改记录和进度每个目录单独记录
+// 运行状态、事件流、密钥脱敏器和中继镜像列表在整个运行中共用
+func (s *runSession) forRoot() *runSession {
+	return &runSession{
+		status:   s.status,
+		report:   &runReport{redactor: s.redactor},
+		changes:  &changeJournal{},
+		events:   s.events,
+		redactor: s.redactor,
+		progress: &overallProgress{},
+		relayed:  s.relayed,
+	}
+}
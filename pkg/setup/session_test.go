@@ -0,0 +1,85 @@
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRunSeparateSessions(t *testing.T) {
+	cfg := testConfig(t, &fakeRunner{})
+	cfg.session = nil
+	cfg.Plan = true
+
+	// 并发调用 Run 时各自记录运行状态，配合 -race 检查是否共用状态
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Run(context.Background(), cfg)
+		}()
+	}
+	wg.Wait()
+
+	if cfg.session != nil {
+		t.Errorf("Run() 修改了传入的配置")
+	}
+}
+
+func TestRunInputsSeparateReports(t *testing.T) {
+	cfg := testConfig(t, &fakeRunner{respond: loadedImages("app:1")})
+	cfg.Preflight = false
+	cfg.StartCompose = false
+
+	// ok 中的镜像加载成功，bad 中的主Stub文件包含不安全的路径
+	stubs := map[string][]testEntry{
+		"ok": {
+			{Name: "10-app/", Typeflag: tar.TypeDir},
+			{Name: "10-app/app.tar", Typeflag: tar.TypeReg, Body: "image"},
+		},
+		"bad": {{Name: "../escape.txt", Typeflag: tar.TypeReg, Body: "x"}},
+	}
+	base := cfg.WorkDir
+	for name, entries := range stubs {
+		cfg.WorkDir = filepath.Join(base, name)
+		if err := os.Mkdir(cfg.WorkDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writeTestStub(t, cfg, entries)
+		cfg.Inputs = append(cfg.Inputs, cfg.WorkDir)
+	}
+
+	err := runAll(context.Background(), cfg)
+	if got := ExitCode(err); got != exitExtract {
+		t.Errorf("ExitCode() = %d, want %d, error = %v", got, exitExtract, err)
+	}
+
+	want := map[string]struct {
+		status string
+		steps  int
+	}{
+		"ok":  {status: runSucceeded, steps: 1},
+		"bad": {status: runFailed, steps: 0},
+	}
+	for name, w := range want {
+		data, err := os.ReadFile(filepath.Join(base, name, cfg.Report))
+		if err != nil {
+			t.Fatalf("读取 %s 的结果汇总失败: %v", name, err)
+		}
+		var report struct {
+			Status string       `json:"status"`
+			Steps  []reportStep `json:"steps"`
+		}
+		if err := json.Unmarshal(data, &report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Status != w.status || len(report.Steps) != w.steps {
+			t.Errorf("%s 的结果汇总状态为 %s，%d 个步骤, want %s，%d 个步骤", name, report.Status, len(report.Steps), w.status, w.steps)
+		}
+	}
+}
@@ -0,0 +1,1427 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 配置结构体
+type Config struct {
+	StubTarName          string        `yaml:"stubTarName"`
+	StubS3               S3Config      `yaml:"stubS3"`
+	StubDirName          string        `yaml:"stubDirName"`
+	ManifestName         string        `yaml:"manifestName"`
+	DockerCmd            string        `yaml:"dockerCmd"`
+	TarCmd               string        `yaml:"tarCmd"`
+	MinDockerVersion     string        `yaml:"minDockerVersion"`
+	Runtime              string        `yaml:"runtime"`
+	MinTarVersion        string        `yaml:"minTarVersion"`
+	MinioAccessKey       string        `yaml:"minioAccessKey"`
+	MinioSecretKey       string        `yaml:"minioSecretKey"`
+	MinioContainer       string        `yaml:"minioContainer"`
+	MinioUser            string        `yaml:"minioUser"`
+	MinioUserPass        string        `yaml:"minioUserPass"`
+	MinioDesc            string        `yaml:"minioDesc"`
+	MinioAccessKeys      []MinioKey    `yaml:"minioAccessKeys"`
+	MinioAlias           string        `yaml:"minioAlias"`
+	MinioEndpoint        string        `yaml:"minioEndpoint"`
+	MinioBuckets         []MinioBucket `yaml:"minioBuckets"`
+	MaxRetries           int           `yaml:"maxRetries"`
+	RetryBackoff         time.Duration `yaml:"retryBackoff"`
+	RetryMaxBackoff      time.Duration `yaml:"retryMaxBackoff"`
+	RetryJitter          float64       `yaml:"retryJitter"`
+	MinioRaceRetries     int           `yaml:"minioRaceRetries"`
+	MinioRaceBackoff     time.Duration `yaml:"minioRaceBackoff"`
+	MinioSecretKeySource SecretSource  `yaml:"minioSecretKeySource"`
+	MinioUserPassSource  SecretSource  `yaml:"minioUserPassSource"`
+	MinioSettleDelay     time.Duration `yaml:"minioSettleDelay"`
+	MinioReadyTimeout    time.Duration `yaml:"minioReadyTimeout"`
+	MinioHealthURL       string        `yaml:"minioHealthURL"`
+	MinioSeedOverwrite   bool          `yaml:"minioSeedOverwrite"`
+	MinioSDK             bool          `yaml:"minioSDK"`
+	LogFormat            string        `yaml:"logFormat"`
+	LogLevel             string        `yaml:"logLevel"`
+	LogFile              string        `yaml:"logFile"`
+	RunID                string        `yaml:"runID"`
+	Timeout              time.Duration `yaml:"timeout"`
+	PerTaskTimeout       time.Duration `yaml:"perTaskTimeout"`
+	StageTimeouts        StageTimeouts `yaml:"stageTimeouts"`
+	ConcurrentTasks      int           `yaml:"concurrentTasks"`
+	EmitDot              string        `yaml:"emitDot"`
+	MtimeMode            string        `yaml:"mtimeMode"`
+	NativeExtract        bool          `yaml:"nativeExtract"`
+	StatusAddr           string        `yaml:"statusAddr"`
+	ArchCheck            string        `yaml:"archCheck"`
+	ComposeOnly          bool          `yaml:"composeOnly"`
+	AllowedExtractRoots  []string      `yaml:"allowedExtractRoots"`
+	CleanupCorruptLoads  bool          `yaml:"cleanupCorruptLoads"`
+	Cleanup              bool          `yaml:"cleanup"`
+	TrackChanges         bool          `yaml:"trackChanges"`
+	RollbackOnFailure    bool          `yaml:"rollbackOnFailure"`
+	CleanupArchives      bool          `yaml:"cleanupArchives"`
+	CleanupSubDirs       bool          `yaml:"cleanupSubDirs"`
+	Relay                RelayConfig   `yaml:"relay"`
+	RegistryLogin        RegistryLogin `yaml:"registryLogin"`
+	RuntimeUID           int           `yaml:"runtimeUID"`
+	RuntimeGID           int           `yaml:"runtimeGID"`
+	AllowedImageRepos    []string      `yaml:"allowedImageRepos"`
+	Inputs               []string      `yaml:"inputs"`
+	EventSocket          string        `yaml:"eventSocket"`
+	RaiseFileLimit       bool          `yaml:"raiseFileLimit"`
+	ComposePullPolicy    string        `yaml:"composePullPolicy"`
+	StartCompose         bool          `yaml:"startCompose"`
+	ComposeHealthTimeout time.Duration `yaml:"composeHealthTimeout"`
+	ComposeLogLines      int           `yaml:"composeLogLines"`
+	WaitForServices      []ServiceWait `yaml:"waitForServices"`
+	ServiceWaitTimeout   time.Duration `yaml:"serviceWaitTimeout"`
+	ComposeFile          string        `yaml:"composeFile"`
+	ComposeCmd           string        `yaml:"composeCmd"`
+	CommandPrefix        []string      `yaml:"commandPrefix"`
+	StrictPlatform       bool          `yaml:"strictPlatform"`
+	TagClobber           string        `yaml:"tagClobber"`
+	SkipExistingImages   bool          `yaml:"skipExistingImages"`
+	UseDockerSDK         bool          `yaml:"useDockerSDK"`
+	VerifyChecksums      bool          `yaml:"verifyChecksums"`
+	MinFreeBytes         int64         `yaml:"minFreeBytes"`
+	SkipDiskCheck        bool          `yaml:"skipDiskCheck"`
+	Preflight            bool          `yaml:"preflight"`
+	PreflightPorts       []int         `yaml:"preflightPorts"`
+	Plan                 bool          `yaml:"plan"`
+	DryRun               bool          `yaml:"dryRun"`
+	StagePhases          bool          `yaml:"stagePhases"`
+	FilesOnly            bool          `yaml:"filesOnly"`
+	Fingerprint          bool          `yaml:"fingerprint"`
+	FingerprintFile      string        `yaml:"fingerprintFile"`
+	Report               string        `yaml:"report"`
+	Force                bool          `yaml:"force"`
+	Restart              bool          `yaml:"restart"`
+	Arch                 string        `yaml:"arch"`
+	ArchSuffix           string        `yaml:"archSuffix"`
+	MaxDepth             int           `yaml:"maxDepth"`
+	Progress             string        `yaml:"progress"`
+	ProgressInterval     time.Duration `yaml:"progressInterval"`
+	StreamOutput         bool          `yaml:"streamOutput"`
+	Resume               bool          `yaml:"resume"`
+	PreHook              string        `yaml:"preHook"`
+	PostHook             string        `yaml:"postHook"`
+	WorkDir              string        `yaml:"-" toml:"-"`
+	Runner               CommandRunner `yaml:"-" toml:"-"`
+
+	session *runSession
+
+	// 处理单个文件时该文件在之前的运行中的重试次数，以及统计本次重试次数的计数器，见 runState.fileConfig
+	retryHistory int
+	retryCount   *atomic.Int32
+}
+
+// 默认配置
+func DefaultConfig() *Config {
+	return &Config{
+		StubTarName:          "stub.tar",
+		StubS3:               S3Config{Endpoint: "s3.amazonaws.com"},
+		MinDockerVersion:     "20.10.0",
+		StubDirName:          "stub",
+		ManifestName:         "manifest.json",
+		DockerCmd:            "docker",
+		Runtime:              runtimeAuto,
+		TarCmd:               "tar",
+		NativeExtract:        true,
+		MinioAccessKey:       "yoo-oss-access-key",
+		MinioSecretKey:       "yoo-oss-secret-key",
+		MinioContainer:       "yoo-oss",
+		MinioUser:            "minioadmin",
+		MinioUserPass:        "minioadmin",
+		MinioDesc:            "proxy",
+		MinioAlias:           "myminio",
+		MinioEndpoint:        "http://localhost:9000",
+		MaxRetries:           3,
+		RetryBackoff:         2 * time.Second,
+		RetryMaxBackoff:      time.Minute,
+		RetryJitter:          0.2,
+		MinioRaceRetries:     5,
+		MinioRaceBackoff:     time.Second,
+		MinioReadyTimeout:    time.Minute,
+		ServiceWaitTimeout:   2 * time.Minute,
+		ComposeHealthTimeout: 3 * time.Minute,
+		ComposeLogLines:      20,
+		LogFormat:            logFormatText,
+		LogLevel:             "info",
+		StageTimeouts: StageTimeouts{
+			Extract: 30 * time.Minute,
+			Load:    2 * time.Hour,
+			Compose: 15 * time.Minute,
+			Minio:   10 * time.Minute,
+		},
+		ConcurrentTasks:   4,
+		MaxDepth:          1,
+		ArchSuffix:        "-{arch}",
+		MtimeMode:         mtimePreserve,
+		ArchCheck:         archCheckOff,
+		RuntimeUID:        -1,
+		RuntimeGID:        -1,
+		RaiseFileLimit:    true,
+		Resume:            true,
+		Progress:          progressAuto,
+		ProgressInterval:  10 * time.Second,
+		ComposePullPolicy: pullNever,
+		StartCompose:      true,
+		TagClobber:        clobberProceed,
+		TrackChanges:      true,
+		Report:            "setup-report.json",
+		Preflight:         true,
+	}
+}
+
+// 各阶段的超时时间，0 表示只受整体超时限制
+type StageTimeouts struct {
+	Extract time.Duration `yaml:"extract"`
+	Load    time.Duration `yaml:"load"`
+	Compose time.Duration `yaml:"compose"`
+	Minio   time.Duration `yaml:"minio"`
+}
+
+// 命令行入口：处理已加载配置文件并解析命令行参数后的配置，args 为剩余的命令行参数，返回退出码
+func Main(cfg *Config, args []string) int {
+	// 本次运行的状态，状态服务、事件套接字和结果汇总都使用它
+	cfg.session = newRunSession()
+
+	// 子命令及其后的参数
+	name, args := splitSubcommand(args)
+	args = parseSubcommandFlags(name, args, cfg)
+
+	// 所有配置来源合并后展开环境变量
+	if err := expandConfigEnv(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	registerSecrets(cfg)
+
+	// 设置上下文，添加整体超时控制，见 totalTimeout
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if timeout := cfg.totalTimeout(); timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		defer cancelTimeout()
+	}
+
+	// 收到 SIGINT 或 SIGTERM 时取消上下文
+	ctx, stop := notifyInterrupt(ctx)
+	defer stop()
+
+	// 初始化日志，未指定运行 ID 时随机生成
+	if cfg.RunID == "" {
+		cfg.RunID = newRunID()
+	}
+	logWriter, closeLog, err := logOutput(os.Stdout, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	defer closeLog()
+	handler, err := newLogHandler(logWriter, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	slog.SetDefault(slog.New(handler))
+
+	// 子命令
+	switch name {
+	case cmdDiff:
+		if err := runDiff(args); err != nil {
+			slog.Error("程序执行失败", "error", err)
+			return exitFailure
+		}
+		return exitOK
+	case cmdLoadImage:
+		if err := runLoadImage(ctx, args, cfg); err != nil {
+			slog.Error("程序执行失败", "error", err)
+			return ExitCode(err)
+		}
+		return exitOK
+	case cmdPack:
+		if err := runPack(ctx, args, cfg); err != nil {
+			slog.Error("程序执行失败", "error", err)
+			return exitFailure
+		}
+		return exitOK
+	case cmdStatus:
+		if err := showStatus(cfg); err != nil {
+			slog.Error("程序执行失败", "error", err)
+			return exitFailure
+		}
+		return exitOK
+	}
+
+	// 命令行中指定的主Stub文件
+	if err := applyStubArg(args, cfg); err != nil {
+		slog.Error("程序执行失败", "error", err)
+		return exitFailure
+	}
+
+	switch name {
+	case cmdVerify:
+		if err := runVerify(ctx, cfg); err != nil {
+			slog.Error("程序执行失败", "error", err)
+			return ExitCode(err)
+		}
+		return exitOK
+	case cmdClean:
+		if err := runClean(ctx, cfg); err != nil {
+			slog.Error("程序执行失败", "error", err)
+			return ExitCode(err)
+		}
+		return exitOK
+	}
+
+	// 确定并发任务数，并检查文件描述符限制，必要时降低并发任务数
+	resolveConcurrency(cfg)
+	adjustFileLimit(cfg)
+
+	// 启动状态服务
+	var srv *http.Server
+	if cfg.StatusAddr != "" {
+		var err error
+		if srv, err = startStatusServer(cfg.StatusAddr, cfg.session); err != nil {
+			slog.Error("程序执行失败", "error", err)
+			return exitFailure
+		}
+	}
+
+	// 连接事件套接字
+	if cfg.EventSocket != "" {
+		cfg.session.events.connect(cfg.EventSocket)
+		defer cfg.session.events.close()
+	}
+
+	started := time.Now()
+	err = interruptError(ctx, runAll(ctx, cfg))
+
+	if srv != nil {
+		stopStatusServer(srv)
+	}
+
+	// 输出结果汇总，部分失败时同样列出已完成的步骤，指定输入目录时已分别输出
+	if len(cfg.Inputs) == 0 {
+		cfg.session.report.writeTable(os.Stdout)
+		if cfg.Report != "" {
+			if reportErr := cfg.session.report.writeJSON(cfg.Report, newReportRun(started, err, cfg)); reportErr != nil {
+				slog.Error("写入结果汇总失败", "file", cfg.Report, "error", reportErr)
+			}
+		}
+	}
+
+	// 按失败原因返回不同的退出码，见 ExitCode
+	if err != nil {
+		slog.Error("程序执行失败", "error", err)
+		return ExitCode(err)
+	}
+
+	slog.Info("初始化完成")
+	return exitOK
+}
+
+// 按配置处理工作目录或所有输入目录，供其他程序直接调用
+// 日志写入 slog 的默认 Logger，失败原因可通过 ExitCode 分类
+// 每次调用使用单独的运行状态，并发调用时互不影响，不修改 cfg
+func Run(ctx context.Context, cfg *Config) error {
+	runCfg := *cfg
+	runCfg.session = newRunSession()
+	registerSecrets(&runCfg)
+	return runAll(ctx, &runCfg)
+}
+
+// 使用 cfg 中的运行状态处理工作目录或所有输入目录
+func runAll(ctx context.Context, cfg *Config) error {
+	resolveConcurrency(cfg)
+	return runInputs(ctx, cfg)
+}
+
+// 使用命令行中指定的主Stub文件，解压和处理都在该文件所在目录中进行
+// 相对路径基于当前目录解析，未指定时使用工作目录中的 StubTarName
+func applyStubArg(args []string, cfg *Config) error {
+	switch {
+	case len(args) == 0:
+		return nil
+	case len(args) > 1:
+		return fmt.Errorf("只能指定一个 STUB 文件，实际指定了 %d 个: %s", len(args), strings.Join(args, " "))
+	case len(cfg.Inputs) > 0:
+		return fmt.Errorf("不能同时指定 -input 和 STUB 文件 %s", args[0])
+	case isRemoteStub(args[0]):
+		// 远程文件在运行时下载到工作目录
+		cfg.StubTarName = args[0]
+		return nil
+	}
+
+	stubTar, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("解析 STUB 文件路径失败: %w", err)
+	}
+
+	info, err := os.Stat(stubTar)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("STUB 文件 %s 不存在", args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("读取 STUB 文件 %s 失败: %w", args[0], err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s 是目录，请指定 STUB 文件", args[0])
+	}
+
+	cfg.WorkDir = filepath.Dir(stubTar)
+	cfg.StubTarName = filepath.Base(stubTar)
+	return nil
+}
+
+// 展开输入目录中的通配符
+func expandInputs(patterns []string) ([]string, error) {
+	var roots []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("输入目录 %s 格式错误: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("输入目录 %s 不存在", pattern)
+		}
+
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.IsDir() {
+				roots = append(roots, match)
+			}
+		}
+	}
+
+	return roots, nil
+}
+
+// 依次处理每个输入目录，各目录互不影响，最后汇总所有错误
+func runInputs(ctx context.Context, cfg *Config) error {
+	roots, err := expandInputs(cfg.Inputs)
+	if err != nil {
+		return err
+	}
+
+	// 未指定输入目录时处理工作目录，默认为当前目录
+	if len(cfg.Inputs) == 0 {
+		roots = []string{cfg.WorkDir}
+	}
+
+	var errs []error
+	for _, root := range roots {
+		rootCfg := *cfg
+		rootCfg.WorkDir = root
+		started := time.Now()
+		if len(cfg.Inputs) > 0 {
+			slog.Info("正在处理输入目录", "root", root)
+			rootCfg.session = cfg.session.forRoot()
+		}
+
+		cfg.session.status.start()
+		err := run(ctx, &rootCfg)
+		finishRun(err, cfg)
+		logStageSummary(cfg.session.status)
+
+		// 每个输入目录的结果汇总写入该目录，未指定输入目录时由调用方输出
+		if len(cfg.Inputs) > 0 {
+			writeRootReport(root, started, err, &rootCfg)
+		}
+
+		if err != nil {
+			if root == "" {
+				return err
+			}
+			errs = append(errs, fmt.Errorf("处理输入目录 %s 失败: %w", root, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// 主要运行逻辑
+func run(ctx context.Context, cfg *Config) (err error) {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	// 获取工作目录，未指定时使用当前目录
+	cwd, err := filepath.Abs(cfg.WorkDir)
+	if err != nil {
+		return fmt.Errorf("获取当前工作目录失败: %w", err)
+	}
+
+	slog.Info("版本信息", "version", version, "commit", commit, "buildDate", buildDate)
+
+	// 防止同一目录中同时运行多个 setup，只读的运行方式不加锁
+	if !cfg.DryRun && !cfg.Plan && cfg.EmitDot == "" {
+		unlock, lockErr := acquireLock(cwd, cfg.Force)
+		if lockErr != nil {
+			return lockErr
+		}
+		defer unlock()
+
+		// 记录运行中所做的修改，失败时按配置撤销
+		if cfg.TrackChanges {
+			stop, startErr := cfg.session.changes.start(cwd)
+			if startErr != nil {
+				return startErr
+			}
+			defer stop()
+			defer func() {
+				if err == nil || !cfg.RollbackOnFailure {
+					return
+				}
+				if rbErr := rollback(ctx, cwd, cfg); rbErr != nil {
+					slog.Error("撤销修改失败，可稍后执行 clean 子命令重试", "error", rbErr)
+				}
+			}()
+		}
+	}
+
+	enterStage(stageDependencies, cfg)
+
+	// 主Stub文件为 HTTP(S) 或 S3 地址时先下载到工作目录，处理完成后删除
+	stubTar := filepath.Join(cwd, cfg.StubTarName)
+	if isRemoteStub(cfg.StubTarName) {
+		if stubTar, err = downloadStub(ctx, cfg.StubTarName, cwd, cfg); err != nil {
+			return err
+		}
+		defer removeDownload(stubTar)
+	}
+
+	// 只读的运行方式只检查依赖命令，其余在开始修改前预检磁盘空间、Docker 守护进程、端口和架构
+	if cfg.EmitDot != "" || cfg.Plan || cfg.ComposeOnly || !cfg.Preflight {
+		err = checkDependencies(ctx, cfg)
+	} else {
+		err = preflight(ctx, stubTar, cwd, cfg)
+	}
+	if err != nil {
+		return withCategory(ErrDependencyMissing, err)
+	}
+
+	// 仅输出处理计划，不执行任何操作
+	if cfg.EmitDot != "" {
+		return emitPlanDot(ctx, stubTar, cfg)
+	}
+
+	// 只读检查主机状态，不执行任何操作
+	if cfg.Plan {
+		return remotePlan(ctx, stubTar, cwd, cfg)
+	}
+
+	enterStage(stageExtract, cfg)
+
+	// 仅解压 Compose 文件用于预览
+	if cfg.ComposeOnly {
+		return extractComposeFiles(ctx, stubTar, cfg)
+	}
+
+	// 解压前运行前置钩子
+	if cfg.PreHook != "" {
+		if err := runHook(ctx, "preHook", cfg.PreHook, cfg); err != nil {
+			return err
+		}
+	}
+
+	// 检查并解压主Stub文件
+	err = runStage(ctx, stageExtract, cfg.StageTimeouts.Extract, func(ctx context.Context) error {
+		return checkAndExtractMainStub(ctx, stubTar, cfg)
+	})
+	if err != nil {
+		return withCategory(ErrExtractFailed, err)
+	}
+
+	// 读取清单文件并检查其中声明的目标平台、Docker 上下文和解压目标
+	m, err := loadManifest(filepath.Join(cwd, cfg.ManifestName))
+	if err != nil {
+		return err
+	}
+	if err := checkPlatform(m, cfg); err != nil {
+		return err
+	}
+	if !cfg.FilesOnly {
+		if err := checkDockerContexts(ctx, m, cfg); err != nil {
+			return err
+		}
+	}
+	if err := checkExtractTargets(m, cfg); err != nil {
+		return err
+	}
+
+	// 试运行时子目录未解压，根据主Stub文件的条目打印将要执行的命令
+	if cfg.DryRun {
+		enterStage(stageProcess, cfg)
+		if err := dryRunStubDir(ctx, stubTar, cwd, m, cfg); err != nil {
+			return err
+		}
+		if err := startServices(ctx, stubTar, cfg); err != nil {
+			return err
+		}
+		if cfg.PostHook != "" {
+			if err := runHook(ctx, "postHook", cfg.PostHook, cfg); err != nil {
+				return err
+			}
+		}
+
+		slog.Info("试运行完成，未做任何修改")
+		return nil
+	}
+
+	// 计算部署指纹
+	if cfg.Fingerprint || cfg.FingerprintFile != "" {
+		if err := recordFingerprint(cwd, cfg); err != nil {
+			return err
+		}
+	}
+
+	// 子目录可能需要从仓库拉取镜像，先登录仓库
+	if cfg.RegistryLogin.Server != "" && !cfg.FilesOnly {
+		if err := dockerLogin(ctx, cfg); err != nil {
+			return err
+		}
+	}
+
+	// 断点续跑时读取之前的处理进度
+	var state *runState
+	if cfg.Resume {
+		if state, err = loadRunState(cwd, stubTar, cfg.Restart); err != nil {
+			return err
+		}
+	}
+
+	// 处理子目录中的镜像和压缩文件，分阶段时先解压全部文件再加载镜像
+	enterStage(stageProcess, cfg)
+	phases := []string{""}
+	if cfg.StagePhases {
+		phases = []string{opExtract, opLoad}
+	}
+	err = runStage(ctx, "load", cfg.StageTimeouts.Load, func(ctx context.Context) error {
+		for _, phase := range phases {
+			if phase != "" {
+				slog.Info("开始处理阶段", "phase", phase)
+			}
+			if err := processStubDir(ctx, cwd, m, phase, state, cfg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 所有镜像推送完成后写入中继镜像列表
+	if cfg.Relay.Enabled && cfg.Relay.ListFile != "" {
+		if err := cfg.session.relayed.write(cfg.Relay.ListFile); err != nil {
+			return err
+		}
+	}
+
+	if err := startServices(ctx, stubTar, cfg); err != nil {
+		return err
+	}
+
+	// 运行成功后清理解压出的压缩文件，失败时保留现场便于排查
+	if cfg.Cleanup {
+		if err := cleanupStub(ctx, stubTar, cwd, cfg); err != nil {
+			return err
+		}
+	}
+
+	// 所有步骤成功后运行后置钩子，例如冒烟测试
+	if cfg.PostHook != "" {
+		if err := runHook(ctx, "postHook", cfg.PostHook, cfg); err != nil {
+			return err
+		}
+	}
+
+	// 全部成功后不再需要断点续跑的进度和修改记录，文件的重试记录保留给之后的运行
+	if err := cfg.session.changes.discard(); err != nil {
+		return err
+	}
+	return state.finish()
+}
+
+// 是否启动 Compose 服务：仅准备文件和中继模式下不启动，中继模式指定 Services 时除外
+func (cfg *Config) composeEnabled() bool {
+	return cfg.StartCompose && !cfg.FilesOnly && (!cfg.Relay.Enabled || cfg.Relay.Services)
+}
+
+// 启动服务并完成配置，Minio 容器由 Compose 启动，不启动 Compose 时同样跳过 Minio 配置
+// stubTar 为主Stub文件，试运行时用于列出 Minio 初始数据
+func startServices(ctx context.Context, stubTar string, cfg *Config) error {
+	// 启动Docker Compose，仅准备文件时跳过
+	if !cfg.composeEnabled() {
+		return nil
+	}
+
+	enterStage(stageCompose, cfg)
+	err := runStage(ctx, stageCompose, cfg.StageTimeouts.Compose, func(ctx context.Context) error {
+		if err := startDockerCompose(ctx, cfg); err != nil {
+			return err
+		}
+		return waitForServices(ctx, cfg)
+	})
+	if err != nil {
+		return withCategory(ErrComposeFailed, err)
+	}
+
+	// 配置Minio
+	enterStage(stageMinio, cfg)
+	err = runStage(ctx, stageMinio, cfg.StageTimeouts.Minio, func(ctx context.Context) error {
+		return configureMinio(ctx, stubTar, cfg)
+	})
+	if err != nil {
+		return withCategory(ErrMinioConfig, err)
+	}
+
+	return nil
+}
+
+// 是否需要 docker 命令：UseDockerSDK 时镜像通过 Docker SDK 加载和查询，只有启动 Compose、登录、拉取或推送镜像时需要
+func needDockerCLI(cfg *Config) bool {
+	if cfg.FilesOnly {
+		return false
+	}
+	if !cfg.UseDockerSDK {
+		return true
+	}
+
+	return cfg.StartCompose || cfg.RegistryLogin.Server != "" || cfg.Relay.Registry != ""
+}
+
+// 检查必要的依赖命令
+func checkDependencies(ctx context.Context, cfg *Config) error {
+	if err := resolveRuntime(cfg); err != nil {
+		return err
+	}
+
+	var dependencies []string
+	if !cfg.NativeExtract {
+		dependencies = append(dependencies, cfg.TarCmd)
+	}
+	if needDockerCLI(cfg) {
+		dependencies = append(dependencies, cfg.DockerCmd)
+	}
+
+	for _, dep := range dependencies {
+		if _, err := exec.LookPath(dep); err != nil {
+			return fmt.Errorf("%s 命令不存在: %w", dep, err)
+		}
+	}
+
+	// 检查命令版本
+	if !cfg.NativeExtract {
+		if err := checkVersion(ctx, cfg.TarCmd, cfg.MinTarVersion, cfg); err != nil {
+			return err
+		}
+	}
+	if needDockerCLI(cfg) {
+		if err := checkVersion(ctx, cfg.DockerCmd, cfg.MinDockerVersion, cfg); err != nil {
+			return err
+		}
+	}
+	if cfg.UseDockerSDK && !cfg.FilesOnly {
+		if err := checkDockerDaemon(ctx, cfg); err != nil {
+			return err
+		}
+	}
+
+	// 需要启动 Compose 时确认可用的 Compose 命令
+	if cfg.composeEnabled() {
+		if err := detectComposeCmd(ctx, cfg); err != nil {
+			return err
+		}
+	}
+
+	return checkCommandPrefix(cfg)
+}
+
+// 检查并解压主Stub文件
+func checkAndExtractMainStub(ctx context.Context, stubTar string, cfg *Config) error {
+	// 检查文件是否存在
+	if _, err := os.Stat(stubTar); os.IsNotExist(err) {
+		return fmt.Errorf("STUB 文件不存在: %w", err)
+	}
+
+	// 校验文件并检查剩余磁盘空间后解压
+	if err := verifyArchive(stubTar, cfg); err != nil {
+		return err
+	}
+	if err := verifyStubChecksums(ctx, stubTar, cfg); err != nil {
+		return err
+	}
+	if err := checkDiskSpace(stubTar, filepath.Dir(stubTar), cfg); err != nil {
+		return err
+	}
+	if err := cfg.session.changes.recordExtract(ctx, stubTar, filepath.Dir(stubTar), cfg); err != nil {
+		return err
+	}
+	if err := extractTar(ctx, stubTar, filepath.Dir(stubTar), cfg); err != nil {
+		return fmt.Errorf("解压文件失败: %w", err)
+	}
+	if cfg.DryRun {
+		return nil
+	}
+
+	slog.Info("文件解压成功")
+	return nil
+}
+
+// 处理Stub目录中的文件，only 不为空时只执行该类操作
+// 子目录按数字前缀分批依次处理，同一批次内的子目录并发处理，规则见 subDirBatches
+// state 不为 nil 时跳过之前已处理完成的子目录，并在每个子目录完成后记录进度
+func processStubDir(ctx context.Context, cwd string, m *manifest, only string, state *runState, cfg *Config) error {
+	// 读取子目录
+	entries, err := os.ReadDir(cwd)
+	if err != nil {
+		return fmt.Errorf("读取目录失败: %w", err)
+	}
+
+	// 如果不是文件夹，则跳过不处理
+	var subDirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == minioDataDir {
+			continue
+		}
+		if state.done(entry.Name(), only) {
+			slog.Info("子目录已在之前的运行中处理完成，跳过", "subdir", entry.Name())
+			continue
+		}
+		subDirs = append(subDirs, entry.Name())
+	}
+
+	// 创建一个有限制的通道，用于控制并发数量，所有子目录中的文件共用
+	semaphore := make(chan struct{}, cfg.ConcurrentTasks)
+
+	// 输出已处理的字节数和镜像数
+	defer cfg.session.progress.start(cwd, subDirs, only, cfg)()
+
+	progress := &subDirProgress{phase: only, total: len(subDirs)}
+	batches := subDirBatches(subDirs)
+	for _, batch := range batches {
+		if len(batches) > 1 {
+			slog.Info("开始处理子目录批次", "subdirs", batch)
+		}
+		if err := processSubDirBatch(ctx, cwd, m, batch, only, semaphore, state, progress, cfg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 并发处理同一批次的子目录
+func processSubDirBatch(ctx context.Context, cwd string, m *manifest, subDirs []string, only string, semaphore chan struct{}, state *runState, progress *subDirProgress, cfg *Config) error {
+	var wg sync.WaitGroup
+	errChan := make(chan error, len(subDirs))
+
+	for _, subDir := range subDirs {
+		wg.Add(1)
+
+		go func(subDir string) {
+			defer wg.Done()
+
+			if err := processSubDir(ctx, filepath.Join(cwd, subDir), m.subDir(subDir), only, 1, semaphore, state, cfg); err != nil {
+				errChan <- fmt.Errorf("处理子目录 %s 失败: %w", subDir, err)
+				return
+			}
+			progress.finish()
+
+			if err := state.markDone(subDir, only); err != nil {
+				errChan <- err
+			}
+		}(subDir)
+	}
+
+	// 等待所有goroutine完成
+	wg.Wait()
+	close(errChan)
+
+	// 收集所有错误
+	var errs []error
+	for err := range errChan {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("处理子目录时发生错误: %w", errorList(errs))
+	}
+
+	return nil
+}
+
+// 处理单个子目录，only 不为空时只执行该类操作
+// 依次解压文件的同时并发加载镜像，每个文件占用 semaphore 中的一个位置，ConcurrentTasks 限制的是所有子目录中同时处理的文件数
+// 子目录中有 images.txt 时从仓库拉取其中列出的镜像，不再加载镜像压缩文件
+// depth 为子目录相对 Stub 根目录的层级，小于 MaxDepth 时处理完当前目录后并发处理下一级目录
+func processSubDir(ctx context.Context, subDirPath string, sub subDirManifest, only string, depth int, semaphore chan struct{}, state *runState, cfg *Config) error {
+	files, err := os.ReadDir(subDirPath)
+	if err != nil {
+		return fmt.Errorf("读取子目录失败: %w", err)
+	}
+
+	refs, err := readImageList(filepath.Join(subDirPath, imageListName))
+	if err != nil {
+		return err
+	}
+
+	// 下一级目录在解压前读取，不会处理本次解压出的目录
+	var extracts, loads, nested []string
+	for _, file := range files {
+		filePath := filepath.Join(subDirPath, file.Name())
+
+		if file.IsDir() {
+			nested = append(nested, file.Name())
+			continue
+		}
+
+		// 如果不是支持的压缩文件(.tar、.tar.gz、.tgz、.tar.zst、.tar.xz 等)则跳过不处理
+		op, ok := classifyArchive(file.Name())
+		if !ok || (only != "" && op != only) {
+			continue
+		}
+
+		// 仅准备文件时跳过所有镜像
+		if op == opLoad && cfg.FilesOnly {
+			slog.Info("仅准备文件，跳过镜像", "file", filePath)
+			continue
+		}
+
+		if op == opExtract {
+			extracts = append(extracts, file.Name())
+		} else if !archSelected(file.Name(), cfg) {
+			slog.Info("镜像文件不是目标架构，跳过", "file", filePath, "targetArch", targetArch(cfg))
+		} else if refs != nil {
+			slog.Info("子目录中有镜像列表，跳过镜像文件", "file", filePath, "list", imageListName)
+		} else {
+			loads = append(loads, file.Name())
+		}
+	}
+
+	// 拉取镜像与加载镜像属于同一阶段
+	var pulls []string
+	if refs != nil && (only == "" || only == opLoad) {
+		if cfg.FilesOnly {
+			slog.Info("仅准备文件，跳过镜像", "file", filepath.Join(subDirPath, imageListName))
+		} else {
+			pulls = refs
+		}
+	}
+
+	// 文件压缩包可能覆盖彼此的文件，按顺序依次解压，同时并发加载或拉取镜像
+	extracted := make(chan error, 1)
+	go func() {
+		for _, name := range extracts {
+			semaphore <- struct{}{} // 获取信号量
+			_, err := processFile(ctx, subDirPath, name, opExtract, sub, state, cfg)
+			<-semaphore // 释放信号量
+			if err != nil {
+				extracted <- err
+				return
+			}
+		}
+		extracted <- nil
+	}()
+
+	var errs []error
+	loaded, err := processImages(ctx, subDirPath, loads, opLoad, sub, semaphore, state, cfg)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("加载镜像时发生错误: %w", err))
+	}
+	pulled, err := processImages(ctx, subDirPath, pulls, opPull, sub, semaphore, state, cfg)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("拉取镜像时发生错误: %w", err))
+	}
+	if err := <-extracted; err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	if len(errs) > 0 {
+		return errorList(errs)
+	}
+
+	// 与子目录中 expected-images.txt 列出的镜像核对，试运行时没有实际加载镜像
+	if only != opExtract && !cfg.FilesOnly && !cfg.DryRun {
+		if err := checkExpectedImages(subDirPath, append(loaded, pulled...)); err != nil {
+			return err
+		}
+	}
+
+	if len(nested) == 0 {
+		return nil
+	}
+	if depth >= cfg.MaxDepth {
+		slog.Debug("已达到最大目录深度，不处理下一级目录", "dir", subDirPath, "maxDepth", cfg.MaxDepth)
+		return nil
+	}
+	return processNestedDirs(ctx, subDirPath, nested, sub, only, depth+1, semaphore, state, cfg)
+}
+
+// 并发处理下一级目录，沿用上级目录的 Docker 上下文，文件压缩包解压到其所在目录
+func processNestedDirs(ctx context.Context, parent string, names []string, sub subDirManifest, only string, depth int, semaphore chan struct{}, state *runState, cfg *Config) error {
+	sub.ExtractTarget = ""
+
+	var wg sync.WaitGroup
+	errChan := make(chan error, len(names))
+	for _, name := range names {
+		wg.Add(1)
+
+		go func(name string) {
+			defer wg.Done()
+
+			if err := processSubDir(ctx, filepath.Join(parent, name), sub, only, depth, semaphore, state, cfg); err != nil {
+				errChan <- fmt.Errorf("处理目录 %s 失败: %w", name, err)
+			}
+		}(name)
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	var errs []error
+	for err := range errChan {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return errorList(errs)
+	}
+
+	return nil
+}
+
+// 并发处理镜像文件或镜像引用，每项占用 semaphore 中的一个位置，返回所有镜像和汇总的错误
+func processImages(ctx context.Context, subDirPath string, names []string, op string, sub subDirManifest, semaphore chan struct{}, state *runState, cfg *Config) ([]string, error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var images []string
+	errChan := make(chan error, len(names))
+	for _, name := range names {
+		wg.Add(1)
+		semaphore <- struct{}{} // 获取信号量
+
+		go func(name string) {
+			defer wg.Done()
+			defer func() { <-semaphore }() // 释放信号量
+
+			loaded, err := processFile(ctx, subDirPath, name, op, sub, state, cfg)
+			if err != nil {
+				errChan <- fmt.Errorf("%s: %w", name, err)
+				return
+			}
+
+			mu.Lock()
+			images = append(images, loaded...)
+			mu.Unlock()
+		}(name)
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	var errs []error
+	for err := range errChan {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return nil, errorList(errs)
+	}
+
+	return images, nil
+}
+
+// 处理子目录中的单个压缩文件或需要拉取的镜像，name 为文件名或镜像引用
+// 返回加载或拉取的镜像，state 不为 nil 时跳过之前已处理完成的文件，并在完成后记录
+func processFile(ctx context.Context, subDirPath, name, op string, sub subDirManifest, state *runState, cfg *Config) ([]string, error) {
+	filePath := filepath.Join(subDirPath, name)
+	if state.fileDone(filePath) {
+		slog.Info("文件已在之前的运行中处理完成，跳过", "file", filePath)
+		cfg.session.progress.fileDone(filePath, op)
+		return completedImages(filePath, name, op), nil
+	}
+
+	// 之前的运行中需要重试的文件延长初始退避时间，并记录本次的重试次数
+	cfg = state.fileConfig(filePath, cfg)
+	defer func() {
+		if err := state.recordRetries(filePath, cfg); err != nil {
+			slog.Warn("记录文件的重试次数失败", "file", filePath, "error", err)
+		}
+	}()
+
+	started := time.Now()
+	if op == opPull {
+		var images []string
+		err := withCategory(ErrDockerLoadFailed, pullImage(ctx, name, sub, cfg))
+		if err == nil {
+			images = []string{name}
+			err = state.markFileDone(filePath)
+			cfg.session.progress.fileDone(filePath, op)
+		}
+		cfg.session.events.emitFile(name, op, err)
+		cfg.session.report.record(subDirPath, name, op, 0, images, reportImageIDs(ctx, images, sub, cfg), time.Since(started), err)
+		return images, err
+	}
+
+	// 处理完成后压缩文件可能被删除，先记录文件大小
+	var size int64
+	if info, err := os.Stat(filePath); err == nil {
+		size = info.Size()
+	}
+
+	var images []string
+	err := verifyArchive(filePath, cfg)
+	if err == nil {
+		if op == opExtract {
+			err = withCategory(ErrExtractFailed, extractFiles(ctx, filePath, sub, cfg))
+		} else {
+			images, err = loadImage(ctx, filePath, sub, cfg)
+			err = withCategory(ErrDockerLoadFailed, err)
+		}
+	}
+	if err == nil {
+		err = state.markFileDone(filePath)
+		cfg.session.progress.fileDone(filePath, op)
+	}
+
+	cfg.session.events.emitFile(filePath, op, err)
+	cfg.session.report.record(subDirPath, filePath, op, size, images, reportImageIDs(ctx, images, sub, cfg), time.Since(started), err)
+	return images, err
+}
+
+// 解压子目录中的文件压缩包
+func extractFiles(ctx context.Context, filePath string, sub subDirManifest, cfg *Config) error {
+	// 获取文件所在目录作为解压目标，清单中指定时使用指定目录
+	targetDir := filepath.Dir(filePath)
+	if sub.ExtractTarget != "" {
+		targetDir = sub.ExtractTarget
+	}
+	if cfg.DryRun {
+		return extractTar(ctx, filePath, targetDir, cfg)
+	}
+	if err := cfg.session.changes.recordExtract(ctx, filePath, targetDir, cfg); err != nil {
+		return err
+	}
+	if sub.ExtractTarget != "" {
+		if err := os.MkdirAll(targetDir, 0o755); err != nil {
+			return fmt.Errorf("创建解压目标目录失败: %w", err)
+		}
+	}
+	slog.Info("正在解压文件", "file", filePath, "targetDir", targetDir)
+	if err := extractTar(ctx, filePath, targetDir, cfg); err != nil {
+		return err
+	}
+
+	// 检查容器运行用户能否读取解压的文件
+	if err := checkOwnership(targetDir, cfg); err != nil {
+		return fmt.Errorf("检查文件权限失败: %w", err)
+	}
+
+	return nil
+}
+
+// 加载子目录中的Docker镜像，返回 docker load 输出的已加载镜像
+// 镜像文件通过标准输入流式传给 docker load，只有加载前必须知道镜像标签时（允许的仓库列表、跳过已有镜像）才额外读取一遍
+func loadImage(ctx context.Context, filePath string, sub subDirManifest, cfg *Config) ([]string, error) {
+	if dryRun(cfg.runtime().Load(ctx, sub, cfg), cfg, "file", filePath) {
+		return nil, nil
+	}
+
+	switch cfg.TagClobber {
+	case clobberProceed, clobberWarn, clobberError:
+	default:
+		return nil, fmt.Errorf("未知的镜像标签覆盖处理方式: %s", cfg.TagClobber)
+	}
+
+	if len(cfg.AllowedImageRepos) > 0 || cfg.SkipExistingImages {
+		tags, err := readImageRepoTags(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		// 检查镜像仓库是否允许加载
+		if err := checkImageAllowed(filePath, tags, cfg); err != nil {
+			return nil, err
+		}
+
+		// 镜像文件中的标签都已存在时跳过加载
+		if cfg.SkipExistingImages && imagesPresent(ctx, tags, sub, cfg) {
+			slog.Info("镜像已存在，跳过加载", "file", filePath, "images", tags)
+			// 中继模式下已存在的镜像同样需要推送到中继仓库
+			if cfg.Relay.Enabled {
+				if err := relayImages(ctx, tags, sub, cfg); err != nil {
+					return nil, err
+				}
+			}
+			return tags, nil
+		}
+	}
+
+	// 记录加载前的本地镜像标签，用于检查标签是否被覆盖、记录新加载的镜像以及清理损坏镜像文件的残留
+	var before map[string]string
+	if cfg.TagClobber != clobberProceed || cfg.session.changes.active() || cfg.CleanupCorruptLoads {
+		var err error
+		if before, err = localImageTags(ctx, sub, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	slog.Info("正在加载Docker镜像", "file", filePath, "context", sub.DockerContext)
+	var output []byte
+	err := retry(ctx, cfg, "docker load "+filePath, func(ctx context.Context) error {
+		r, closer, err := openImageStream(filePath)
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+
+		if cfg.UseDockerSDK {
+			output, err = loadImageSDK(ctx, r, filePath, sub)
+			return err
+		}
+		cmd := cfg.runtime().Load(ctx, sub, cfg)
+		cmd.Stdin = r
+		if output, err = combinedOutput(cmd, filePath, cfg); err != nil {
+			return &outputError{err: err, output: output}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, loadError(ctx, filePath, output, err, before, sub, cfg)
+	}
+
+	// 镜像文件被截断时 docker load 可能成功退出但没有加载任何镜像
+	images := parseLoadedImages(output)
+	if len(images) == 0 {
+		return nil, fmt.Errorf("docker load 没有输出已加载的镜像, 输出: %s", output)
+	}
+
+	if err := cfg.session.changes.recordImages(images, before, sub); err != nil {
+		return nil, err
+	}
+
+	if cfg.TagClobber != clobberProceed {
+		prev := make(map[string]string, len(images))
+		for _, image := range images {
+			prev[image] = before[image]
+		}
+		if err := checkTagClobber(filePath, prev, imageIDs(ctx, images, sub, cfg), cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// 检查镜像架构
+	if err := checkImageArch(ctx, images, sub, cfg); err != nil {
+		return nil, err
+	}
+
+	// 中继模式下推送到中继仓库
+	if cfg.Relay.Enabled {
+		if err := relayImages(ctx, images, sub, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return images, nil
+}
+
+// Compose 拉取镜像策略
+const (
+	pullMissing = "missing"
+	pullNever   = "never"
+	pullAlways  = "always"
+)
+
+// 构造 compose up 命令参数
+func composeUpArgs(cfg *Config) ([]string, error) {
+	switch cfg.ComposePullPolicy {
+	case pullMissing, pullNever, pullAlways:
+	default:
+		return nil, fmt.Errorf("未知的镜像拉取策略: %s", cfg.ComposePullPolicy)
+	}
+
+	// docker-compose v1 不支持 --pull
+	if isComposeV1(cfg) {
+		return []string{"up", "-d"}, nil
+	}
+
+	return []string{"up", "-d", "--pull", cfg.ComposePullPolicy}, nil
+}
+
+// 构造 Compose 命令，指定了 Compose 文件时加上 -f
+func composeCommand(ctx context.Context, cfg *Config, args ...string) *exec.Cmd {
+	parts := strings.Fields(cfg.ComposeCmd)
+	full := append([]string{}, parts[1:]...)
+	if cfg.ComposeFile != "" {
+		full = append(full, "-f", cfg.ComposeFile)
+	}
+
+	cmd := command(ctx, cfg, parts[0], append(full, args...)...)
+	cmd.Dir = cfg.WorkDir
+	return cmd
+}
+
+// 启动Docker Compose
+func startDockerCompose(ctx context.Context, cfg *Config) error {
+	slog.Info("正在启动Docker Compose服务")
+
+	// 启动docker-compose
+	upArgs, err := composeUpArgs(cfg)
+	if err != nil {
+		return err
+	}
+	if dryRun(cfg.runtime().ComposeUp(ctx, upArgs, cfg), cfg) {
+		return nil
+	}
+	if err := cfg.session.changes.recordCompose(); err != nil {
+		return err
+	}
+	err = retry(ctx, cfg, cfg.ComposeCmd+" up", func(ctx context.Context) error {
+		if output, err := combinedOutput(cfg.runtime().ComposeUp(ctx, upArgs, cfg), "compose", cfg); err != nil {
+			return fmt.Errorf("%s up 命令失败: %w, 输出: %s", cfg.ComposeCmd, err, output)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// docker-compose v1 不支持 JSON 格式的状态输出
+	if isComposeV1(cfg) {
+		slog.Info("Docker Compose服务已启动")
+		return nil
+	}
+
+	// 等待所有服务运行且健康检查通过
+	services, err := waitComposeHealthy(ctx, cfg)
+	if services != nil {
+		cfg.session.status.setServices(services)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, service := range services {
+		slog.Info("Compose 服务状态", "service", service.Service, "state", service.State, "health", service.Health, "ports", service.Ports)
+	}
+
+	slog.Info("Docker Compose服务已启动", "services", len(services))
+	return nil
+}
+
+// 等待Minio服务就绪并配置 mc 别名，已按当前配置设置时只检查服务是否就绪
+func setMinioAlias(ctx context.Context, cfg *Config) error {
+	probe := []string{
+		"alias",
+		"set",
+		cfg.MinioAlias,
+		cfg.MinioEndpoint,
+		cfg.MinioUser,
+		cfg.MinioUserPass,
+	}
+	if minioAliasConfigured(ctx, cfg) {
+		slog.Info("Minio别名已配置，跳过", "alias", cfg.MinioAlias)
+		probe = []string{"ready", cfg.MinioAlias}
+	}
+	return waitMinioReady(ctx, cfg, probe...)
+}
+
+// 配置Minio，stubTar 为主Stub文件，试运行时用于列出 Minio 初始数据
+func configureMinio(ctx context.Context, stubTar string, cfg *Config) error {
+	slog.Info("正在配置Minio")
+
+	// 从外部来源获取 Minio 凭据
+	if err := resolveMinioSecrets(ctx, cfg); err != nil {
+		return err
+	}
+	if err := cfg.validateMinio(); err != nil {
+		return err
+	}
+
+	// 轮询 Minio 的就绪检查地址，不再依赖固定的等待时间
+	if err := waitForService(ctx, "minio", minioHealthURL(cfg), cfg.MinioReadyTimeout, cfg); err != nil {
+		return err
+	}
+
+	// minio-data 中有初始数据的存储桶即使未配置也会创建
+	seedDir, seeds, err := minioSeedBuckets(ctx, stubTar, cfg)
+	if err != nil {
+		return err
+	}
+	cfg.MinioBuckets = withSeedBuckets(cfg.MinioBuckets, seeds)
+
+	// MinioSDK 时直接连接 MinioEndpoint 等待就绪并创建存储桶，不依赖容器中的 mc
+	if cfg.MinioSDK {
+		client, err := newMinioClient(cfg)
+		if err != nil {
+			return err
+		}
+		if err := waitMinioReadySDK(ctx, client, cfg); err != nil {
+			return err
+		}
+		if !cfg.DryRun {
+			if err := sleepContext(ctx, cfg.MinioSettleDelay); err != nil {
+				return fmt.Errorf("等待Minio就绪失败: %w", err)
+			}
+		}
+		if err := createMinioBucketsSDK(ctx, client, cfg); err != nil {
+			return err
+		}
+		if err := seedMinioBucketsSDK(ctx, client, seedDir, seeds, cfg); err != nil {
+			return err
+		}
+
+		// 访问密钥只能通过 Minio 管理接口创建，仍使用 mc，需要先配置 mc 别名
+		if err := setMinioAlias(ctx, cfg); err != nil {
+			return err
+		}
+		if err := createMinioAccessKeys(ctx, cfg); err != nil {
+			return err
+		}
+
+		slog.Info("Minio配置完成")
+		return nil
+	}
+
+	if err := setMinioAlias(ctx, cfg); err != nil {
+		return err
+	}
+
+	// 等待 Minio IAM 等子系统初始化完成
+	if !cfg.DryRun {
+		if err := sleepContext(ctx, cfg.MinioSettleDelay); err != nil {
+			return fmt.Errorf("等待Minio就绪失败: %w", err)
+		}
+	}
+
+	// 创建存储桶并上传初始数据
+	if err := createMinioBuckets(ctx, cfg); err != nil {
+		return err
+	}
+	if err := seedMinioBuckets(ctx, seedDir, seeds, cfg); err != nil {
+		return err
+	}
+
+	// 创建Minio访问密钥，已存在时跳过
+	if err := createMinioAccessKeys(ctx, cfg); err != nil {
+		return err
+	}
+
+	slog.Info("Minio配置完成")
+	return nil
+}
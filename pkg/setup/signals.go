@@ -0,0 +1,45 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// 收到 SIGINT 或 SIGTERM 后返回的错误
+var ErrInterrupted = errors.New("收到退出信号，已停止")
+
+// 收到 SIGINT 或 SIGTERM 时取消上下文，正在执行的外部命令随之终止
+// 取消原因为 ErrInterrupted，以便与超时区分
+func notifyInterrupt(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-sigs:
+			slog.Warn("收到退出信号，正在停止", "signal", sig.String())
+			cancel(ErrInterrupted)
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel(nil)
+	}
+}
+
+// 上下文因退出信号取消时，在错误中标记 ErrInterrupted
+func interruptError(ctx context.Context, err error) error {
+	if err == nil || !errors.Is(context.Cause(ctx), ErrInterrupted) || errors.Is(err, ErrInterrupted) {
+		return err
+	}
+
+	return errors.Join(ErrInterrupted, err)
+}
@@ -0,0 +1,52 @@
+//go:build unix
+
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunInterrupted(t *testing.T) {
+	cfg := testConfig(t, nil)
+	cfg.Runner = nil
+	cfg.Preflight = false
+	cfg.StartCompose = false
+	writeTestStub(t, cfg, []testEntry{
+		{Name: "10-app/", Typeflag: tar.TypeDir},
+		{Name: "10-app/app.tar", Typeflag: tar.TypeReg, Body: "image"},
+	})
+
+	// docker load 一直不结束
+	bin := t.TempDir()
+	script := "#!/bin/sh\nfor a; do [ \"$a\" = load ] && exec sleep 5; done\nexit 0\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctx, stop := notifyInterrupt(context.Background())
+	defer stop()
+	time.AfterFunc(200*time.Millisecond, func() { syscall.Kill(os.Getpid(), syscall.SIGINT) })
+
+	start := time.Now()
+	err := interruptError(ctx, Run(ctx, cfg))
+	if !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("Run() error = %v, want %v", err, ErrInterrupted)
+	}
+	if got := ExitCode(err); got != exitInterrupted {
+		t.Errorf("ExitCode() = %d, want %d", got, exitInterrupted)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("收到退出信号后 %s 才返回", elapsed)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.WorkDir, lockFileName)); !os.IsNotExist(err) {
+		t.Errorf("退出后锁文件仍存在: %v", err)
+	}
+}
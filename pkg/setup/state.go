@@ -0,0 +1,240 @@
+package setup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// 断点续跑的状态文件，位于工作目录中
+const stateFileName = ".setup-state.json"
+
+// 根据之前的重试次数预先翻倍初始退避时间的最多次数
+const maxHistoryBackoffShift = 3
+
+// 断点续跑状态：记录已成功处理的子目录和文件，以及文件在最近一次运行中的重试次数，可并发使用
+// 主Stub文件的校验和变化时之前的处理进度失效，重试次数保留
+type runState struct {
+	mu   sync.Mutex
+	path string
+
+	Stub      string         `json:"stub"`
+	Completed []string       `json:"completed"`
+	Retries   map[string]int `json:"retries,omitempty"`
+}
+
+// 读取工作目录中的状态文件，文件不存在、主Stub文件已变化或 restart 时从头开始，文件的重试次数总是保留
+func loadRunState(cwd, stubTar string, restart bool) (*runState, error) {
+	sum, err := fileSHA256(stubTar)
+	if err != nil {
+		return nil, fmt.Errorf("计算主Stub文件校验和失败: %w", err)
+	}
+
+	state := &runState{path: filepath.Join(cwd, stateFileName), Stub: sum}
+	data, err := os.ReadFile(state.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取状态文件失败: %w", err)
+	}
+
+	var saved runState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("解析状态文件 %s 失败: %w", state.path, err)
+	}
+	state.Retries = saved.Retries
+	if restart {
+		slog.Info("忽略之前的处理进度，从头开始", "file", state.path)
+		return state, nil
+	}
+	if saved.Stub != sum {
+		slog.Info("主Stub文件已变化，忽略之前的处理进度", "file", state.path)
+		return state, nil
+	}
+
+	state.Completed = saved.Completed
+	if len(state.Completed) > 0 {
+		slog.Info("从上次中断处继续", "completed", state.Completed)
+	}
+	return state, nil
+}
+
+// 子目录在当前阶段的记录名，分阶段处理时每个阶段分别记录
+func stateKey(subDir, only string) string {
+	if only == "" {
+		return subDir
+	}
+	return subDir + "@" + only
+}
+
+// 子目录是否已在之前的运行中处理完成，state 为 nil 时总是返回 false
+func (s *runState) done(subDir, only string) bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Contains(s.Completed, subDir) || slices.Contains(s.Completed, stateKey(subDir, only))
+}
+
+// 记录子目录处理完成并立即写入状态文件，state 为 nil 时不记录
+func (s *runState) markDone(subDir, only string) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Completed = append(s.Completed, stateKey(subDir, only))
+	return s.save()
+}
+
+// 文件的记录名，为相对工作目录的路径，与子目录的记录名不会重复
+func (s *runState) fileKey(filePath string) string {
+	rel, err := filepath.Rel(filepath.Dir(s.path), filePath)
+	if err != nil {
+		return filePath
+	}
+	return filepath.ToSlash(rel)
+}
+
+// 文件是否已在之前的运行中处理完成，state 为 nil 时总是返回 false
+func (s *runState) fileDone(filePath string) bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Contains(s.Completed, s.fileKey(filePath))
+}
+
+// 记录文件处理完成并立即写入状态文件，state 为 nil 时不记录
+func (s *runState) markFileDone(filePath string) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Completed = append(s.Completed, s.fileKey(filePath))
+	return s.save()
+}
+
+// 写入状态文件，调用方需持有 s.mu
+func (s *runState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免中断时留下不完整的状态文件
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("写入状态文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("写入状态文件失败: %w", err)
+	}
+
+	return nil
+}
+
+// 处理文件使用的配置，带有该文件在之前的运行中的重试次数，并统计本次的重试次数
+// state 为 nil 或文件没有重试记录时退避时间不变
+func (s *runState) fileConfig(filePath string, cfg *Config) *Config {
+	fileCfg := *cfg
+	fileCfg.retryCount = &atomic.Int32{}
+	if s == nil {
+		return &fileCfg
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n := s.Retries[s.fileKey(filePath)]; n > 0 {
+		slog.Info("文件在之前的运行中需要重试，延长初始退避时间", "file", filePath, "retries", n)
+		fileCfg.retryHistory = n
+	}
+	return &fileCfg
+}
+
+// 记录文件本次处理中的重试次数，与之前的记录不同时立即写入状态文件，没有重试时删除记录
+func (s *runState) recordRetries(filePath string, cfg *Config) error {
+	if s == nil || cfg.retryCount == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, n := s.fileKey(filePath), int(cfg.retryCount.Load())
+	if s.Retries[key] == n {
+		return nil
+	}
+	if n == 0 {
+		delete(s.Retries, key)
+	} else {
+		if s.Retries == nil {
+			s.Retries = make(map[string]int)
+		}
+		s.Retries[key] = n
+	}
+	return s.save()
+}
+
+// 全部处理成功后清除处理进度：有文件的重试记录时只保留重试记录，否则删除状态文件，state 为 nil 时不处理
+func (s *runState) finish() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.Retries) == 0 {
+		return s.remove()
+	}
+	s.Completed = nil
+	return s.save()
+}
+
+// 删除状态文件，state 为 nil 时不处理
+func (s *runState) remove() error {
+	if s == nil {
+		return nil
+	}
+
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("删除状态文件失败: %w", err)
+	}
+	return nil
+}
+
+// 之前已处理完成的文件对应的镜像，用于核对 expected-images.txt
+func completedImages(filePath, name, op string) []string {
+	switch op {
+	case opPull:
+		return []string{name}
+	case opLoad:
+		tags, err := readImageRepoTags(filePath)
+		if err != nil {
+			slog.Debug("读取镜像文件的标签失败", "file", filePath, "error", err)
+		}
+		return tags
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// 在工作目录中写入主Stub文件和带有重试记录的状态文件
+func writeRetryState(t *testing.T, cwd string, retries map[string]int) string {
+	t.Helper()
+
+	stubTar := filepath.Join(cwd, "stub.tar")
+	if err := os.WriteFile(stubTar, []byte("stub"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if retries == nil {
+		return stubTar
+	}
+
+	data, err := json.Marshal(runState{Stub: "changed", Completed: []string{"00-base"}, Retries: retries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cwd, stateFileName), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return stubTar
+}
+
+func TestHistoryBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		retries map[string]int
+		restart bool
+		want    time.Duration
+	}{
+		{name: "没有状态文件", want: time.Second},
+		{name: "其他文件需要重试", retries: map[string]int{"00-base/db.tar": 2}, want: time.Second},
+		{name: "之前重试 1 次", retries: map[string]int{"00-base/app.tar": 1}, want: 2 * time.Second},
+		{name: "之前重试 2 次", retries: map[string]int{"00-base/app.tar": 2}, want: 4 * time.Second},
+		{name: "翻倍次数有上限", retries: map[string]int{"00-base/app.tar": 10}, want: 8 * time.Second},
+		{name: "restart 时保留重试记录", retries: map[string]int{"00-base/app.tar": 1}, restart: true, want: 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cwd := t.TempDir()
+			stubTar := writeRetryState(t, cwd, tt.retries)
+
+			// 主Stub文件已变化，之前的处理进度失效但重试记录保留
+			state, err := loadRunState(cwd, stubTar, tt.restart)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(state.Completed) > 0 {
+				t.Errorf("loadRunState() 保留了之前的处理进度 %v", state.Completed)
+			}
+
+			cfg := DefaultConfig()
+			cfg.RetryBackoff = time.Second
+			cfg.RetryJitter = 0
+			fileCfg := state.fileConfig(filepath.Join(cwd, "00-base", "app.tar"), cfg)
+			if got := retryBackoff(0, fileCfg); got != tt.want {
+				t.Errorf("retryBackoff() = %s, want %s", got, tt.want)
+			}
+			if got := retryBackoff(0, cfg); got != time.Second {
+				t.Errorf("fileConfig() 修改了原配置，retryBackoff() = %s", got)
+			}
+		})
+	}
+}
+
+func TestRecordRetries(t *testing.T) {
+	cwd := t.TempDir()
+	stubTar := writeRetryState(t, cwd, nil)
+	state, err := loadRunState(cwd, stubTar, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.MaxRetries = 2
+	cfg.RetryBackoff = time.Millisecond
+	flaky := filepath.Join(cwd, "00-base", "app.tar")
+	stable := filepath.Join(cwd, "00-base", "files.tar")
+
+	// 第一次失败、第二次成功的文件记录 1 次重试
+	fileCfg := state.fileConfig(flaky, cfg)
+	attempts := 0
+	err = retry(context.Background(), fileCfg, "docker load", func(ctx context.Context) error {
+		if attempts++; attempts == 1 {
+			return errors.New("connection reset by peer")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.recordRetries(flaky, fileCfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.recordRetries(stable, state.fileConfig(stable, cfg)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 全部成功后状态文件只保留重试记录
+	if err := state.finish(); err != nil {
+		t.Fatal(err)
+	}
+	next, err := loadRunState(cwd, stubTar, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next.Completed) > 0 || len(next.Retries) != 1 || next.Retries["00-base/app.tar"] != 1 {
+		t.Errorf("完成后的状态 = %+v, 应只保留 00-base/app.tar 的 1 次重试", next)
+	}
+
+	// 之后的运行不再需要重试时删除记录，没有记录时删除状态文件
+	if err := next.recordRetries(flaky, next.fileConfig(flaky, cfg)); err != nil {
+		t.Fatal(err)
+	}
+	if err := next.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(cwd, stateFileName)); !os.IsNotExist(err) {
+		t.Errorf("没有重试记录时应删除状态文件: %v", err)
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	tests := []struct {
+		name       string
+		changeStub bool
+		wantLoads  int
+	}{
+		{name: "只处理剩余的子目录", wantLoads: 1},
+		{name: "主Stub文件变化后从头开始", changeStub: true, wantLoads: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 第一次运行时第二个加载的镜像文件失败
+			loads, failAt := 0, 2
+			runner := &fakeRunner{respond: func(args []string) ([]byte, error) {
+				if slices.Contains(args, "load") {
+					loads++
+					if loads == failAt {
+						return nil, errors.New("exit status 1")
+					}
+				}
+				return loadedImages("app:1")(args)
+			}}
+			cfg := testConfig(t, runner)
+			cfg.Preflight = false
+			cfg.StartCompose = false
+			entries := []testEntry{
+				{Name: "00-base/", Typeflag: tar.TypeDir},
+				{Name: "00-base/base.tar", Typeflag: tar.TypeReg, Body: "base"},
+				{Name: "10-app/", Typeflag: tar.TypeDir},
+				{Name: "10-app/app.tar", Typeflag: tar.TypeReg, Body: "app"},
+			}
+			writeTestStub(t, cfg, entries)
+
+			if err := Run(context.Background(), cfg); err == nil {
+				t.Fatal("第一次运行 Run() 成功, want 10-app 加载失败")
+			}
+
+			if tt.changeStub {
+				writeTestStub(t, cfg, append(entries, testEntry{Name: "README", Typeflag: tar.TypeReg, Body: "v2"}))
+			}
+			loads, failAt = 0, 0
+			if err := Run(context.Background(), cfg); err != nil {
+				t.Fatalf("第二次运行 Run() error = %v", err)
+			}
+			if loads != tt.wantLoads {
+				t.Errorf("第二次运行加载了 %d 个镜像文件, want %d", loads, tt.wantLoads)
+			}
+			if _, err := os.Stat(filepath.Join(cfg.WorkDir, stateFileName)); err == nil {
+				t.Errorf("全部成功后仍保留了之前的处理进度")
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package setup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 运行阶段
+const (
+	stageIdle         = "idle"
+	stageDependencies = "dependencies"
+	stageExtract      = "extract"
+	stageProcess      = "process"
+	stageCompose      = "compose"
+	stageMinio        = "minio"
+	stageDone         = "done"
+)
+
+// 单个阶段的耗时
+type stageTiming struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+}
+
+// 运行状态，可并发读写
+type runStatus struct {
+	mu         sync.Mutex
+	Stage      string        `json:"stage"`
+	StartedAt  time.Time     `json:"startedAt"`
+	UpdatedAt  time.Time     `json:"updatedAt"`
+	FinishedAt time.Time     `json:"finishedAt,omitzero"`
+	LastResult string        `json:"lastResult,omitempty"`
+	LastError  string        `json:"lastError,omitempty"`
+	Stages     []stageTiming `json:"stages,omitempty"`
+
+	Fingerprint string           `json:"fingerprint,omitempty"`
+	Services    []composeService `json:"services,omitempty"`
+
+	stageStartedAt time.Time
+}
+
+// 开始一次新的运行
+func (s *runStatus) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.Stage = stageIdle
+	s.StartedAt = now
+	s.UpdatedAt = now
+	s.FinishedAt = time.Time{}
+	s.Stages = nil
+	s.Fingerprint = ""
+	s.Services = nil
+}
+
+// 记录部署指纹
+func (s *runStatus) setFingerprint(fingerprint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Fingerprint = fingerprint
+}
+
+// 记录 Compose 服务状态
+func (s *runStatus) setServices(services []composeService) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Services = services
+}
+
+// 结束当前阶段并记录耗时，调用方需持有锁
+func (s *runStatus) endStage(now time.Time) {
+	if s.Stage == stageIdle || s.Stage == stageDone {
+		return
+	}
+
+	s.Stages = append(s.Stages, stageTiming{
+		Name:    s.Stage,
+		Seconds: now.Sub(s.stageStartedAt).Seconds(),
+	})
+}
+
+// 各阶段耗时的副本
+func (s *runStatus) stageTimings() []stageTiming {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]stageTiming(nil), s.Stages...)
+}
+
+// 更新当前阶段，返回之前的阶段
+func (s *runStatus) setStage(stage string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.Stage
+	now := time.Now()
+	s.endStage(now)
+	s.Stage = stage
+	s.UpdatedAt = now
+	s.stageStartedAt = now
+
+	return prev
+}
+
+// 记录运行结果，返回结束前的阶段
+func (s *runStatus) finish(err error) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.Stage
+	now := time.Now()
+	s.endStage(now)
+	s.Stage = stageDone
+	s.UpdatedAt = now
+	s.FinishedAt = now
+	s.LastResult = "success"
+	s.LastError = ""
+	if err != nil {
+		s.LastResult = "failure"
+		s.LastError = err.Error()
+	}
+
+	return prev
+}
+
+// 进入新的运行阶段，更新运行状态并发送事件
+func enterStage(stage string, cfg *Config) {
+	s := cfg.session
+	if prev := s.status.setStage(stage); prev != stageIdle && prev != stageDone {
+		s.events.emit(event{Type: eventStageEnd, Stage: prev})
+	}
+	s.events.emit(event{Type: eventStageStart, Stage: stage})
+}
+
+// 结束本次运行，记录结果并发送事件
+func finishRun(err error, cfg *Config) {
+	s := cfg.session
+	if prev := s.status.finish(err); prev != stageIdle && prev != stageDone {
+		s.events.emit(event{Type: eventStageEnd, Stage: prev})
+	}
+	s.events.emit(event{Type: eventRunEnd, Error: errorString(err)})
+}
+
+// 序列化当前状态
+func (s *runStatus) MarshalJSON() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type snapshot runStatus
+	return json.Marshal((*snapshot)(s))
+}
+
+// 输出各阶段耗时汇总
+func logStageSummary(s *runStatus) {
+	var attrs []any
+	for _, stage := range s.stageTimings() {
+		attrs = append(attrs, stage.Name, time.Duration(stage.Seconds*float64(time.Second)).Round(time.Millisecond))
+	}
+
+	slog.Info("各阶段耗时", attrs...)
+}
+
+// 状态服务的路由，返回的状态中的密钥由 session 的脱敏器隐藏
+func statusHandler(session *runSession) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(session.status)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append(session.redactor.redactJSON(data), '\n'))
+	})
+
+	return mux
+}
+
+// 启动状态服务
+func startStatusServer(addr string, session *runSession) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("监听状态服务地址失败: %w", err)
+	}
+
+	srv := &http.Server{Handler: statusHandler(session)}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("状态服务异常退出", "error", err)
+		}
+	}()
+
+	slog.Info("状态服务已启动", "addr", ln.Addr().String())
+	return srv, nil
+}
+
+// 关闭状态服务
+func stopStatusServer(srv *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("关闭状态服务失败", "error", err)
+	}
+}
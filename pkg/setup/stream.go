@@ -0,0 +1,65 @@
+package setup
+
+import (
+	"bytes"
+	"log/slog"
+	"os/exec"
+	"sync"
+)
+
+// 运行命令并返回合并的标准输出和标准错误，与 cmd.CombinedOutput 一致
+// 开启 StreamOutput 时同时将输出逐行以 Debug 级别写入日志，source 为日志中的来源，通常是正在处理的文件
+func combinedOutput(cmd *exec.Cmd, source string, cfg *Config) ([]byte, error) {
+	if !cfg.StreamOutput {
+		return cfg.runner().CombinedOutput(cmd)
+	}
+
+	w := &lineLogger{source: source}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cfg.runner().Run(cmd)
+	w.flush()
+
+	return w.output.Bytes(), err
+}
+
+// 按行将命令输出写入日志，同时保留完整输出，可并发写入
+type lineLogger struct {
+	mu      sync.Mutex
+	source  string
+	output  bytes.Buffer
+	pending []byte
+}
+
+func (l *lineLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.output.Write(p)
+	l.pending = append(l.pending, p...)
+	for {
+		i := bytes.IndexAny(l.pending, "\r\n")
+		if i < 0 {
+			break
+		}
+		l.log(l.pending[:i])
+		l.pending = l.pending[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// 写入最后一行没有换行符的输出
+func (l *lineLogger) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.log(l.pending)
+	l.pending = nil
+}
+
+func (l *lineLogger) log(line []byte) {
+	if line = bytes.TrimSpace(line); len(line) > 0 {
+		slog.Debug("命令输出", "source", l.source, "line", string(line))
+	}
+}
@@ -0,0 +1,269 @@
+package setup
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 使用 archive/tar 解压到目标目录，不依赖外部 tar 命令，指定 members 时只解压这些条目
+func extractNative(ctx context.Context, tarPath, targetDir string, cfg *Config, members ...string) error {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var src io.Reader = f
+	if info.Size() > extractProgressThreshold {
+		src = &extractProgress{r: f, name: filepath.Base(tarPath), total: info.Size(), lastLog: time.Now()}
+	}
+	r, err := archiveReader(src, tarPath)
+	if err != nil {
+		return err
+	}
+
+	// 目录的修改时间在其中的文件写入后才能设置
+	type dirTime struct {
+		path  string
+		mtime time.Time
+	}
+	var dirs []dirTime
+	now := time.Now()
+
+	// 所有写入都相对于目标目录进行，os.Root 拒绝经过符号链接到达目录之外的路径
+	root, err := os.OpenRoot(targetDir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	// 按 entryName 比较 members，记录每个成员是否找到
+	found := make(map[string]bool, len(members))
+	for _, member := range members {
+		found[entryName(member)] = false
+	}
+
+	links := entryLinks{}
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %w", tarPath, err)
+		}
+
+		if len(members) > 0 {
+			member := entryName(hdr.Name)
+			if _, ok := found[member]; !ok {
+				continue
+			}
+			found[member] = true
+		}
+		if err := checkEntryPath(hdr.Name); err != nil {
+			return fmt.Errorf("拒绝解压 %s: %w", filepath.Base(tarPath), err)
+		}
+		if err := checkEntryLink(hdr); err != nil {
+			return fmt.Errorf("拒绝解压 %s: %w", filepath.Base(tarPath), err)
+		}
+		if err := links.check(hdr); err != nil {
+			return fmt.Errorf("拒绝解压 %s: %w", filepath.Base(tarPath), err)
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		target := filepath.Join(targetDir, name)
+		slog.Debug("解压条目", "file", tarPath, "entry", hdr.Name)
+		if err := writeEntry(tr, hdr, root, name); err != nil {
+			return fmt.Errorf("解压 %s 中的 %s 失败: %w", filepath.Base(tarPath), hdr.Name, err)
+		}
+
+		mtime, ok := entryMtime(hdr.ModTime, now, cfg)
+		if !ok || hdr.Typeflag == tar.TypeSymlink {
+			continue
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			dirs = append(dirs, dirTime{target, mtime})
+			continue
+		}
+		if err := os.Chtimes(target, mtime, mtime); err != nil {
+			return err
+		}
+	}
+
+	var missing []string
+	for _, member := range members {
+		if !found[entryName(member)] {
+			missing = append(missing, member)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s 中没有条目 %s", filepath.Base(tarPath), strings.Join(missing, ", "))
+	}
+
+	// 由内向外设置目录修改时间，避免设置子目录时改动父目录
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chtimes(dirs[i].path, dirs[i].mtime, dirs[i].mtime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 在 root 中写入单个条目，保留文件权限和目录结构，name 为相对于 root 的路径
+// 上级路径中的符号链接一律拒绝，即使指向 root 之内
+func writeEntry(tr *tar.Reader, hdr *tar.Header, root *os.Root, name string) error {
+	mode := hdr.FileInfo().Mode().Perm()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := rootDir(root, name, true); err != nil {
+			return err
+		}
+		dir, err := root.Open(name)
+		if err != nil {
+			return err
+		}
+		defer dir.Close()
+		return dir.Chmod(mode)
+	case tar.TypeReg:
+		if err := rootReplace(root, name); err != nil {
+			return err
+		}
+		out, err := root.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Chmod(mode); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	case tar.TypeSymlink:
+		if err := rootReplace(root, name); err != nil {
+			return err
+		}
+		// 上级路径已确认不含符号链接，os.Symlink 不会跟随链接写到其他位置
+		return os.Symlink(hdr.Linkname, filepath.Join(root.Name(), name))
+	case tar.TypeLink:
+		linkname := filepath.Clean(filepath.FromSlash(hdr.Linkname))
+		if err := rootDir(root, filepath.Dir(linkname), false); err != nil {
+			return err
+		}
+		if err := rootReplace(root, name); err != nil {
+			return err
+		}
+		return os.Link(filepath.Join(root.Name(), linkname), filepath.Join(root.Name(), name))
+	default:
+		// 设备文件、FIFO 等不需要解压，pax 扩展头已由 archive/tar 处理
+		slog.Debug("跳过不支持的条目类型", "entry", hdr.Name, "type", string(hdr.Typeflag))
+		return nil
+	}
+}
+
+// 创建 name 的上级目录并删除已有的 name，删除符号链接本身而不跟随
+func rootReplace(root *os.Root, name string) error {
+	if err := rootDir(root, filepath.Dir(name), true); err != nil {
+		return err
+	}
+	if err := root.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// 逐级检查 dir 的每一级都是目录而不是符号链接，create 为 true 时创建缺少的目录
+func rootDir(root *os.Root, dir string, create bool) error {
+	if dir == "." {
+		return nil
+	}
+
+	p := ""
+	for _, part := range strings.Split(dir, string(filepath.Separator)) {
+		p = filepath.Join(p, part)
+		info, err := root.Lstat(p)
+		if os.IsNotExist(err) && create {
+			if err := root.Mkdir(p, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("上级路径 %s 是符号链接", p)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("上级路径 %s 不是目录", p)
+		}
+	}
+
+	return nil
+}
+
+// 按修改时间处理方式计算条目的修改时间，返回 false 时使用解压时刻
+func entryMtime(mtime, now time.Time, cfg *Config) (time.Time, bool) {
+	switch cfg.MtimeMode {
+	case mtimeNow:
+		return time.Time{}, false
+	case mtimeClampToNow:
+		if mtime.After(now) || mtime.Unix() <= 0 {
+			return now, true
+		}
+	}
+
+	return mtime, true
+}
+
+// 使用 archive/tar 列出 tar 文件中的所有条目
+func listNativeEntries(tarPath string) ([]string, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := archiveReader(f, tarPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []string
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("列出 tar 条目失败: %w", err)
+		}
+		if name := strings.TrimSpace(hdr.Name); name != "" {
+			entries = append(entries, name)
+		}
+	}
+}
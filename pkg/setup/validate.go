@@ -0,0 +1,84 @@
+package setup
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// 检查配置是否有效，列出所有问题而不是只返回第一个
+func (cfg *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.StubTarName != "", "StubTarName 不能为空")
+	check(cfg.DockerCmd != "" || cfg.FilesOnly, "DockerCmd 不能为空")
+	check(cfg.TarCmd != "" || cfg.NativeExtract, "TarCmd 不能为空")
+	check(cfg.ConcurrentTasks > 0, "ConcurrentTasks 必须大于 0，实际为 %d", cfg.ConcurrentTasks)
+	check(cfg.Timeout >= 0, "Timeout 不能为负数，实际为 %s", cfg.Timeout)
+	check(cfg.StageTimeouts.Extract >= 0, "StageTimeouts.Extract 不能为负数，实际为 %s", cfg.StageTimeouts.Extract)
+	check(cfg.StageTimeouts.Load >= 0, "StageTimeouts.Load 不能为负数，实际为 %s", cfg.StageTimeouts.Load)
+	check(cfg.StageTimeouts.Compose >= 0, "StageTimeouts.Compose 不能为负数，实际为 %s", cfg.StageTimeouts.Compose)
+	check(cfg.StageTimeouts.Minio >= 0, "StageTimeouts.Minio 不能为负数，实际为 %s", cfg.StageTimeouts.Minio)
+	check(cfg.PerTaskTimeout >= 0, "PerTaskTimeout 不能为负数，实际为 %s", cfg.PerTaskTimeout)
+	check(cfg.MaxRetries >= 0, "MaxRetries 不能为负数，实际为 %d", cfg.MaxRetries)
+	check(cfg.RetryMaxBackoff >= 0, "RetryMaxBackoff 不能为负数，实际为 %s", cfg.RetryMaxBackoff)
+	check(cfg.RetryJitter >= 0 && cfg.RetryJitter <= 1, "RetryJitter 必须在 0 到 1 之间，实际为 %g", cfg.RetryJitter)
+	check(cfg.MaxDepth > 0, "MaxDepth 必须大于 0，实际为 %d", cfg.MaxDepth)
+	check(cfg.ArchSuffix == "" || strings.Contains(cfg.ArchSuffix, "{arch}"), "ArchSuffix %q 中没有 {arch}", cfg.ArchSuffix)
+	check(cfg.Arch == "" || slices.Contains(knownArches, cfg.Arch), "未知的架构 %s，可选 %s", cfg.Arch, strings.Join(knownArches, "、"))
+	check(slices.Contains([]string{runtimeAuto, runtimeDocker, runtimePodman, runtimeNerdctl}, cfg.Runtime), "未知的容器运行时 %s，可选 %s、%s、%s 或 %s", cfg.Runtime, runtimeAuto, runtimeDocker, runtimePodman, runtimeNerdctl)
+	check(slices.Contains([]string{progressAuto, progressBar, progressLog, progressOff}, cfg.Progress), "未知的进度输出方式 %s，可选 %s、%s、%s 或 %s", cfg.Progress, progressAuto, progressBar, progressLog, progressOff)
+	check(cfg.ProgressInterval > 0 || cfg.Progress == progressOff, "ProgressInterval 必须大于 0，实际为 %s", cfg.ProgressInterval)
+	check(!cfg.Relay.Enabled || cfg.Relay.Registry != "", "中继模式需要指定目标仓库地址")
+	check(!cfg.Relay.RemoveLocal || !cfg.Relay.Services, "中继模式删除本地镜像时不能启动 Compose 服务")
+	check(cfg.TrackChanges || !cfg.RollbackOnFailure, "RollbackOnFailure 需要启用 TrackChanges")
+	check(cfg.ComposeHealthTimeout >= 0, "ComposeHealthTimeout 不能为负数，实际为 %s", cfg.ComposeHealthTimeout)
+	check(cfg.ServiceWaitTimeout > 0 || len(cfg.WaitForServices) == 0, "ServiceWaitTimeout 必须大于 0，实际为 %s", cfg.ServiceWaitTimeout)
+	for _, s := range cfg.WaitForServices {
+		u, err := url.Parse(s.URL)
+		check(s.Name != "", "等待的服务名称不能为空")
+		check(err == nil && u.Host != "", "服务 %s 的健康检查地址 %s 无效", s.Name, s.URL)
+	}
+	for _, port := range cfg.PreflightPorts {
+		check(port > 0 && port <= 65535, "PreflightPorts 中的端口 %d 无效", port)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("配置无效: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// 检查配置 Minio 所需的配置项，在配置 Minio 前调用
+func (cfg *Config) validateMinio() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	u, err := url.Parse(cfg.MinioEndpoint)
+	check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "MinioEndpoint %q 不是有效的 http(s) 地址", cfg.MinioEndpoint)
+	check(cfg.MinioContainer != "", "MinioContainer 不能为空")
+	check(cfg.MinioAlias != "", "MinioAlias 不能为空")
+	check(cfg.MinioUser != "", "MinioUser 不能为空")
+	check(cfg.MinioUserPass != "", "MinioUserPass 不能为空")
+	for i, key := range minioKeys(cfg) {
+		check(key.AccessKey != "" && key.SecretKey != "", "第 %d 个 Minio 访问密钥的 accessKey 和 secretKey 不能为空", i+1)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Minio 配置无效: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
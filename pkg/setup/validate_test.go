@@ -0,0 +1,66 @@
+package setup
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		want   string
+	}{
+		{name: "StubTarName 为空", modify: func(cfg *Config) { cfg.StubTarName = "" }, want: "StubTarName"},
+		{name: "DockerCmd 为空", modify: func(cfg *Config) { cfg.DockerCmd = "" }, want: "DockerCmd"},
+		{name: "TarCmd 为空", modify: func(cfg *Config) { cfg.NativeExtract = false; cfg.TarCmd = "" }, want: "TarCmd"},
+		{name: "ConcurrentTasks 为 0", modify: func(cfg *Config) { cfg.ConcurrentTasks = 0 }, want: "ConcurrentTasks"},
+		{name: "Timeout 为负数", modify: func(cfg *Config) { cfg.Timeout = -time.Second }, want: "Timeout"},
+		{name: "阶段超时为负数", modify: func(cfg *Config) { cfg.StageTimeouts.Load = -time.Second }, want: "StageTimeouts.Load"},
+		{name: "PerTaskTimeout 为负数", modify: func(cfg *Config) { cfg.PerTaskTimeout = -time.Second }, want: "PerTaskTimeout"},
+		{name: "MaxRetries 为负数", modify: func(cfg *Config) { cfg.MaxRetries = -1 }, want: "MaxRetries"},
+		{name: "RetryJitter 超过 1", modify: func(cfg *Config) { cfg.RetryJitter = 1.5 }, want: "RetryJitter"},
+		{name: "MaxDepth 为 0", modify: func(cfg *Config) { cfg.MaxDepth = 0 }, want: "MaxDepth"},
+		{name: "ArchSuffix 没有占位符", modify: func(cfg *Config) { cfg.ArchSuffix = "-arch" }, want: "ArchSuffix"},
+		{name: "未知的架构", modify: func(cfg *Config) { cfg.Arch = "mips" }, want: "未知的架构"},
+		{name: "未知的容器运行时", modify: func(cfg *Config) { cfg.Runtime = "lxc" }, want: "容器运行时"},
+		{name: "未知的进度输出方式", modify: func(cfg *Config) { cfg.Progress = "fancy" }, want: "进度输出方式"},
+		{name: "中继模式没有仓库地址", modify: func(cfg *Config) { cfg.Relay.Enabled = true }, want: "目标仓库地址"},
+		{name: "中继模式删除本地镜像并启动服务", modify: func(cfg *Config) { cfg.Relay.RemoveLocal = true; cfg.Relay.Services = true }, want: "删除本地镜像"},
+		{name: "撤销修改需要记录修改", modify: func(cfg *Config) { cfg.TrackChanges = false; cfg.RollbackOnFailure = true }, want: "RollbackOnFailure"},
+		{name: "等待服务的地址无效", modify: func(cfg *Config) { cfg.WaitForServices = []ServiceWait{{Name: "api", URL: "not a url"}} }, want: "健康检查地址"},
+		{name: "预检端口无效", modify: func(cfg *Config) { cfg.PreflightPorts = []int{70000} }, want: "PreflightPorts"},
+	}
+
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("默认配置 Validate() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() error = %v, want 包含 %q", err, tt.want)
+			}
+		})
+	}
+
+	// 所有问题汇总在同一个错误中
+	cfg := DefaultConfig()
+	for _, tt := range tests {
+		tt.modify(cfg)
+	}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() 没有返回错误")
+	}
+	for _, tt := range tests {
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("汇总的错误中没有 %q: %v", tt.want, err)
+		}
+	}
+}
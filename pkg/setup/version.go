@@ -0,0 +1,73 @@
+package setup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 匹配版本号，例如 24.0.7-ce 中的 24.0.7、tar (GNU tar) 1.34 中的 1.34
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// 从命令的版本输出中解析出第一个版本号，忽略 -ce 等后缀
+func parseVersion(s string) ([3]int, bool) {
+	var v [3]int
+	m := versionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return v, false
+	}
+
+	for i, part := range m[1:] {
+		if part != "" {
+			v[i], _ = strconv.Atoi(part)
+		}
+	}
+
+	return v, true
+}
+
+// 比较两个版本号，a 较旧时返回负数
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+
+	return 0
+}
+
+// 执行 name --version 并检查版本不低于 minimum，minimum 为空时不检查
+// 无法识别版本输出时只记录警告
+func checkVersion(ctx context.Context, name, minimum string, cfg *Config) error {
+	if minimum == "" {
+		return nil
+	}
+
+	want, ok := parseVersion(minimum)
+	if !ok {
+		return fmt.Errorf("%s 的最低版本 %s 格式错误", name, minimum)
+	}
+
+	output, err := cfg.runner().Output(command(ctx, cfg, name, "--version"))
+	if err != nil {
+		return fmt.Errorf("获取 %s 版本失败: %w", name, err)
+	}
+
+	line, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	got, ok := parseVersion(line)
+	if !ok {
+		slog.Warn("无法识别命令版本，跳过版本检查", "command", name, "output", line)
+		return nil
+	}
+
+	if compareVersions(got, want) < 0 {
+		return fmt.Errorf("%s 版本过低: %s，至少需要 %s", name, line, minimum)
+	}
+
+	slog.Debug("命令版本", "command", name, "version", line)
+	return nil
+}
@@ -0,0 +1,55 @@
+package setup
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		want   [3]int
+		ok     bool
+	}{
+		{output: "Docker version 24.0.7, build afdd53b", want: [3]int{24, 0, 7}, ok: true},
+		{output: "Docker version 19.03.15-ce, build 99e3ed8", want: [3]int{19, 3, 15}, ok: true},
+		{output: "Docker version 20.10.24+dfsg1, build 297e128", want: [3]int{20, 10, 24}, ok: true},
+		{output: "tar (GNU tar) 1.34", want: [3]int{1, 34, 0}, ok: true},
+		{output: "bsdtar 3.5.3 - libarchive 3.5.3 zlib/1.2.12 liblzma/5.0.5 bz2lib/1.0.8", want: [3]int{3, 5, 3}, ok: true},
+		{output: "podman version 4.9.3", want: [3]int{4, 9, 3}, ok: true},
+		{output: "unknown", ok: false},
+		{output: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			got, ok := parseVersion(tt.output)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("parseVersion(%q) = %v, %v, want %v, %v", tt.output, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "Docker version 20.10.0", b: "20.10.0", want: 0},
+		{a: "Docker version 19.03.15-ce", b: "20.10.0", want: -1},
+		{a: "Docker version 24.0.7", b: "20.10.0", want: 1},
+		{a: "tar (GNU tar) 1.34", b: "1.28", want: 1},
+		{a: "bsdtar 2.8.3 - libarchive 2.8.3", b: "3.0", want: -1},
+		{a: "tar (GNU tar) 1.28", b: "1.28.0", want: 0},
+		{a: "Docker version 20.9.99", b: "20.10.0", want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			a, _ := parseVersion(tt.a)
+			b, _ := parseVersion(tt.b)
+			got := compareVersions(a, b)
+			if got < 0 && tt.want >= 0 || got == 0 && tt.want != 0 || got > 0 && tt.want <= 0 {
+				t.Errorf("compareVersions(%v, %v) = %d, want 符号为 %d", a, b, got, tt.want)
+			}
+		})
+	}
+}